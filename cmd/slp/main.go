@@ -3,7 +3,13 @@ This is the simplified SLP CLI. It does not offer a tui or engage in any of the
 runtime activity. It can take in a single slpx file and execute vanilla slp commands
 
 Use this with "tests/primitive/main.slpx" to run core tests on the SLP language implementation
-without the larger runtime overhead
+without the larger runtime overhead. "-engine vm" runs the file on the bytecode VM instead of
+the tree walker. `use` and `import` search SLPX_PATH and then the lib directory of the SLPX home,
+as the full CLI does
+
+"-expand" prints the file with its macros expanded rather than running it: "1" expands each
+form by one step, "all" fully, and "trace" lists every macro applied (with where it was called
+and defined) for debugging macros that expand to other macros
 
 bosley
 */
@@ -11,12 +17,17 @@ bosley
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 
+	"github.com/bosley/slpx/pkg/slp/env"
 	"github.com/bosley/slpx/pkg/slp/object"
 	"github.com/bosley/slpx/pkg/slp/repl"
 	"github.com/bosley/slpx/pkg/slp/slp"
@@ -28,17 +39,32 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 
-	if len(os.Args) > 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [file]\n", os.Args[0])
+	engineName := flag.String("engine", env.EngineTree.String(), "how to run the file: tree or vm")
+	expandMode := flag.String("expand", "", "print the file with its macros expanded instead of running it: 1, all or trace")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-engine tree|vm] [-expand 1|all|trace] [file]\n", os.Args[0])
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	engine, err := env.ParseEngine(*engineName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [file]\n", os.Args[0])
+	switch *expandMode {
+	case "", "1", "all", "trace":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: -expand takes 1, all or trace, got %q\n", *expandMode)
 		os.Exit(1)
 	}
 
-	filePath := os.Args[1]
+	filePath := flag.Arg(0)
 
 	content, err := os.ReadFile(filePath)
 	if err != nil {
@@ -51,27 +77,40 @@ func main() {
 		absFilePath = filePath
 	}
 
-	session := repl.NewSessionBuilder(logger).Build(absFilePath)
+	session := repl.NewSessionBuilder(logger).
+		WithEngine(engine).
+		WithModulePath(env.DefaultModulePath(slpxHome())...).
+		Build(absFilePath)
+
+	if *expandMode != "" {
+		if err := printExpansion(session.NewParser(string(content)), *expandMode); err != nil {
+			if parseErr, ok := err.(*slp.ParseError); ok {
+				printParseError(absFilePath, string(content), parseErr)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Ctrl+C stops the evaluation at the next step rather than killing the
+	// process mid-write
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	result, err := session.Evaluate(string(content))
+	result, err := session.EvaluateContext(ctx, string(content))
 	session.GetIO().Flush()
+	if code, exited := env.ExitCode(err); exited {
+		os.Exit(code)
+	}
 	if err != nil {
+		if errors.Is(err, env.ErrCancelled) {
+			fmt.Fprintf(os.Stderr, "Interrupted\n")
+			os.Exit(130)
+		}
 		if parseErr, ok := err.(*slp.ParseError); ok {
-			line, col, lineStart, lineEnd := positionToLineCol(string(content), parseErr.Position)
-			fmt.Fprintf(os.Stderr, "Parse error in %s at line %d, column %d:\n", absFilePath, line, col)
-
-			if lineStart < len(content) && lineEnd <= len(content) {
-				lineContent := string(content[lineStart:lineEnd])
-				fmt.Fprintf(os.Stderr, "  %d | %s\n", line, lineContent)
-
-				fmt.Fprintf(os.Stderr, "      ")
-				for i := 1; i < col; i++ {
-					fmt.Fprintf(os.Stderr, " ")
-				}
-				fmt.Fprintf(os.Stderr, "^\n")
-			}
-
-			fmt.Fprintf(os.Stderr, "%s\n", parseErr.Message)
+			printParseError(absFilePath, string(content), parseErr)
 		} else {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
@@ -80,50 +119,87 @@ func main() {
 
 	if result.Type == object.OBJ_TYPE_ERROR {
 		errObj := result.D.(object.Error)
-		fmt.Fprintf(os.Stderr, "%s\n", formatError(errObj, string(content)))
+		fmt.Fprintf(os.Stderr, "%s\n", formatError(errObj, string(content), session.GetFS()))
 		os.Exit(1)
 	}
 
 	fmt.Printf("Result: %s\n", result.Encode())
 }
 
-func positionToLineCol(content string, position int) (line int, col int, lineStart int, lineEnd int) {
-	line = 1
-	col = 1
-	lineStart = 0
+// printExpansion prints every form parser holds with its macros expanded by
+// one step, fully, or (for trace) prints each macro as it is applied, nested
+// expansions indented under the one that produced them
+func printExpansion(parser *slp.Parser, mode string) error {
+	parser.NoExpand = true
+	forms, err := parser.ParseAll()
+	if err != nil {
+		return err
+	}
 
-	for i := 0; i < len(content) && i < position; i++ {
-		if content[i] == '\n' {
-			line++
-			col = 1
-			lineStart = i + 1
+	if mode == "trace" {
+		parser.Trace = func(step slp.MacroExpansion) {
+			indent := strings.Repeat("  ", step.Depth)
+			fmt.Printf("%s%s\n%s  => %s\n", indent, step, indent, step.Result.Encode())
+		}
+	}
+
+	for _, form := range forms {
+		expanded := form
+		if mode == "1" {
+			expanded, _, err = parser.Expand1(form)
 		} else {
-			col++
+			expanded, err = parser.Expand(form)
+		}
+		if err != nil {
+			return err
+		}
+		if mode != "trace" {
+			fmt.Println(expanded.Encode())
 		}
 	}
+	return nil
+}
+
+func printParseError(path string, content string, parseErr *slp.ParseError) {
+	line, col := parseErr.Position.Line, parseErr.Position.Column
+	fmt.Fprintf(os.Stderr, "Parse error in %s at line %d, column %d:\n", path, line, col)
 
-	lineEnd = lineStart
-	for lineEnd < len(content) && content[lineEnd] != '\n' {
-		lineEnd++
+	if lineContent, ok := object.SourceLine(content, line); ok {
+		fmt.Fprintf(os.Stderr, "  %d | %s\n", line, lineContent)
+
+		fmt.Fprintf(os.Stderr, "      ")
+		for i := 1; i < col; i++ {
+			fmt.Fprintf(os.Stderr, " ")
+		}
+		fmt.Fprintf(os.Stderr, "^\n")
 	}
 
-	return line, col, lineStart, lineEnd
+	fmt.Fprintf(os.Stderr, "%s\n", parseErr.Message)
 }
 
-func formatError(err object.Error, sourceContent string) string {
+// formatError shows the line err points at, read through fs so that a file
+// the session found in a bundle or an overlay is shown as it was run
+func formatError(err object.Error, sourceContent string, fs env.FS) string {
 	var output strings.Builder
 
 	if err.File != "" {
-		if err.Position == 0 {
+		if err.Position.IsZero() {
 			output.WriteString(fmt.Sprintf("Error in %s:\n", err.File))
-			output.WriteString(err.Message)
+			output.WriteString(err.Summary())
 		} else {
-			line, col, lineStart, lineEnd := positionToLineCol(sourceContent, err.Position)
+			// errors raised inside a file pulled in with `use` point into that
+			// file, not the one we were handed
+			if file := err.Position.File(); file != "" {
+				if content, readErr := fs.ReadFile(file); readErr == nil {
+					sourceContent = string(content)
+				}
+			}
+
+			line, col := err.Position.Line, err.Position.Column
 
 			output.WriteString(fmt.Sprintf("Error in %s at line %d, column %d:\n", err.File, line, col))
 
-			if lineStart < len(sourceContent) && lineEnd <= len(sourceContent) {
-				lineContent := sourceContent[lineStart:lineEnd]
+			if lineContent, ok := object.SourceLine(sourceContent, line); ok {
 				output.WriteString(fmt.Sprintf("  %d | %s\n", line, lineContent))
 
 				output.WriteString("      ")
@@ -133,11 +209,26 @@ func formatError(err object.Error, sourceContent string) string {
 				output.WriteString("^\n")
 			}
 
-			output.WriteString(err.Message)
+			output.WriteString(err.Summary())
 		}
 	} else {
-		output.WriteString(fmt.Sprintf("Error: %s", err.Message))
+		output.WriteString(fmt.Sprintf("Error: %s", err.Summary()))
 	}
 
+	output.WriteString(object.FormatBacktrace(err.Trace))
+
 	return output.String()
 }
+
+// slpxHome is where cmd/slpx keeps its configuration. Unlike cmd/slpx this
+// never creates it
+func slpxHome() string {
+	if home := os.Getenv("SLPX_HOME"); home != "" {
+		return home
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "slpx")
+}
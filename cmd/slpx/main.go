@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
@@ -11,6 +14,7 @@ import (
 	"github.com/bosley/slpx/cmd/slpx/installer"
 	"github.com/bosley/slpx/cmd/slpx/tui"
 	"github.com/bosley/slpx/pkg/rt"
+	"github.com/bosley/slpx/pkg/slp/env"
 	"github.com/bosley/slpx/pkg/slp/object"
 	"github.com/bosley/slpx/pkg/slp/slp"
 	"github.com/fatih/color"
@@ -37,7 +41,7 @@ func main() {
 	}
 
 	if len(os.Args) > 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [file]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [file | bundle.zip | bundle.tar.gz]\n", os.Args[0])
 		os.Exit(1)
 	}
 
@@ -55,15 +59,49 @@ func main() {
 		return
 	}
 
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", filePath, err)
-		os.Exit(1)
-	}
+	// a bundle is run from inside the archive: its main.slpx is the entry
+	// point and every context sees the archive rather than the disk
+	var newFS func() (env.FS, error)
+	var content []byte
+	var absFilePath string
+	if env.IsArchivePath(filePath) {
+		bundle, err := env.OpenArchiveFS(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening bundle %s: %v\n", filePath, err)
+			os.Exit(1)
+		}
+		absFilePath, err = bundleEntry(bundle)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in bundle %s: %v\n", filePath, err)
+			os.Exit(1)
+		}
+		// the bundle is unpacked once and every context gets its own view of
+		// it. Relative paths start from the entry point's directory, as they
+		// would if the bundle were unpacked and run from there
+		newFS = func() (env.FS, error) {
+			contextFS, err := env.NewArchiveView(bundle)
+			if err != nil {
+				return nil, err
+			}
+			return contextFS, contextFS.SetWorkingDir(filepath.Dir(absFilePath))
+		}
+		content, err = bundle.ReadFile(absFilePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s from bundle %s: %v\n", absFilePath, filePath, err)
+			os.Exit(1)
+		}
+	} else {
+		var err error
+		content, err = os.ReadFile(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", filePath, err)
+			os.Exit(1)
+		}
 
-	absFilePath, err := filepath.Abs(filePath)
-	if err != nil {
-		absFilePath = filePath
+		absFilePath, err = filepath.Abs(filePath)
+		if err != nil {
+			absFilePath = filePath
+		}
 	}
 
 	runtime, err := rt.New(rt.Config{
@@ -71,6 +109,7 @@ func main() {
 		SLPXHome:        slpxHome,
 		LaunchDirectory: absFilePath,
 		SetupContent:    setupContent,
+		NewFS:           newFS,
 	})
 
 	if err != nil {
@@ -88,15 +127,26 @@ func main() {
 
 	session := ac.GetRepl()
 
-	result, err := session.Evaluate(string(content))
+	// Ctrl+C stops the evaluation at the next step rather than killing the
+	// process mid-write
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := session.EvaluateContext(ctx, string(content))
 	session.GetIO().Flush()
+	if code, exited := env.ExitCode(err); exited {
+		os.Exit(code)
+	}
 	if err != nil {
+		if errors.Is(err, env.ErrCancelled) {
+			fmt.Fprintf(os.Stderr, "Interrupted\n")
+			os.Exit(130)
+		}
 		if parseErr, ok := err.(*slp.ParseError); ok {
-			line, col, lineStart, lineEnd := positionToLineCol(string(content), parseErr.Position)
+			line, col := parseErr.Position.Line, parseErr.Position.Column
 			fmt.Fprintf(os.Stderr, "Parse error in %s at line %d, column %d:\n", absFilePath, line, col)
 
-			if lineStart < len(content) && lineEnd <= len(content) {
-				lineContent := string(content[lineStart:lineEnd])
+			if lineContent, ok := object.SourceLine(string(content), line); ok {
 				fmt.Fprintf(os.Stderr, "  %d | %s\n", line, lineContent)
 
 				fmt.Fprintf(os.Stderr, "      ")
@@ -115,7 +165,7 @@ func main() {
 
 	if result.Type == object.OBJ_TYPE_ERROR {
 		errObj := result.D.(object.Error)
-		fmt.Fprintf(os.Stderr, "%s\n", formatError(errObj, string(content)))
+		fmt.Fprintf(os.Stderr, "%s\n", formatError(errObj, string(content), session.GetFS()))
 		os.Exit(1)
 	}
 
@@ -170,49 +220,54 @@ func setupSLPXHome() string {
 	return slpxHome
 }
 
+// bundleEntry finds the main.slpx of a bundle, either at the root of the
+// archive or inside the one directory at its root (how most tools archive a
+// folder)
+func bundleEntry(bundle env.FS) (string, error) {
+	const entry = "main.slpx"
+	root := string(filepath.Separator)
+	if bundle.IsFile(filepath.Join(root, entry)) {
+		return filepath.Join(root, entry), nil
+	}
+	names, err := bundle.ListDir(root)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 1 && bundle.IsFile(filepath.Join(root, names[0], entry)) {
+		return filepath.Join(root, names[0], entry), nil
+	}
+	return "", fmt.Errorf("no %s at the root of the archive", entry)
+}
+
 func install(logger *slog.Logger, slpxHome string) {
 	installer.InstallDefault(logger, slpxHome)
 	time.Sleep(250 * time.Millisecond)
 	os.Exit(0)
 }
 
-func positionToLineCol(content string, position int) (line int, col int, lineStart int, lineEnd int) {
-	line = 1
-	col = 1
-	lineStart = 0
-
-	for i := 0; i < len(content) && i < position; i++ {
-		if content[i] == '\n' {
-			line++
-			col = 1
-			lineStart = i + 1
-		} else {
-			col++
-		}
-	}
-
-	lineEnd = lineStart
-	for lineEnd < len(content) && content[lineEnd] != '\n' {
-		lineEnd++
-	}
-
-	return line, col, lineStart, lineEnd
-}
-
-func formatError(err object.Error, sourceContent string) string {
+// formatError shows the line err points at, read through fs so that a file
+// the session found in a bundle or an overlay is shown as it was run
+func formatError(err object.Error, sourceContent string, fs env.FS) string {
 	var output strings.Builder
 
 	if err.File != "" {
-		if err.Position == 0 {
+		if err.Position.IsZero() {
 			output.WriteString(fmt.Sprintf("Error in %s:\n", err.File))
-			output.WriteString(err.Message)
+			output.WriteString(err.Summary())
 		} else {
-			line, col, lineStart, lineEnd := positionToLineCol(sourceContent, err.Position)
+			// errors raised inside a file pulled in with `use` point into that
+			// file, not the one we were handed
+			if file := err.Position.File(); file != "" {
+				if content, readErr := fs.ReadFile(file); readErr == nil {
+					sourceContent = string(content)
+				}
+			}
+
+			line, col := err.Position.Line, err.Position.Column
 
 			output.WriteString(fmt.Sprintf("Error in %s at line %d, column %d:\n", err.File, line, col))
 
-			if lineStart < len(sourceContent) && lineEnd <= len(sourceContent) {
-				lineContent := sourceContent[lineStart:lineEnd]
+			if lineContent, ok := object.SourceLine(sourceContent, line); ok {
 				output.WriteString(fmt.Sprintf("  %d | %s\n", line, lineContent))
 
 				output.WriteString("      ")
@@ -222,12 +277,14 @@ func formatError(err object.Error, sourceContent string) string {
 				output.WriteString("^\n")
 			}
 
-			output.WriteString(err.Message)
+			output.WriteString(err.Summary())
 		}
 	} else {
-		output.WriteString(fmt.Sprintf("Error: %s", err.Message))
+		output.WriteString(fmt.Sprintf("Error: %s", err.Summary()))
 	}
 
+	output.WriteString(object.FormatBacktrace(err.Trace))
+
 	return output.String()
 }
 
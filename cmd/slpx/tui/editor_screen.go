@@ -116,9 +116,11 @@ func (s *EditorScreen) Update(shared *SharedState, msg tea.Msg) (Screen, tea.Cmd
 					s.textarea.Reset()
 					return NewREPLScreen(), tea.WindowSize()
 				}
-				output := shared.EvaluateInput(value)
-				shared.AddCommand(value, output)
+				if shared.Evaluating() {
+					return NewREPLScreen(), nil
+				}
 				s.textarea.Reset()
+				return NewREPLScreen(), shared.StartEvaluation(value)
 			}
 			return NewREPLScreen(), nil
 		case "tab":
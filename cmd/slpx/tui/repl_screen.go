@@ -99,15 +99,20 @@ func (s *REPLScreen) Update(shared *SharedState, msg tea.Msg) (Screen, tea.Cmd)
 					s.textarea.Reset()
 					return s, tea.WindowSize()
 				}
-				output := shared.EvaluateInput(value)
-				shared.AddCommand(value, output)
-				content := shared.RenderOutput()
-				s.viewport.SetContent(lipgloss.NewStyle().Width(s.viewport.Width).Render(content))
+				if shared.Evaluating() {
+					return s, nil
+				}
 				s.textarea.Reset()
-				s.viewport.GotoBottom()
+				return s, shared.StartEvaluation(value)
 			}
 			return s, nil
 		}
+
+	case evaluationDoneMsg:
+		content := shared.RenderOutput()
+		s.viewport.SetContent(lipgloss.NewStyle().Width(s.viewport.Width).Render(content))
+		s.viewport.GotoBottom()
+		return s, nil
 	}
 
 	s.textarea, tiCmd = s.textarea.Update(msg)
@@ -128,5 +133,8 @@ func (s *REPLScreen) View(shared *SharedState) string {
 
 	helpText := shared.HelpStyle().Render(fmt.Sprintf("%s: editor/history • %s: scroll output • %s/%s: quit",
 		ctrlE, ctrlO, ctrlC, esc))
+	if shared.Evaluating() {
+		helpText = shared.HelpStyle().Render(fmt.Sprintf("evaluating... • %s: cancel", ctrlC))
+	}
 	return fmt.Sprintf("%s%s%s\n%s", s.viewport.View(), gap, s.textarea.View(), helpText)
 }
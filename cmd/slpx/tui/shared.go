@@ -1,7 +1,9 @@
 package tui
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,9 +12,11 @@ import (
 	"sync"
 
 	"github.com/bosley/slpx/pkg/rt"
+	"github.com/bosley/slpx/pkg/slp/env"
 	"github.com/bosley/slpx/pkg/slp/object"
 	"github.com/bosley/slpx/pkg/slp/repl"
 	"github.com/bosley/slpx/pkg/slp/slp"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -88,6 +92,16 @@ type SharedState struct {
 	TuiConfig       rt.TuiConfig
 	slpxHome        string
 	historyFilePath string
+
+	// set while an evaluation is running on its own goroutine
+	cancelEvaluation context.CancelFunc
+}
+
+// evaluationDoneMsg is delivered to the model once an evaluation started with
+// StartEvaluation has finished (or been cancelled)
+type evaluationDoneMsg struct {
+	input  string
+	output string
 }
 
 func (s *SharedState) PromptStyle() lipgloss.Style {
@@ -130,10 +144,44 @@ func (s *SharedState) SecondaryActionStyle() lipgloss.Style {
 	return lipgloss.NewStyle().Foreground(lipgloss.Color(s.TuiConfig.SecondaryActionColor)).Bold(true)
 }
 
-func (s *SharedState) EvaluateInput(input string) string {
+// StartEvaluation evaluates input off the UI goroutine so that the TUI stays
+// responsive (and Ctrl+C can cancel it). Only one evaluation runs at a time
+func (s *SharedState) StartEvaluation(input string) tea.Cmd {
+	if s.Evaluating() {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelEvaluation = cancel
+
+	return func() tea.Msg {
+		defer cancel()
+		return evaluationDoneMsg{
+			input:  input,
+			output: s.EvaluateInput(ctx, input),
+		}
+	}
+}
+
+func (s *SharedState) Evaluating() bool {
+	return s.cancelEvaluation != nil
+}
+
+func (s *SharedState) CancelEvaluation() {
+	if s.cancelEvaluation != nil {
+		s.cancelEvaluation()
+	}
+}
+
+func (s *SharedState) finishEvaluation(msg evaluationDoneMsg) {
+	s.cancelEvaluation = nil
+	s.AddCommand(msg.input, msg.output)
+}
+
+func (s *SharedState) EvaluateInput(ctx context.Context, input string) string {
 	s.CapturedIO.GetAndClear()
 
-	result, err := s.Session.Evaluate(input)
+	result, err := s.Session.EvaluateContext(ctx, input)
 
 	capturedOutput := s.CapturedIO.GetAndClear()
 
@@ -146,8 +194,22 @@ func (s *SharedState) EvaluateInput(input string) string {
 		}
 	}
 
+	if errors.Is(err, env.ErrCancelled) {
+		output.WriteString(s.ErrorStyle().Render("Evaluation cancelled"))
+		return output.String()
+	}
+	if code, exited := env.ExitCode(err); exited {
+		output.WriteString(s.ErrorStyle().Render(fmt.Sprintf("Exited with code %d", code)))
+		return output.String()
+	}
+
 	if err != nil || result.Type == object.OBJ_TYPE_ERROR {
-		routedResult, routeErr := s.tryCommandRoute(input)
+		routedResult, routeErr := s.tryCommandRoute(ctx, input)
+		if code, exited := env.ExitCode(routeErr); exited {
+			output.WriteString(s.CapturedIO.GetAndClear())
+			output.WriteString(s.ErrorStyle().Render(fmt.Sprintf("Exited with code %d", code)))
+			return output.String()
+		}
 		if routeErr == nil && routedResult.Type != object.OBJ_TYPE_ERROR && routedResult.Type != "" {
 			routedOutput := s.CapturedIO.GetAndClear()
 			if routedOutput != "" {
@@ -164,7 +226,7 @@ func (s *SharedState) EvaluateInput(input string) string {
 
 		if err != nil {
 			if parseErr, ok := err.(*slp.ParseError); ok {
-				output.WriteString(s.ErrorStyle().Render(fmt.Sprintf("Parse Error: %s", parseErr.Message)))
+				output.WriteString(s.ErrorStyle().Render(fmt.Sprintf("Parse Error: %s (line %d, column %d)", parseErr.Message, parseErr.Position.Line, parseErr.Position.Column)))
 			} else {
 				output.WriteString(s.ErrorStyle().Render(fmt.Sprintf("Error: %v", err)))
 			}
@@ -185,24 +247,21 @@ func (s *SharedState) EvaluateInput(input string) string {
 	return output.String()
 }
 
-func (s *SharedState) tryCommandRoute(input string) (object.Obj, error) {
+func (s *SharedState) tryCommandRoute(ctx context.Context, input string) (object.Obj, error) {
 	if s.TuiConfig.CommandRouter.Body == nil {
 		return object.Obj{}, nil // no command router, so we don't try to route
 	}
 
-	routerIdent := object.Identifier("command_router")
-	_, err := s.Session.GetMEM().Get(routerIdent, true)
+	router, err := s.Session.Lookup(object.Identifier("command_router"))
 	if err != nil {
 		return object.Obj{}, fmt.Errorf("command_router not in memory")
 	}
 
-	callExpr := fmt.Sprintf("(command_router %q)", input)
-	result, evalErr := s.Session.Evaluate(callExpr)
-	if evalErr != nil {
-		return object.Obj{}, evalErr
-	}
-
-	return result, nil
+	// the input goes to the router as a string value, so nothing in it is
+	// ever read as SLP
+	return s.Session.CallContext(ctx, router, object.List{
+		{Type: object.OBJ_TYPE_STRING, D: input},
+	})
 }
 
 func (s *SharedState) AddCommand(input string, output string) {
@@ -50,13 +50,25 @@ func initialModel(logger *slog.Logger, slpxHome string, setupContent string) (mo
 	session.GetIO().SetStdout(capturedIO)
 	session.GetIO().SetStderr(capturedIO)
 
+	// files used or imported from the REPL are reloaded once they are edited,
+	// and what happened shows up with the next result
+	session.Watch(func(path string, result object.Obj, err error) {
+		switch {
+		case err != nil:
+			session.GetIO().WriteErrorString(fmt.Sprintf("reload %s: %v\n", path, err))
+		case result.Type == object.OBJ_TYPE_ERROR:
+			session.GetIO().WriteErrorString(fmt.Sprintf("reload %s: %s\n", path, result.D.(object.Error).Summary()))
+		default:
+			session.GetIO().WriteString(fmt.Sprintf("reloaded %s\n", path))
+		}
+	})
+
 	tuiConfig := ac.GetTuiConfig()
 
 	if tuiConfig.CommandRouter.Body != nil {
 		routerObj := object.Obj{
 			Type: object.OBJ_TYPE_FUNCTION,
 			D:    tuiConfig.CommandRouter,
-			Pos:  0,
 		}
 		session.GetMEM().Set(object.Identifier("command_router"), routerObj, true)
 	}
@@ -94,6 +106,17 @@ func (m model) Init() tea.Cmd {
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case evaluationDoneMsg:
+		m.shared.finishEvaluation(msg)
+	case tea.KeyMsg:
+		// while something is running ctrl+c stops it instead of quitting
+		if msg.String() == "ctrl+c" && m.shared.Evaluating() {
+			m.shared.CancelEvaluation()
+			return m, nil
+		}
+	}
+
 	nextScreen, cmd := m.currentScreen.Update(m.shared, msg)
 
 	if nextScreen != m.currentScreen {
@@ -119,6 +142,7 @@ func Launch(logger *slog.Logger, slpxHome string, setupContent string) {
 	}
 
 	defer func() {
+		m.shared.CancelEvaluation()
 		if m.shared.ActiveContext != nil {
 			m.shared.ActiveContext.Close()
 		}
@@ -1,6 +1,7 @@
 package rt
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"path/filepath"
@@ -19,6 +20,14 @@ type ActiveContext interface {
 	DisplayName() string
 	GetRepl() *repl.Session
 	GetTuiConfig() TuiConfig
+
+	// Usage reports what the context's session has consumed against the
+	// runtime's Limits
+	Usage() env.Usage
+
+	// Policy is what the context's session is allowed to call
+	Policy() env.Policy
+
 	Close() error
 }
 
@@ -33,24 +42,37 @@ type Runtime interface {
 	*/
 	NewActiveContext(name string) (ActiveContext, error)
 
+	/*
+		NewRestrictedContext is NewActiveContext with a policy of its own in
+		place of the runtime's, for handing a context to code that should not
+		have the run of the machine
+	*/
+	NewRestrictedContext(name string, policy env.Policy) (ActiveContext, error)
+
 	Stop() error
 }
 
 type TuiConfig struct {
-	CmdToggleEditor      string
-	CmdToggleOutput      string
-	CmdClear             string
-	PromptColor          string
-	ResultColor          string
-	ErrorColor           string
-	HelpColor            string
-	FocusedBorderColor   string
-	BlurredBorderColor   string
-	SelectedItemColor    string
-	HistoryItemColor     string
-	DirtyPromptColor     string
-	SecondaryActionColor string
-	CommandRouter        object.Function
+	CmdToggleEditor      string          `slpx:"cmd_toggle_editor,required"`
+	CmdToggleOutput      string          `slpx:"cmd_toggle_output,required"`
+	CmdClear             string          `slpx:"cmd_clear,required"`
+	PromptColor          string          `slpx:"color_prompt,required"`
+	ResultColor          string          `slpx:"color_result,required"`
+	ErrorColor           string          `slpx:"color_error,required"`
+	HelpColor            string          `slpx:"color_help,required"`
+	FocusedBorderColor   string          `slpx:"color_focused_border,required"`
+	BlurredBorderColor   string          `slpx:"color_blurred_border,required"`
+	SelectedItemColor    string          `slpx:"color_selected_item,required"`
+	HistoryItemColor     string          `slpx:"color_history_item,required"`
+	DirtyPromptColor     string          `slpx:"color_dirty_prompt,required"`
+	SecondaryActionColor string          `slpx:"color_secondary_action,required"`
+	CommandRouter        object.Function `slpx:"command_router"`
+}
+
+// initConfig is what init.slpx sets
+type initConfig struct {
+	TuiConfig
+	EnvironmentPreload object.List `slpx:"environment_preload"`
 }
 
 type activeContext struct {
@@ -61,7 +83,8 @@ type activeContext struct {
 	io          env.IO
 	mem         env.MEM
 
-	repl *repl.Session
+	repl   *repl.Session
+	policy env.Policy
 
 	onClose func() error
 
@@ -84,6 +107,14 @@ func (x *activeContext) GetTuiConfig() TuiConfig {
 	return x.tuiConfig
 }
 
+func (x *activeContext) Usage() env.Usage {
+	return x.repl.Usage()
+}
+
+func (x *activeContext) Policy() env.Policy {
+	return x.policy
+}
+
 func (x *activeContext) Close() error {
 	return x.onClose()
 }
@@ -93,6 +124,10 @@ type runtimeImpl struct {
 	slpxHome        string
 	launchDirectory string
 	setupContent    string
+	limits          env.Limits
+	policy          env.Policy
+	newFS           func() (env.FS, error)
+	modulePath      []string
 
 	activeContexts map[string]activeContext
 	acMutex        sync.Mutex
@@ -103,15 +138,42 @@ type Config struct {
 	SLPXHome        string
 	LaunchDirectory string
 	SetupContent    string
+
+	// Limits are applied to every active context the runtime hands out. The
+	// zero value leaves evaluation unbounded
+	Limits env.Limits
+
+	// Policy is applied to every context from NewActiveContext. The zero
+	// value allows everything
+	Policy env.Policy
+
+	// NewFS makes the filesystem each active context sees (env.NewMemoryFS,
+	// env.NewOverlayFS, env.NewJailedFS, ...). Contexts get the host
+	// filesystem when it is nil
+	NewFS func() (env.FS, error)
+
+	// ModulePath is where `use` and `import` look for files that are not
+	// next to the current one. Nil selects env.DefaultModulePath(SLPXHome);
+	// an empty slice searches nowhere else
+	ModulePath []string
 }
 
 func New(config Config) (Runtime, error) {
 
+	modulePath := config.ModulePath
+	if modulePath == nil {
+		modulePath = env.DefaultModulePath(config.SLPXHome)
+	}
+
 	return &runtimeImpl{
 		logger:          config.Logger,
 		slpxHome:        config.SLPXHome,
 		launchDirectory: config.LaunchDirectory,
 		setupContent:    config.SetupContent,
+		limits:          config.Limits,
+		policy:          config.Policy,
+		newFS:           config.NewFS,
+		modulePath:      modulePath,
 		activeContexts:  make(map[string]activeContext),
 		acMutex:         sync.Mutex{},
 	}, nil
@@ -127,8 +189,11 @@ func (r *runtimeImpl) onActiveContextClose(id string) {
 	delete(r.activeContexts, id)
 }
 
-func (r *runtimeImpl) getFsForNewActiveContext() env.FS {
-	return env.DefaultFS()
+func (r *runtimeImpl) getFsForNewActiveContext() (env.FS, error) {
+	if r.newFS != nil {
+		return r.newFS()
+	}
+	return env.DefaultFS(), nil
 }
 func (r *runtimeImpl) getIoForNewActiveContext() env.IO {
 	return env.DefaultIO()
@@ -137,54 +202,46 @@ func (r *runtimeImpl) getMemForNewActiveContext() env.MEM {
 	return env.DefaultMEM()
 }
 
-func (r *runtimeImpl) getEvalBuilderForNewActiveContext(id string) env.EvaluationContext {
-	return env.NewEvalBuilder(r.logger.WithGroup("ac:" + id)).Build()
+func (r *runtimeImpl) getEvalBuilderForNewActiveContext(id string, policy env.Policy) env.EvaluationContext {
+	return env.NewEvalBuilder(r.logger.WithGroup("ac:" + id)).WithLimits(r.limits).WithPolicy(policy).Build()
 }
 
 func (r *runtimeImpl) NewActiveContext(displayName string) (ActiveContext, error) {
+	return r.NewRestrictedContext(displayName, r.policy)
+}
+
+func (r *runtimeImpl) NewRestrictedContext(displayName string, policy env.Policy) (ActiveContext, error) {
 
 	uuid := uuid.New().String()
 
-	fs := r.getFsForNewActiveContext()
+	fs, err := r.getFsForNewActiveContext()
+	if err != nil {
+		return nil, fmt.Errorf("creating filesystem for context: %w", err)
+	}
 	io := r.getIoForNewActiveContext()
 	mem := r.getMemForNewActiveContext()
 
-	repl := repl.NewSessionBuilder(r.logger).WithFS(fs).WithIO(io).WithMEM(mem).Build(r.launchDirectory)
+	repl := repl.NewSessionBuilder(r.logger).WithFS(fs).WithIO(io).WithMEM(mem).WithLimits(r.limits).WithPolicy(policy).WithModulePath(r.modulePath...).Build(r.launchDirectory)
 
+	// init.slpx runs through the context's own filesystem, so what it uses
+	// or reads is held to the same filesystem as the context
 	initFilePath := filepath.Join(r.slpxHome, "init.slpx")
-	configuration, err := slpxcfg.LoadFromContent(r.logger, initFilePath, r.setupContent, 10*time.Second, []slpxcfg.Variable{
-		{Identifier: "cmd_toggle_editor", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "cmd_toggle_output", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "cmd_clear", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_prompt", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_result", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_error", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_help", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_focused_border", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_blurred_border", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_selected_item", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_history_item", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_dirty_prompt", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "color_secondary_action", Type: object.OBJ_TYPE_STRING, Required: true},
-		{Identifier: "command_router", Type: object.OBJ_TYPE_FUNCTION, Required: false},
-		{Identifier: "environment_preload", Type: object.OBJ_TYPE_LIST, Required: false},
-	}, fs, io)
+	var configuration initConfig
+	err = slpxcfg.LoadFromContentInto(r.logger, initFilePath, r.setupContent, 10*time.Second, &configuration, fs, io)
 	if err != nil {
 		return nil, err
 	}
 
-	var commandRouter object.Function
-	if routerObj, ok := configuration["command_router"]; ok {
-		commandRouter = routerObj.D.(object.Function)
+	if configuration.CommandRouter.Body != nil {
 		r.logger.Info("command_router loaded from configuration")
 	} else {
 		r.logger.Warn("command_router not found in configuration - custom commands will not be available")
 	}
 
-	if preloadObj, ok := configuration["environment_preload"]; ok {
+	if configuration.EnvironmentPreload != nil {
 		r.logger.Info("evaluating environment_preload")
-		encodedList := preloadObj.Encode()
-		_, evalErr := repl.Evaluate(encodedList)
+		preload := object.Obj{Type: object.OBJ_TYPE_LIST, D: configuration.EnvironmentPreload}
+		_, evalErr := repl.EvaluateObjectContext(context.Background(), preload)
 		if evalErr != nil {
 			r.logger.Warn("failed to evaluate environment_preload", "error", evalErr)
 		} else {
@@ -192,22 +249,7 @@ func (r *runtimeImpl) NewActiveContext(displayName string) (ActiveContext, error
 		}
 	}
 
-	tuiConfig := TuiConfig{
-		CmdToggleEditor:      configuration["cmd_toggle_editor"].D.(string),
-		CmdToggleOutput:      configuration["cmd_toggle_output"].D.(string),
-		CmdClear:             configuration["cmd_clear"].D.(string),
-		PromptColor:          configuration["color_prompt"].D.(string),
-		ResultColor:          configuration["color_result"].D.(string),
-		ErrorColor:           configuration["color_error"].D.(string),
-		HelpColor:            configuration["color_help"].D.(string),
-		FocusedBorderColor:   configuration["color_focused_border"].D.(string),
-		BlurredBorderColor:   configuration["color_blurred_border"].D.(string),
-		SelectedItemColor:    configuration["color_selected_item"].D.(string),
-		HistoryItemColor:     configuration["color_history_item"].D.(string),
-		DirtyPromptColor:     configuration["color_dirty_prompt"].D.(string),
-		SecondaryActionColor: configuration["color_secondary_action"].D.(string),
-		CommandRouter:        commandRouter,
-	}
+	tuiConfig := configuration.TuiConfig
 
 	restrictedShortcuts := []string{
 		"enter",
@@ -237,11 +279,12 @@ func (r *runtimeImpl) NewActiveContext(displayName string) (ActiveContext, error
 	ac := activeContext{
 		id:          uuid,
 		displayName: displayName,
-		env:         r.getEvalBuilderForNewActiveContext(uuid),
+		env:         r.getEvalBuilderForNewActiveContext(uuid, policy),
 		fs:          fs,
 		io:          io,
 		mem:         mem,
 		repl:        repl,
+		policy:      policy,
 		tuiConfig:   tuiConfig,
 		onClose: func() error {
 			/*
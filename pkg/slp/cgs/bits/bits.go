@@ -79,8 +79,7 @@ func (x *bitsFunctions) cmdExplode(ctx env.EvaluationContext, args object.List)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  fmt.Sprintf("bits/explode: unsupported type %s, expected integer or real", value.Type),
+				Message: fmt.Sprintf("bits/explode: unsupported type %s, expected integer or real", value.Type),
 			},
 		}, nil
 	}
@@ -95,8 +94,7 @@ func (x *bitsFunctions) cmdInt(ctx env.EvaluationContext, args object.List) (obj
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  fmt.Sprintf("bits/int: expected 64 bits, got %d", len(bitsList)),
+				Message: fmt.Sprintf("bits/int: expected 64 bits, got %d", len(bitsList)),
 			},
 		}, nil
 	}
@@ -107,8 +105,7 @@ func (x *bitsFunctions) cmdInt(ctx env.EvaluationContext, args object.List) (obj
 			return object.Obj{
 				Type: object.OBJ_TYPE_ERROR,
 				D: object.Error{
-					Position: 0,
-					Message:  fmt.Sprintf("bits/int: bit at position %d is not an integer", i),
+					Message: fmt.Sprintf("bits/int: bit at position %d is not an integer", i),
 				},
 			}, nil
 		}
@@ -117,8 +114,7 @@ func (x *bitsFunctions) cmdInt(ctx env.EvaluationContext, args object.List) (obj
 			return object.Obj{
 				Type: object.OBJ_TYPE_ERROR,
 				D: object.Error{
-					Position: 0,
-					Message:  fmt.Sprintf("bits/int: bit at position %d must be 0 or 1, got %d", i, bit),
+					Message: fmt.Sprintf("bits/int: bit at position %d must be 0 or 1, got %d", i, bit),
 				},
 			}, nil
 		}
@@ -137,8 +133,7 @@ func (x *bitsFunctions) cmdReal(ctx env.EvaluationContext, args object.List) (ob
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  fmt.Sprintf("bits/real: expected 64 bits, got %d", len(bitsList)),
+				Message: fmt.Sprintf("bits/real: expected 64 bits, got %d", len(bitsList)),
 			},
 		}, nil
 	}
@@ -149,8 +144,7 @@ func (x *bitsFunctions) cmdReal(ctx env.EvaluationContext, args object.List) (ob
 			return object.Obj{
 				Type: object.OBJ_TYPE_ERROR,
 				D: object.Error{
-					Position: 0,
-					Message:  fmt.Sprintf("bits/real: bit at position %d is not an integer", i),
+					Message: fmt.Sprintf("bits/real: bit at position %d is not an integer", i),
 				},
 			}, nil
 		}
@@ -159,8 +153,7 @@ func (x *bitsFunctions) cmdReal(ctx env.EvaluationContext, args object.List) (ob
 			return object.Obj{
 				Type: object.OBJ_TYPE_ERROR,
 				D: object.Error{
-					Position: 0,
-					Message:  fmt.Sprintf("bits/real: bit at position %d must be 0 or 1, got %d", i, bit),
+					Message: fmt.Sprintf("bits/real: bit at position %d must be 0 or 1, got %d", i, bit),
 				},
 			}, nil
 		}
@@ -0,0 +1,400 @@
+package bytes
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/bosley/slpx/pkg/slp/env"
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+type bytesFunctions struct{}
+
+func NewBytesFunctions() env.FunctionGroup {
+	return &bytesFunctions{}
+}
+
+func (b *bytesFunctions) Name() string {
+	return "bytes"
+}
+
+func (b *bytesFunctions) Functions() map[object.Identifier]env.EnvFunction {
+	return map[object.Identifier]env.EnvFunction{
+		"bytes/new": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "length", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "fill", Type: object.OBJ_TYPE_INTEGER},
+			},
+			ReturnType: object.OBJ_TYPE_BYTES,
+			Body:       cmdBytesNew,
+		},
+		"bytes/len": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdBytesLen,
+		},
+		"bytes/get": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+				{Name: "index", Type: object.OBJ_TYPE_INTEGER},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdBytesGet,
+		},
+		"bytes/set": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+				{Name: "index", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "value", Type: object.OBJ_TYPE_INTEGER},
+			},
+			ReturnType: object.OBJ_TYPE_BYTES,
+			Body:       cmdBytesSet,
+		},
+		"bytes/slice": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+				{Name: "start", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "end", Type: object.OBJ_TYPE_INTEGER},
+			},
+			ReturnType: object.OBJ_TYPE_BYTES,
+			Body:       cmdBytesSlice,
+		},
+		"bytes/concat": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "parts", Type: object.OBJ_TYPE_BYTES},
+			},
+			ReturnType: object.OBJ_TYPE_BYTES,
+			Variadic:   true,
+			Body:       cmdBytesConcat,
+		},
+		"bytes/from_str": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "string", Type: object.OBJ_TYPE_STRING},
+				{Name: "encoding", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_BYTES,
+			Body:       cmdBytesFromStr,
+		},
+		"bytes/to_str": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+				{Name: "encoding", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_STRING,
+			Body:       cmdBytesToStr,
+		},
+		"bytes/from_list": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "list", Type: object.OBJ_TYPE_LIST},
+			},
+			ReturnType: object.OBJ_TYPE_BYTES,
+			Body:       cmdBytesFromList,
+		},
+		"bytes/to_list": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+			},
+			ReturnType: object.OBJ_TYPE_LIST,
+			Body:       cmdBytesToList,
+		},
+		"bytes/read_int": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+				{Name: "offset", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "size", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "endian", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdBytesReadInt,
+		},
+		"bytes/read_uint": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+				{Name: "offset", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "size", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "endian", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdBytesReadUint,
+		},
+		"bytes/write_int": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "bytes", Type: object.OBJ_TYPE_BYTES},
+				{Name: "offset", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "size", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "endian", Type: object.OBJ_TYPE_STRING},
+				{Name: "value", Type: object.OBJ_TYPE_INTEGER},
+			},
+			ReturnType: object.OBJ_TYPE_BYTES,
+			Body:       cmdBytesWriteInt,
+		},
+	}
+}
+
+func bytesError(message string) object.Obj {
+	return object.Obj{
+		Type: object.OBJ_TYPE_ERROR,
+		D: object.Error{
+			Message: message,
+		},
+	}
+}
+
+func bytesObj(data []byte) object.Obj {
+	return object.Obj{Type: object.OBJ_TYPE_BYTES, D: object.Bytes(data)}
+}
+
+func cmdBytesNew(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	length := int(args[0].D.(object.Integer))
+	fill := args[1].D.(object.Integer)
+	if length < 0 {
+		return bytesError("bytes/new: length must be non-negative"), nil
+	}
+	if fill < 0 || fill > 255 {
+		return bytesError("bytes/new: fill must be 0 to 255, got " + strconv.FormatInt(int64(fill), 10)), nil
+	}
+	data := make([]byte, length)
+	if fill != 0 {
+		for i := range data {
+			data[i] = byte(fill)
+		}
+	}
+	return bytesObj(data), nil
+}
+
+func cmdBytesLen(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(len(args[0].D.(object.Bytes)))}, nil
+}
+
+func cmdBytesGet(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data := args[0].D.(object.Bytes)
+	index := int(args[1].D.(object.Integer))
+	if index < 0 || index >= len(data) {
+		return bytesError("bytes/get: index out of bounds: " + strconv.Itoa(index)), nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(data[index])}, nil
+}
+
+func cmdBytesSet(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data := args[0].D.(object.Bytes)
+	index := int(args[1].D.(object.Integer))
+	value := args[2].D.(object.Integer)
+	if index < 0 || index >= len(data) {
+		return bytesError("bytes/set: index out of bounds: " + strconv.Itoa(index)), nil
+	}
+	if value < 0 || value > 255 {
+		return bytesError("bytes/set: value must be 0 to 255, got " + strconv.FormatInt(int64(value), 10)), nil
+	}
+	result := slices.Clone(data)
+	result[index] = byte(value)
+	return bytesObj(result), nil
+}
+
+func cmdBytesSlice(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data := args[0].D.(object.Bytes)
+	start := int(args[1].D.(object.Integer))
+	end := int(args[2].D.(object.Integer))
+
+	start = max(0, min(start, len(data)))
+	end = max(start, min(end, len(data)))
+
+	return bytesObj(slices.Clone(data[start:end])), nil
+}
+
+func cmdBytesConcat(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	var result []byte
+	for _, arg := range args {
+		result = append(result, arg.D.(object.Bytes)...)
+	}
+	if result == nil {
+		result = []byte{}
+	}
+	return bytesObj(result), nil
+}
+
+func cmdBytesFromStr(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	str := args[0].D.(string)
+	switch encoding := args[1].D.(string); encoding {
+	case "utf8":
+		return bytesObj([]byte(str)), nil
+	case "hex":
+		data, err := hex.DecodeString(str)
+		if err != nil {
+			return bytesError("bytes/from_str: invalid hex: " + err.Error()), nil
+		}
+		return bytesObj(data), nil
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return bytesError("bytes/from_str: invalid base64: " + err.Error()), nil
+		}
+		return bytesObj(data), nil
+	default:
+		return bytesError("bytes/from_str: unknown encoding " + strconv.Quote(encoding) + " (expected utf8, hex, or base64)"), nil
+	}
+}
+
+func cmdBytesToStr(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data := args[0].D.(object.Bytes)
+	var str string
+	switch encoding := args[1].D.(string); encoding {
+	case "utf8":
+		if !utf8.Valid(data) {
+			return bytesError("bytes/to_str: bytes are not valid utf8"), nil
+		}
+		str = string(data)
+	case "hex":
+		str = hex.EncodeToString(data)
+	case "base64":
+		str = base64.StdEncoding.EncodeToString(data)
+	default:
+		return bytesError("bytes/to_str: unknown encoding " + strconv.Quote(encoding) + " (expected utf8, hex, or base64)"), nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_STRING, D: str}, nil
+}
+
+func cmdBytesFromList(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	items := args[0].D.(object.List)
+	data := make([]byte, len(items))
+	for i, item := range items {
+		if item.Type != object.OBJ_TYPE_INTEGER || item.D.(object.Integer) < 0 || item.D.(object.Integer) > 255 {
+			return bytesError("bytes/from_list: element " + strconv.Itoa(i) + " is not an integer from 0 to 255: " + item.Encode()), nil
+		}
+		data[i] = byte(item.D.(object.Integer))
+	}
+	return bytesObj(data), nil
+}
+
+func cmdBytesToList(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data := args[0].D.(object.Bytes)
+	items := make(object.List, len(data))
+	for i, b := range data {
+		items[i] = object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(b)}
+	}
+	return object.Obj{Type: object.OBJ_TYPE_LIST, D: items}, nil
+}
+
+// integerField checks the offset, size, and endian arguments shared by the
+// integer readers and writers, returning the byte order to use
+func integerField(name string, data []byte, offset int, size int, endian string) (binary.ByteOrder, *object.Obj) {
+	var order binary.ByteOrder
+	switch endian {
+	case "big":
+		order = binary.BigEndian
+	case "little":
+		order = binary.LittleEndian
+	default:
+		errObj := bytesError(name + ": endian must be \"big\" or \"little\", got " + strconv.Quote(endian))
+		return nil, &errObj
+	}
+	switch size {
+	case 1, 2, 4, 8:
+	default:
+		errObj := bytesError(name + ": size must be 1, 2, 4, or 8, got " + strconv.Itoa(size))
+		return nil, &errObj
+	}
+	if offset < 0 || offset+size > len(data) {
+		errObj := bytesError(name + ": " + strconv.Itoa(size) + " bytes at offset " + strconv.Itoa(offset) + " are out of bounds")
+		return nil, &errObj
+	}
+	return order, nil
+}
+
+func readUint(order binary.ByteOrder, field []byte) uint64 {
+	switch len(field) {
+	case 1:
+		return uint64(field[0])
+	case 2:
+		return uint64(order.Uint16(field))
+	case 4:
+		return uint64(order.Uint32(field))
+	default:
+		return order.Uint64(field)
+	}
+}
+
+func cmdBytesReadInt(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data := args[0].D.(object.Bytes)
+	offset := int(args[1].D.(object.Integer))
+	size := int(args[2].D.(object.Integer))
+	order, errObj := integerField("bytes/read_int", data, offset, size, args[3].D.(string))
+	if errObj != nil {
+		return *errObj, nil
+	}
+
+	// sign-extend from the top bit of the field
+	value := readUint(order, data[offset:offset+size])
+	shift := 64 - 8*size
+	signed := int64(value<<shift) >> shift
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(signed)}, nil
+}
+
+func cmdBytesReadUint(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data := args[0].D.(object.Bytes)
+	offset := int(args[1].D.(object.Integer))
+	size := int(args[2].D.(object.Integer))
+	order, errObj := integerField("bytes/read_uint", data, offset, size, args[3].D.(string))
+	if errObj != nil {
+		return *errObj, nil
+	}
+
+	value := readUint(order, data[offset:offset+size])
+	if value > math.MaxInt64 {
+		return bytesError("bytes/read_uint: " + strconv.FormatUint(value, 10) + " does not fit in an integer"), nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(value)}, nil
+}
+
+func cmdBytesWriteInt(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data := args[0].D.(object.Bytes)
+	offset := int(args[1].D.(object.Integer))
+	size := int(args[2].D.(object.Integer))
+	value := int64(args[4].D.(object.Integer))
+	order, errObj := integerField("bytes/write_int", data, offset, size, args[3].D.(string))
+	if errObj != nil {
+		return *errObj, nil
+	}
+
+	// the value may be given signed or unsigned, so a 1 byte field takes
+	// anything from -128 to 255
+	if size < 8 {
+		bits := uint(8 * size)
+		if value < -(1<<(bits-1)) || value > (1<<bits)-1 {
+			return bytesError("bytes/write_int: " + strconv.FormatInt(value, 10) + " does not fit in " + strconv.Itoa(size) + " bytes"), nil
+		}
+	}
+
+	result := slices.Clone(data)
+	field := result[offset : offset+size]
+	switch size {
+	case 1:
+		field[0] = byte(value)
+	case 2:
+		order.PutUint16(field, uint16(value))
+	case 4:
+		order.PutUint32(field, uint32(value))
+	default:
+		order.PutUint64(field, uint64(value))
+	}
+	return bytesObj(result), nil
+}
@@ -0,0 +1,178 @@
+package errors
+
+import (
+	"github.com/bosley/slpx/pkg/slp/env"
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+type errorFunctions struct{}
+
+func NewErrorFunctions() env.FunctionGroup {
+	return &errorFunctions{}
+}
+
+func (e *errorFunctions) Name() string {
+	return "error"
+}
+
+// The accessors evaluate their own argument: an error that turns up as an
+// evaluated argument is raised before the function is ever called, so they
+// take the expression and look at the error it produces
+func (e *errorFunctions) Functions() map[object.Identifier]env.EnvFunction {
+	return map[object.Identifier]env.EnvFunction{
+		"error/message": {
+			EvaluateArgs: false,
+			Parameters: []env.EnvParameter{
+				{Name: "error", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_STRING,
+			Body:       cmdErrorMessage,
+		},
+		"error/code": {
+			EvaluateArgs: false,
+			Parameters: []env.EnvParameter{
+				{Name: "error", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_STRING,
+			Body:       cmdErrorCode,
+		},
+		"error/data": {
+			EvaluateArgs: false,
+			Parameters: []env.EnvParameter{
+				{Name: "error", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_ANY,
+			Body:       cmdErrorData,
+		},
+		"error/cause": {
+			EvaluateArgs: false,
+			Parameters: []env.EnvParameter{
+				{Name: "error", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_ANY,
+			Body:       cmdErrorCause,
+		},
+		"error/new": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "code", Type: object.OBJ_TYPE_STRING},
+				{Name: "message", Type: object.OBJ_TYPE_STRING},
+				{Name: "data", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_ERROR,
+			Body:       cmdErrorNew,
+		},
+		"error/wrap": {
+			EvaluateArgs: false,
+			Parameters: []env.EnvParameter{
+				{Name: "cause", Type: object.OBJ_TYPE_ANY},
+				{Name: "code", Type: object.OBJ_TYPE_ANY},
+				{Name: "message", Type: object.OBJ_TYPE_ANY},
+				{Name: "data", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_ERROR,
+			Body:       cmdErrorWrap,
+		},
+	}
+}
+
+func errorError(message string) object.Obj {
+	return object.Obj{
+		Type: object.OBJ_TYPE_ERROR,
+		D: object.Error{
+			Message: message,
+		},
+	}
+}
+
+// subject evaluates expr, which must produce an error. ok is false when it
+// didn't, and result is then what the function should return
+func subject(ctx env.EvaluationContext, name string, expr object.Obj) (errData object.Error, result object.Obj, ok bool, err error) {
+	value, err := ctx.Evaluate(expr)
+	if err != nil {
+		return object.Error{}, object.Obj{}, false, err
+	}
+	if value.Type != object.OBJ_TYPE_ERROR {
+		return object.Error{}, errorError(name + ": expected an error, got " + string(value.Type)), false, nil
+	}
+	return value.D.(object.Error), object.Obj{}, true, nil
+}
+
+func cmdErrorMessage(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	errData, result, ok, err := subject(ctx, "error/message", args[0])
+	if !ok {
+		return result, err
+	}
+	return object.Obj{Type: object.OBJ_TYPE_STRING, D: errData.Message}, nil
+}
+
+func cmdErrorCode(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	errData, result, ok, err := subject(ctx, "error/code", args[0])
+	if !ok {
+		return result, err
+	}
+	return object.Obj{Type: object.OBJ_TYPE_STRING, D: errData.Code}, nil
+}
+
+func cmdErrorData(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	errData, result, ok, err := subject(ctx, "error/data", args[0])
+	if !ok {
+		return result, err
+	}
+	if errData.Data == nil {
+		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+	}
+	return *errData.Data, nil
+}
+
+func cmdErrorCause(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	errData, result, ok, err := subject(ctx, "error/cause", args[0])
+	if !ok {
+		return result, err
+	}
+	if errData.Cause == nil {
+		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_ERROR, D: *errData.Cause, Pos: errData.Cause.Position}, nil
+}
+
+func newError(code, message string, data object.Obj) object.Error {
+	errData := object.Error{Code: code, Message: message}
+	if data.Type != object.OBJ_TYPE_NONE {
+		errData.Data = &data
+	}
+	return errData
+}
+
+func cmdErrorNew(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	errData := newError(args[0].D.(string), args[1].D.(string), args[2])
+	return object.Obj{Type: object.OBJ_TYPE_ERROR, D: errData}, nil
+}
+
+func cmdErrorWrap(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	cause, result, ok, err := subject(ctx, "error/wrap", args[0])
+	if !ok {
+		return result, err
+	}
+
+	values := make(object.List, 3)
+	for i, arg := range args[1:] {
+		value, err := ctx.Evaluate(arg)
+		if err != nil {
+			return object.Obj{}, err
+		}
+		if value.Type == object.OBJ_TYPE_ERROR {
+			return value, nil
+		}
+		values[i] = value
+	}
+	for i, name := range []string{"code", "message"} {
+		if values[i].Type != object.OBJ_TYPE_STRING {
+			return errorError("error/wrap: " + name + " must be a string, got " + string(values[i].Type)), nil
+		}
+	}
+
+	errData := newError(values[0].D.(string), values[1].D.(string), values[2])
+	errData.Cause = &cause
+	return object.Obj{Type: object.OBJ_TYPE_ERROR, D: errData}, nil
+}
@@ -80,6 +80,32 @@ func (f *fsFunctions) Functions() map[object.Identifier]env.EnvFunction {
 			ReturnType: object.OBJ_TYPE_INTEGER,
 			Body:       f.cmdAppendFile,
 		},
+		"fs/read_bytes": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "path", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_BYTES,
+			Body:       f.cmdReadBytes,
+		},
+		"fs/write_bytes": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "path", Type: object.OBJ_TYPE_STRING},
+				{Name: "data", Type: object.OBJ_TYPE_BYTES},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       f.cmdWriteBytes,
+		},
+		"fs/append_bytes": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "path", Type: object.OBJ_TYPE_STRING},
+				{Name: "data", Type: object.OBJ_TYPE_BYTES},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       f.cmdAppendBytes,
+		},
 		"fs/rm_file": {
 			EvaluateArgs: true,
 			Parameters: []env.EnvParameter{
@@ -176,8 +202,7 @@ func (f *fsFunctions) cmdReadFile(ctx env.EvaluationContext, args object.List) (
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to read file: " + err.Error(),
+				Message: "failed to read file: " + err.Error(),
 			},
 		}, nil
 	}
@@ -192,8 +217,7 @@ func (f *fsFunctions) cmdWriteFile(ctx env.EvaluationContext, args object.List)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to write file: " + err.Error(),
+				Message: "failed to write file: " + err.Error(),
 			},
 		}, nil
 	}
@@ -208,8 +232,51 @@ func (f *fsFunctions) cmdAppendFile(ctx env.EvaluationContext, args object.List)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to append to file: " + err.Error(),
+				Message: "failed to append to file: " + err.Error(),
+			},
+		}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+}
+
+func (f *fsFunctions) cmdReadBytes(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	path := args[0].D.(string)
+	data, err := f.fs.ReadFile(path)
+	if err != nil {
+		return object.Obj{
+			Type: object.OBJ_TYPE_ERROR,
+			D: object.Error{
+				Message: "failed to read file: " + err.Error(),
+			},
+		}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_BYTES, D: object.Bytes(data)}, nil
+}
+
+func (f *fsFunctions) cmdWriteBytes(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	path := args[0].D.(string)
+	data := args[1].D.(object.Bytes)
+	err := f.fs.WriteFile(path, data, 0644)
+	if err != nil {
+		return object.Obj{
+			Type: object.OBJ_TYPE_ERROR,
+			D: object.Error{
+				Message: "failed to write file: " + err.Error(),
+			},
+		}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+}
+
+func (f *fsFunctions) cmdAppendBytes(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	path := args[0].D.(string)
+	data := args[1].D.(object.Bytes)
+	err := f.fs.AppendFile(path, data)
+	if err != nil {
+		return object.Obj{
+			Type: object.OBJ_TYPE_ERROR,
+			D: object.Error{
+				Message: "failed to append to file: " + err.Error(),
 			},
 		}, nil
 	}
@@ -223,8 +290,7 @@ func (f *fsFunctions) cmdRemoveFile(ctx env.EvaluationContext, args object.List)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to remove file: " + err.Error(),
+				Message: "failed to remove file: " + err.Error(),
 			},
 		}, nil
 	}
@@ -238,8 +304,7 @@ func (f *fsFunctions) cmdRemoveDir(ctx env.EvaluationContext, args object.List)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to remove directory: " + err.Error(),
+				Message: "failed to remove directory: " + err.Error(),
 			},
 		}, nil
 	}
@@ -253,8 +318,7 @@ func (f *fsFunctions) cmdRemoveDirAll(ctx env.EvaluationContext, args object.Lis
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to remove directory tree: " + err.Error(),
+				Message: "failed to remove directory tree: " + err.Error(),
 			},
 		}, nil
 	}
@@ -268,8 +332,7 @@ func (f *fsFunctions) cmdMkDir(ctx env.EvaluationContext, args object.List) (obj
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to create directory: " + err.Error(),
+				Message: "failed to create directory: " + err.Error(),
 			},
 		}, nil
 	}
@@ -283,8 +346,7 @@ func (f *fsFunctions) cmdMkDirAll(ctx env.EvaluationContext, args object.List) (
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to create directory tree: " + err.Error(),
+				Message: "failed to create directory tree: " + err.Error(),
 			},
 		}, nil
 	}
@@ -298,8 +360,7 @@ func (f *fsFunctions) cmdListDir(ctx env.EvaluationContext, args object.List) (o
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to list directory: " + err.Error(),
+				Message: "failed to list directory: " + err.Error(),
 			},
 		}, nil
 	}
@@ -321,8 +382,7 @@ func (f *fsFunctions) cmdSetWorkingDir(ctx env.EvaluationContext, args object.Li
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to set working directory: " + err.Error(),
+				Message: "failed to set working directory: " + err.Error(),
 			},
 		}, nil
 	}
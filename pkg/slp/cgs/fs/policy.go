@@ -0,0 +1,58 @@
+package fs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bosley/slpx/pkg/slp/env"
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+// writers are the functions that change the filesystem. Each takes the path
+// it changes as its first argument
+var writers = []object.Identifier{
+	"fs/write_file",
+	"fs/append_file",
+	"fs/write_bytes",
+	"fs/append_bytes",
+	"fs/rm_file",
+	"fs/rm_dir",
+	"fs/rm_dir_all",
+	"fs/mk_dir",
+	"fs/mk_dir_all",
+}
+
+// ReadOnly denies every function that changes the filesystem
+func ReadOnly() []env.Rule {
+	rules := make([]env.Rule, 0, len(writers))
+	for _, name := range writers {
+		rules = append(rules, env.DenyFunction(name))
+	}
+	return rules
+}
+
+// WritesUnder only lets the filesystem be changed beneath root. Relative
+// paths are taken from the session's working directory, as the functions
+// themselves take them. The check is on the path as written: a symlink under
+// root that leads elsewhere is not followed
+func WritesUnder(root string) []env.Rule {
+	root = filepath.Clean(root)
+	guard := func(runtime env.Runtime, args object.List) error {
+		path := args[0].D.(string)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(runtime.GetFS().WorkingDir(), path)
+		}
+		rel, err := filepath.Rel(root, filepath.Clean(path))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s is outside of %s", path, root)
+		}
+		return nil
+	}
+
+	rules := make([]env.Rule, 0, len(writers))
+	for _, name := range writers {
+		rules = append(rules, env.Rule{Function: name, Guard: guard})
+	}
+	return rules
+}
@@ -168,8 +168,7 @@ func cmdEnvGet(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/env/get: environment variable not found: " + name,
+				Message: "host/env/get: environment variable not found: " + name,
 			},
 		}, nil
 	}
@@ -184,8 +183,7 @@ func cmdEnvSet(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/env/set: failed to set environment variable: " + err.Error(),
+				Message: "host/env/set: failed to set environment variable: " + err.Error(),
 			},
 		}, nil
 	}
@@ -198,8 +196,7 @@ func cmdDirHome(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/dir/home: failed to get home directory: " + err.Error(),
+				Message: "host/dir/home: failed to get home directory: " + err.Error(),
 			},
 		}, nil
 	}
@@ -212,8 +209,7 @@ func cmdDirConfig(ctx env.EvaluationContext, args object.List) (object.Obj, erro
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/dir/config: failed to get config directory: " + err.Error(),
+				Message: "host/dir/config: failed to get config directory: " + err.Error(),
 			},
 		}, nil
 	}
@@ -231,8 +227,7 @@ func cmdDirCache(ctx env.EvaluationContext, args object.List) (object.Obj, error
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/dir/cache: failed to get cache directory: " + err.Error(),
+				Message: "host/dir/cache: failed to get cache directory: " + err.Error(),
 			},
 		}, nil
 	}
@@ -249,8 +244,7 @@ func cmdHwMemTotal(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/mem/total: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/mem/total: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -263,8 +257,7 @@ func cmdHwMemAvailable(ctx env.EvaluationContext, args object.List) (object.Obj,
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/mem/available: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/mem/available: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -277,8 +270,7 @@ func cmdHwMemUsed(ctx env.EvaluationContext, args object.List) (object.Obj, erro
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/mem/used: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/mem/used: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -291,8 +283,7 @@ func cmdHwMemPercent(ctx env.EvaluationContext, args object.List) (object.Obj, e
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/mem/percent: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/mem/percent: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -305,8 +296,7 @@ func cmdHwDiskTotal(ctx env.EvaluationContext, args object.List) (object.Obj, er
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/disk/total: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/disk/total: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -319,8 +309,7 @@ func cmdHwDiskUsed(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/disk/used: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/disk/used: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -333,8 +322,7 @@ func cmdHwDiskPercent(ctx env.EvaluationContext, args object.List) (object.Obj,
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/disk/percent: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/disk/percent: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -347,8 +335,7 @@ func cmdHwCpuPercent(ctx env.EvaluationContext, args object.List) (object.Obj, e
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/percent: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/cpu/percent: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -356,8 +343,7 @@ func cmdHwCpuPercent(ctx env.EvaluationContext, args object.List) (object.Obj, e
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/percent: no CPU information available",
+				Message: "host/hw/cpu/percent: no CPU information available",
 			},
 		}, nil
 	}
@@ -370,8 +356,7 @@ func cmdHwCpuCount(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/count: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/cpu/count: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -385,8 +370,7 @@ func cmdHwCpuPercentAt(ctx env.EvaluationContext, args object.List) (object.Obj,
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/percent/at: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/cpu/percent/at: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -394,8 +378,7 @@ func cmdHwCpuPercentAt(ctx env.EvaluationContext, args object.List) (object.Obj,
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/percent/at: index out of range",
+				Message: "host/hw/cpu/percent/at: index out of range",
 			},
 		}, nil
 	}
@@ -409,8 +392,7 @@ func cmdHwCpuModelAt(ctx env.EvaluationContext, args object.List) (object.Obj, e
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/model/at: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/cpu/model/at: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -418,8 +400,7 @@ func cmdHwCpuModelAt(ctx env.EvaluationContext, args object.List) (object.Obj, e
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/model/at: index out of range",
+				Message: "host/hw/cpu/model/at: index out of range",
 			},
 		}, nil
 	}
@@ -433,8 +414,7 @@ func cmdHwCpuMhzAt(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/mhz/at: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/cpu/mhz/at: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -442,8 +422,7 @@ func cmdHwCpuMhzAt(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/mhz/at: index out of range",
+				Message: "host/hw/cpu/mhz/at: index out of range",
 			},
 		}, nil
 	}
@@ -457,8 +436,7 @@ func cmdHwCpuCacheAt(ctx env.EvaluationContext, args object.List) (object.Obj, e
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/cache/at: failed to get hardware profile: " + err.Error(),
+				Message: "host/hw/cpu/cache/at: failed to get hardware profile: " + err.Error(),
 			},
 		}, nil
 	}
@@ -466,8 +444,7 @@ func cmdHwCpuCacheAt(ctx env.EvaluationContext, args object.List) (object.Obj, e
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "host/hw/cpu/cache/at: index out of range",
+				Message: "host/hw/cpu/cache/at: index out of range",
 			},
 		}, nil
 	}
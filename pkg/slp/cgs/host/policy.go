@@ -0,0 +1,32 @@
+package host
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bosley/slpx/pkg/slp/env"
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+// NoEnvMutation denies setting environment variables. Reading them is still
+// allowed
+func NoEnvMutation() []env.Rule {
+	return []env.Rule{env.DenyFunction("host/env/set")}
+}
+
+// NoHardware denies every host/hw/ query
+func NoHardware() []env.Rule {
+	var names []object.Identifier
+	for name := range (&hostFunctions{}).Functions() {
+		if strings.HasPrefix(string(name), "host/hw/") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	rules := make([]env.Rule, 0, len(names))
+	for _, name := range names {
+		rules = append(rules, env.DenyFunction(name))
+	}
+	return rules
+}
@@ -85,6 +85,20 @@ func (i *ioFunctions) Functions() map[object.Identifier]env.EnvFunction {
 			ReturnType: object.OBJ_TYPE_REAL,
 			Body:       i.cmdInReal,
 		},
+		"io/in/bytes": {
+			EvaluateArgs: true,
+			Parameters:   []env.EnvParameter{},
+			ReturnType:   object.OBJ_TYPE_BYTES,
+			Body:         i.cmdInBytes,
+		},
+		"io/out/bytes": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "data", Type: object.OBJ_TYPE_BYTES},
+			},
+			ReturnType: object.OBJ_TYPE_NONE,
+			Body:       i.cmdOutBytes,
+		},
 		"io/out/set_precision": {
 			EvaluateArgs: true,
 			Parameters: []env.EnvParameter{
@@ -129,8 +143,7 @@ func (i *ioFunctions) cmdColorFg(ctx env.EvaluationContext, args object.List) (o
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "invalid hex color: " + err.Error(),
+				Message: "invalid hex color: " + err.Error(),
 			},
 		}, nil
 	}
@@ -145,8 +158,7 @@ func (i *ioFunctions) cmdColorBg(ctx env.EvaluationContext, args object.List) (o
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "invalid hex color: " + err.Error(),
+				Message: "invalid hex color: " + err.Error(),
 			},
 		}, nil
 	}
@@ -168,8 +180,7 @@ func (i *ioFunctions) cmdIn(ctx env.EvaluationContext, args object.List) (object
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to read input: " + err.Error(),
+				Message: "failed to read input: " + err.Error(),
 			},
 		}, nil
 	}
@@ -187,8 +198,7 @@ func (i *ioFunctions) cmdInInt(ctx env.EvaluationContext, args object.List) (obj
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to read input: " + err.Error(),
+				Message: "failed to read input: " + err.Error(),
 			},
 		}, nil
 	}
@@ -199,8 +209,7 @@ func (i *ioFunctions) cmdInInt(ctx env.EvaluationContext, args object.List) (obj
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "input is not a valid integer: " + line,
+				Message: "input is not a valid integer: " + line,
 			},
 		}, nil
 	}
@@ -218,8 +227,7 @@ func (i *ioFunctions) cmdInReal(ctx env.EvaluationContext, args object.List) (ob
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to read input: " + err.Error(),
+				Message: "failed to read input: " + err.Error(),
 			},
 		}, nil
 	}
@@ -230,8 +238,7 @@ func (i *ioFunctions) cmdInReal(ctx env.EvaluationContext, args object.List) (ob
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "input is not a valid real number: " + line,
+				Message: "input is not a valid real number: " + line,
 			},
 		}, nil
 	}
@@ -239,6 +246,33 @@ func (i *ioFunctions) cmdInReal(ctx env.EvaluationContext, args object.List) (ob
 	return object.Obj{Type: object.OBJ_TYPE_REAL, D: object.Real(realVal)}, nil
 }
 
+// cmdInBytes reads everything left on stdin, unchanged
+func (i *ioFunctions) cmdInBytes(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	data, err := i.io.ReadAll()
+	if err != nil {
+		return object.Obj{
+			Type: object.OBJ_TYPE_ERROR,
+			D: object.Error{
+				Message: "failed to read input: " + err.Error(),
+			},
+		}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_BYTES, D: object.Bytes(data)}, nil
+}
+
+func (i *ioFunctions) cmdOutBytes(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	if _, err := i.io.Write(args[0].D.(object.Bytes)); err != nil {
+		return object.Obj{
+			Type: object.OBJ_TYPE_ERROR,
+			D: object.Error{
+				Message: "failed to write output: " + err.Error(),
+			},
+		}, nil
+	}
+	i.io.Flush()
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+}
+
 func (i *ioFunctions) cmdSetPrecision(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	precision := int(args[0].D.(object.Integer))
 	if precision < 0 {
@@ -256,8 +290,7 @@ func (i *ioFunctions) cmdFlush(ctx env.EvaluationContext, args object.List) (obj
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "failed to flush output: " + err.Error(),
+				Message: "failed to flush output: " + err.Error(),
 			},
 		}, nil
 	}
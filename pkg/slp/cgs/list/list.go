@@ -221,8 +221,7 @@ func cmdListNew(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/new: length must be non-negative",
+				Message: "list/new: length must be non-negative",
 			},
 		}, nil
 	}
@@ -249,8 +248,7 @@ func cmdListGet(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/get: index out of bounds: " + strconv.Itoa(index),
+				Message: "list/get: index out of bounds: " + strconv.Itoa(index),
 			},
 		}, nil
 	}
@@ -267,8 +265,7 @@ func cmdListSet(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/set: index out of bounds: " + strconv.Itoa(index),
+				Message: "list/set: index out of bounds: " + strconv.Itoa(index),
 			},
 		}, nil
 	}
@@ -292,8 +289,7 @@ func cmdListPop(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/pop: cannot pop from empty list",
+				Message: "list/pop: cannot pop from empty list",
 			},
 		}, nil
 	}
@@ -325,8 +321,7 @@ func cmdListSubset(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/subset: start index out of bounds: " + strconv.Itoa(start),
+				Message: "list/subset: start index out of bounds: " + strconv.Itoa(start),
 			},
 		}, nil
 	}
@@ -335,8 +330,7 @@ func cmdListSubset(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/subset: end index out of bounds: " + strconv.Itoa(end),
+				Message: "list/subset: end index out of bounds: " + strconv.Itoa(end),
 			},
 		}, nil
 	}
@@ -345,8 +339,7 @@ func cmdListSubset(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/subset: start index must be <= end index",
+				Message: "list/subset: start index must be <= end index",
 			},
 		}, nil
 	}
@@ -372,8 +365,7 @@ func cmdListIter(ctx env.EvaluationContext, args object.List) (object.Obj, error
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/iter: first argument must be a list, got " + string(listObj.Type),
+				Message: "list/iter: first argument must be a list, got " + string(listObj.Type),
 			},
 		}, nil
 	}
@@ -389,6 +381,9 @@ func cmdListIter(ctx env.EvaluationContext, args object.List) (object.Obj, error
 	list := listObj.D.(object.List)
 
 	for _, element := range list {
+		if err := env.CheckCancelled(ctx); err != nil {
+			return object.Obj{}, err
+		}
 		callList := object.List{callbackObj, element}
 		result, err := ctx.Execute(callList)
 		if err != nil {
@@ -402,8 +397,7 @@ func cmdListIter(ctx env.EvaluationContext, args object.List) (object.Obj, error
 			return object.Obj{
 				Type: object.OBJ_TYPE_ERROR,
 				D: object.Error{
-					Position: 0,
-					Message:  "list/iter: callback must return integer (1 to continue, 0 to stop)",
+					Message: "list/iter: callback must return integer (1 to continue, 0 to stop)",
 				},
 			}, nil
 		}
@@ -456,8 +450,7 @@ func cmdListConcat(ctx env.EvaluationContext, args object.List) (object.Obj, err
 			return object.Obj{
 				Type: object.OBJ_TYPE_ERROR,
 				D: object.Error{
-					Position: 0,
-					Message:  "list/concat: all arguments must be lists, got " + string(arg.Type) + " at position " + strconv.Itoa(i),
+					Message: "list/concat: all arguments must be lists, got " + string(arg.Type) + " at position " + strconv.Itoa(i),
 				},
 			}, nil
 		}
@@ -490,8 +483,7 @@ func cmdListFirst(ctx env.EvaluationContext, args object.List) (object.Obj, erro
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/first: cannot get first element of empty list",
+				Message: "list/first: cannot get first element of empty list",
 			},
 		}, nil
 	}
@@ -506,8 +498,7 @@ func cmdListLast(ctx env.EvaluationContext, args object.List) (object.Obj, error
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/last: cannot get last element of empty list",
+				Message: "list/last: cannot get last element of empty list",
 			},
 		}, nil
 	}
@@ -584,8 +575,7 @@ func cmdListMap(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/map: first argument must be a list, got " + string(listObj.Type),
+				Message: "list/map: first argument must be a list, got " + string(listObj.Type),
 			},
 		}, nil
 	}
@@ -602,6 +592,9 @@ func cmdListMap(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 	result := make(object.List, len(list))
 
 	for i, element := range list {
+		if err := env.CheckCancelled(ctx); err != nil {
+			return object.Obj{}, err
+		}
 		callList := object.List{mapperObj, element}
 		mapped, err := ctx.Execute(callList)
 		if err != nil {
@@ -629,8 +622,7 @@ func cmdListFilter(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/filter: first argument must be a list, got " + string(listObj.Type),
+				Message: "list/filter: first argument must be a list, got " + string(listObj.Type),
 			},
 		}, nil
 	}
@@ -647,6 +639,9 @@ func cmdListFilter(ctx env.EvaluationContext, args object.List) (object.Obj, err
 	result := make(object.List, 0, len(list))
 
 	for _, element := range list {
+		if err := env.CheckCancelled(ctx); err != nil {
+			return object.Obj{}, err
+		}
 		callList := object.List{predicateObj, element}
 		testResult, err := ctx.Execute(callList)
 		if err != nil {
@@ -660,8 +655,7 @@ func cmdListFilter(ctx env.EvaluationContext, args object.List) (object.Obj, err
 			return object.Obj{
 				Type: object.OBJ_TYPE_ERROR,
 				D: object.Error{
-					Position: 0,
-					Message:  "list/filter: predicate must return integer (1 to include, 0 to exclude)",
+					Message: "list/filter: predicate must return integer (1 to include, 0 to exclude)",
 				},
 			}, nil
 		}
@@ -688,8 +682,7 @@ func cmdListReduce(ctx env.EvaluationContext, args object.List) (object.Obj, err
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "list/reduce: first argument must be a list, got " + string(listObj.Type),
+				Message: "list/reduce: first argument must be a list, got " + string(listObj.Type),
 			},
 		}, nil
 	}
@@ -714,6 +707,9 @@ func cmdListReduce(ctx env.EvaluationContext, args object.List) (object.Obj, err
 	accumulator := initialObj
 
 	for _, element := range list {
+		if err := env.CheckCancelled(ctx); err != nil {
+			return object.Obj{}, err
+		}
 		callList := object.List{reducerObj, accumulator, element}
 		result, err := ctx.Execute(callList)
 		if err != nil {
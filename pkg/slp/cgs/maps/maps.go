@@ -0,0 +1,236 @@
+package maps
+
+import (
+	"github.com/bosley/slpx/pkg/slp/env"
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+type mapFunctions struct{}
+
+func NewMapFunctions() env.FunctionGroup {
+	return &mapFunctions{}
+}
+
+func (m *mapFunctions) Name() string {
+	return "map"
+}
+
+func (m *mapFunctions) Functions() map[object.Identifier]env.EnvFunction {
+	return map[object.Identifier]env.EnvFunction{
+		"map/new": {
+			EvaluateArgs: true,
+			Parameters:   []env.EnvParameter{},
+			ReturnType:   object.OBJ_TYPE_MAP,
+			Body:         cmdMapNew,
+		},
+		"map/from": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "pairs", Type: object.OBJ_TYPE_LIST},
+			},
+			ReturnType: object.OBJ_TYPE_MAP,
+			Body:       cmdMapFrom,
+		},
+		"map/len": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "map", Type: object.OBJ_TYPE_MAP},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdMapLen,
+		},
+		"map/get": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "map", Type: object.OBJ_TYPE_MAP},
+				{Name: "key", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_ANY,
+			Body:       cmdMapGet,
+		},
+		"map/set": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "map", Type: object.OBJ_TYPE_MAP},
+				{Name: "key", Type: object.OBJ_TYPE_ANY},
+				{Name: "value", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_MAP,
+			Body:       cmdMapSet,
+		},
+		"map/delete": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "map", Type: object.OBJ_TYPE_MAP},
+				{Name: "key", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_MAP,
+			Body:       cmdMapDelete,
+		},
+		"map/has?": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "map", Type: object.OBJ_TYPE_MAP},
+				{Name: "key", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdMapHas,
+		},
+		"map/keys": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "map", Type: object.OBJ_TYPE_MAP},
+			},
+			ReturnType: object.OBJ_TYPE_LIST,
+			Body:       cmdMapKeys,
+		},
+		"map/values": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "map", Type: object.OBJ_TYPE_MAP},
+			},
+			ReturnType: object.OBJ_TYPE_LIST,
+			Body:       cmdMapValues,
+		},
+		"map/merge": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "maps", Type: object.OBJ_TYPE_MAP},
+			},
+			ReturnType: object.OBJ_TYPE_MAP,
+			Variadic:   true,
+			Body:       cmdMapMerge,
+		},
+		"map/iter": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "map", Type: object.OBJ_TYPE_MAP},
+				{Name: "callback", Type: object.OBJ_TYPE_FUNCTION},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdMapIter,
+		},
+	}
+}
+
+func mapError(message string) object.Obj {
+	return object.Obj{
+		Type: object.OBJ_TYPE_ERROR,
+		D: object.Error{
+			Message: message,
+		},
+	}
+}
+
+func checkKey(name string, key object.Obj) (object.Obj, bool) {
+	if !object.IsMapKey(key) {
+		return mapError(name + ": key must be a string, integer, real, or identifier, got " + string(key.Type)), false
+	}
+	return object.Obj{}, true
+}
+
+func cmdMapNew(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	return object.Obj{Type: object.OBJ_TYPE_MAP, D: object.NewMap()}, nil
+}
+
+func cmdMapFrom(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	result := object.NewMap()
+	for _, pair := range args[0].D.(object.List) {
+		if pair.Type != object.OBJ_TYPE_LIST || len(pair.D.(object.List)) != 2 {
+			return mapError("map/from: expected (key value) pairs, got " + pair.Encode()), nil
+		}
+		key, value := pair.D.(object.List)[0], pair.D.(object.List)[1]
+		if errObj, ok := checkKey("map/from", key); !ok {
+			return errObj, nil
+		}
+		result.Set(key, value)
+	}
+	return object.Obj{Type: object.OBJ_TYPE_MAP, D: result}, nil
+}
+
+func cmdMapLen(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(args[0].D.(*object.Map).Len())}, nil
+}
+
+func cmdMapGet(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	if errObj, ok := checkKey("map/get", args[1]); !ok {
+		return errObj, nil
+	}
+	value, found := args[0].D.(*object.Map).Get(args[1])
+	if !found {
+		return mapError("map/get: key not found: " + args[1].Encode()), nil
+	}
+	return value, nil
+}
+
+func cmdMapSet(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	if errObj, ok := checkKey("map/set", args[1]); !ok {
+		return errObj, nil
+	}
+	entries := args[0].D.(*object.Map)
+	entries.Set(args[1], args[2])
+	return object.Obj{Type: object.OBJ_TYPE_MAP, D: entries}, nil
+}
+
+func cmdMapDelete(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	if errObj, ok := checkKey("map/delete", args[1]); !ok {
+		return errObj, nil
+	}
+	entries := args[0].D.(*object.Map)
+	entries.Delete(args[1])
+	return object.Obj{Type: object.OBJ_TYPE_MAP, D: entries}, nil
+}
+
+func cmdMapHas(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	if args[0].D.(*object.Map).Has(args[1]) {
+		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+}
+
+func cmdMapKeys(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	return object.Obj{Type: object.OBJ_TYPE_LIST, D: args[0].D.(*object.Map).Keys()}, nil
+}
+
+func cmdMapValues(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	return object.Obj{Type: object.OBJ_TYPE_LIST, D: args[0].D.(*object.Map).Values()}, nil
+}
+
+func cmdMapMerge(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	result := object.NewMap()
+	for _, arg := range args {
+		for _, entry := range arg.D.(*object.Map).Entries() {
+			result.Set(entry.Key, entry.Value)
+		}
+	}
+	return object.Obj{Type: object.OBJ_TYPE_MAP, D: result}, nil
+}
+
+func cmdMapIter(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	callback := args[1]
+
+	// iterate over a copy so that a callback changing the map can't change
+	// what is left to visit
+	for _, entry := range args[0].D.(*object.Map).Copy().Entries() {
+		if err := env.CheckCancelled(ctx); err != nil {
+			return object.Obj{}, err
+		}
+		result, err := ctx.Call(callback, object.List{entry.Key, entry.Value})
+		if err != nil {
+			return object.Obj{}, err
+		}
+		if result.Type == object.OBJ_TYPE_ERROR {
+			return result, nil
+		}
+
+		if result.Type != object.OBJ_TYPE_INTEGER {
+			return mapError("map/iter: callback must return integer (1 to continue, 0 to stop)"), nil
+		}
+
+		if result.D.(object.Integer) == 0 {
+			return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+		}
+	}
+
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+}
@@ -1,7 +1,10 @@
 package numbers
 
 import (
+	"cmp"
+	crand "crypto/rand"
 	"math"
+	"math/big"
 	"math/rand/v2"
 	"strconv"
 
@@ -23,66 +26,46 @@ func (a *arithFunctions) Functions() map[object.Identifier]env.EnvFunction {
 	return map[object.Identifier]env.EnvFunction{
 		"int/add": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntAdd,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIntAdd,
 		},
 		"int/sub": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntSub,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIntSub,
 		},
 		"int/mul": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntMul,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIntMul,
 		},
 		"int/div": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntDiv,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIntDiv,
 		},
 		"int/mod": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntMod,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIntMod,
 		},
 		"int/pow": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntPow,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIntPow,
 		},
 		"int/sum": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "values", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Variadic:   true,
-			Body:       cmdIntSum,
+			Parameters:   intParams("values"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Variadic:     true,
+			Body:         cmdIntSum,
 		},
 		"real/add": {
 			EvaluateArgs: true,
@@ -140,64 +123,47 @@ func (a *arithFunctions) Functions() map[object.Identifier]env.EnvFunction {
 		},
 		"int/real": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "value", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_REAL,
-			Body:       cmdIntToReal,
+			Parameters:   intParams("value"),
+			ReturnType:   object.OBJ_TYPE_REAL,
+			Body:         cmdIntToReal,
 		},
 		"real/int": {
 			EvaluateArgs: true,
 			Parameters: []env.EnvParameter{
 				{Name: "value", Type: object.OBJ_TYPE_REAL},
 			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
+			ReturnType: object.OBJ_TYPE_ANY,
 			Body:       cmdRealToInt,
 		},
 		"int/eq": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntEq,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_INTEGER,
+			Body:         cmdIntEq,
 		},
 		"int/gt": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntGt,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_INTEGER,
+			Body:         cmdIntGt,
 		},
 		"int/gte": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntGte,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_INTEGER,
+			Body:         cmdIntGte,
 		},
 		"int/lt": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntLt,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_INTEGER,
+			Body:         cmdIntLt,
 		},
 		"int/lte": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntLte,
+			Parameters:   intParams("a", "b"),
+			ReturnType:   object.OBJ_TYPE_INTEGER,
+			Body:         cmdIntLte,
 		},
 		"real/eq": {
 			EvaluateArgs: true,
@@ -246,12 +212,9 @@ func (a *arithFunctions) Functions() map[object.Identifier]env.EnvFunction {
 		},
 		"int/rand": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "lower", Type: object.OBJ_TYPE_INTEGER},
-				{Name: "upper", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntRand,
+			Parameters:   intParams("lower", "upper"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIntRand,
 		},
 		"real/rand": {
 			EvaluateArgs: true,
@@ -291,7 +254,7 @@ func (a *arithFunctions) Functions() map[object.Identifier]env.EnvFunction {
 			Parameters: []env.EnvParameter{
 				{Name: "value", Type: object.OBJ_TYPE_REAL},
 			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
+			ReturnType: object.OBJ_TYPE_ANY,
 			Body:       cmdRealCeil,
 		},
 		"real/round": {
@@ -299,7 +262,7 @@ func (a *arithFunctions) Functions() map[object.Identifier]env.EnvFunction {
 			Parameters: []env.EnvParameter{
 				{Name: "value", Type: object.OBJ_TYPE_REAL},
 			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
+			ReturnType: object.OBJ_TYPE_ANY,
 			Body:       cmdRealRound,
 		},
 		"real/is-nan": {
@@ -328,11 +291,9 @@ func (a *arithFunctions) Functions() map[object.Identifier]env.EnvFunction {
 		},
 		"int/abs": {
 			EvaluateArgs: true,
-			Parameters: []env.EnvParameter{
-				{Name: "value", Type: object.OBJ_TYPE_INTEGER},
-			},
-			ReturnType: object.OBJ_TYPE_INTEGER,
-			Body:       cmdIntAbs,
+			Parameters:   intParams("value"),
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIntAbs,
 		},
 		"real/abs": {
 			EvaluateArgs: true,
@@ -345,97 +306,245 @@ func (a *arithFunctions) Functions() map[object.Identifier]env.EnvFunction {
 	}
 }
 
+// maxPowBits bounds the size of an int/pow result, so that a small expression
+// can't ask for more memory than the machine has
+const maxPowBits = 1 << 24
+
+// intParams are parameters that take an integer in either representation. They
+// are typed any since a parameter names only one type, and checkIntegers does
+// the checking instead
+func intParams(names ...string) []env.EnvParameter {
+	params := make([]env.EnvParameter, len(names))
+	for i, name := range names {
+		params[i] = env.EnvParameter{Name: name, Type: object.OBJ_TYPE_ANY}
+	}
+	return params
+}
+
+func checkIntegers(name string, args object.List) (object.Obj, bool) {
+	for i, arg := range args {
+		if !object.IsInteger(arg) {
+			return numberError(env.ErrorCodeType, name+": all arguments must be integers, got "+string(arg.Type)+" at position "+strconv.Itoa(i)), false
+		}
+	}
+	return object.Obj{}, true
+}
+
+func numberError(code, message string) object.Obj {
+	return object.Obj{
+		Type: object.OBJ_TYPE_ERROR,
+		D: object.Error{
+			Code:    code,
+			Message: message,
+		},
+	}
+}
+
+func boolObj(b bool) object.Obj {
+	if b {
+		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}
+}
+
+// intOp runs small when both arguments are integers, and large when either is
+// a bigint or small reports that the result overflows
+func intOp(name string, args object.List, small func(a, b int64) (int64, bool), large func(a, b *big.Int) *big.Int) object.Obj {
+	if errObj, ok := checkIntegers(name, args); !ok {
+		return errObj
+	}
+	if args[0].Type == object.OBJ_TYPE_INTEGER && args[1].Type == object.OBJ_TYPE_INTEGER {
+		if result, ok := small(int64(args[0].D.(object.Integer)), int64(args[1].D.(object.Integer))); ok {
+			return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(result)}
+		}
+	}
+	a, _ := object.BigOf(args[0])
+	b, _ := object.BigOf(args[1])
+	return object.IntegerFromBig(large(a, b))
+}
+
+// compareIntegers returns -1, 0, or 1 as a is less than, equal to, or greater than b
+func compareIntegers(a, b object.Obj) int {
+	if a.Type == object.OBJ_TYPE_INTEGER && b.Type == object.OBJ_TYPE_INTEGER {
+		return cmp.Compare(a.D.(object.Integer), b.D.(object.Integer))
+	}
+	x, _ := object.BigOf(a)
+	y, _ := object.BigOf(b)
+	return x.Cmp(y)
+}
+
+// intSign returns -1, 0, or 1 as an integer object is negative, zero, or positive
+func intSign(obj object.Obj) int {
+	if obj.Type == object.OBJ_TYPE_BIGINT {
+		return obj.D.(*big.Int).Sign()
+	}
+	return cmp.Compare(obj.D.(object.Integer), 0)
+}
+
+func addInt(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+func subInt(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) || c/b != a {
+		return 0, false
+	}
+	return c, true
+}
+
 func cmdIntAdd(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: a + b}, nil
+	return intOp("int/add", args, addInt, func(a, b *big.Int) *big.Int {
+		return a.Add(a, b)
+	}), nil
 }
 
 func cmdIntSub(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: a - b}, nil
+	return intOp("int/sub", args, subInt, func(a, b *big.Int) *big.Int {
+		return a.Sub(a, b)
+	}), nil
 }
 
 func cmdIntMul(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: a * b}, nil
+	return intOp("int/mul", args, mulInt, func(a, b *big.Int) *big.Int {
+		return a.Mul(a, b)
+	}), nil
 }
 
 func cmdIntDiv(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	if b == 0 {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "int/div: division by zero",
-			},
-		}, nil
+	if errObj, ok := checkIntegers("int/div", args); !ok {
+		return errObj, nil
+	}
+	if intSign(args[1]) == 0 {
+		return numberError(env.ErrorCodeArith, "int/div: division by zero"), nil
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: a / b}, nil
+	return intOp("int/div", args, func(a, b int64) (int64, bool) {
+		return a / b, !(a == math.MinInt64 && b == -1)
+	}, func(a, b *big.Int) *big.Int {
+		return a.Quo(a, b)
+	}), nil
 }
 
 func cmdIntMod(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	if b == 0 {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "int/mod: modulo by zero",
-			},
-		}, nil
+	if errObj, ok := checkIntegers("int/mod", args); !ok {
+		return errObj, nil
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: a % b}, nil
+	if intSign(args[1]) == 0 {
+		return numberError(env.ErrorCodeArith, "int/mod: modulo by zero"), nil
+	}
+	return intOp("int/mod", args, func(a, b int64) (int64, bool) {
+		return a % b, true
+	}, func(a, b *big.Int) *big.Int {
+		return a.Rem(a, b)
+	}), nil
 }
 
 func cmdIntPow(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	if b < 0 {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "int/pow: negative exponent not supported for integer power",
-			},
-		}, nil
+	if errObj, ok := checkIntegers("int/pow", args); !ok {
+		return errObj, nil
 	}
-	result := object.Integer(1)
-	base := a
-	exp := b
+	if intSign(args[1]) < 0 {
+		return numberError(env.ErrorCodeArith, "int/pow: negative exponent not supported for integer power"), nil
+	}
+
+	base, _ := object.BigOf(args[0])
+	exp, _ := object.BigOf(args[1])
+
+	// a base other than 0, 1, or -1 has at least (bits - 1) * exp bits once
+	// raised, so that is checked before doing any of the work
+	if bits := base.BitLen(); bits > 1 {
+		if !exp.IsInt64() || exp.Int64() > maxPowBits/int64(bits-1) {
+			return numberError(env.ErrorCodeArith, "int/pow: result too large"), nil
+		}
+	}
+
+	if args[0].Type == object.OBJ_TYPE_INTEGER && args[1].Type == object.OBJ_TYPE_INTEGER {
+		if result, ok := powInt(int64(args[0].D.(object.Integer)), int64(args[1].D.(object.Integer))); ok {
+			return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(result)}, nil
+		}
+	}
+	return object.IntegerFromBig(base.Exp(base, exp, nil)), nil
+}
+
+// powInt is exponentiation by squaring, reporting false if the result or any
+// step towards it overflows
+func powInt(base, exp int64) (int64, bool) {
+	result := int64(1)
 	for exp > 0 {
+		var ok bool
 		if exp%2 == 1 {
-			result *= base
+			if result, ok = mulInt(result, base); !ok {
+				return 0, false
+			}
 		}
-		base *= base
 		exp /= 2
+		if exp > 0 {
+			if base, ok = mulInt(base, base); !ok {
+				return 0, false
+			}
+		}
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: result}, nil
+	return result, true
 }
 
 func cmdIntSum(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	if len(args) == 0 {
-		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+	if errObj, ok := checkIntegers("int/sum", args); !ok {
+		return errObj, nil
 	}
-	sum := object.Integer(0)
+	sum := int64(0)
 	for i, arg := range args {
-		if arg.Type != object.OBJ_TYPE_INTEGER {
-			return object.Obj{
-				Type: object.OBJ_TYPE_ERROR,
-				D: object.Error{
-					Position: 0,
-					Message:  "int/sum: all arguments must be integers, got " + string(arg.Type) + " at position " + strconv.Itoa(i),
-				},
-			}, nil
+		if arg.Type == object.OBJ_TYPE_INTEGER {
+			if next, ok := addInt(sum, int64(arg.D.(object.Integer))); ok {
+				sum = next
+				continue
+			}
+		}
+
+		// the sum no longer fits, so finish it as a big.Int
+		total := big.NewInt(sum)
+		for _, rest := range args[i:] {
+			n, _ := object.BigOf(rest)
+			total.Add(total, n)
 		}
-		sum += arg.D.(object.Integer)
+		return object.IntegerFromBig(total), nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(sum)}, nil
+}
+
+func cmdIntToReal(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	if errObj, ok := checkIntegers("int/real", args); !ok {
+		return errObj, nil
+	}
+	if args[0].Type == object.OBJ_TYPE_INTEGER {
+		return object.Obj{Type: object.OBJ_TYPE_REAL, D: object.Real(args[0].D.(object.Integer))}, nil
+	}
+	f, _ := new(big.Float).SetInt(args[0].D.(*big.Int)).Float64()
+	if math.IsInf(f, 0) {
+		return numberError(env.ErrorCodeArith, "int/real: integer too large for a real"), nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_REAL, D: object.Real(f)}, nil
+}
+
+// wholeReal converts a real that has already been rounded to an integer,
+// becoming a bigint when it is outside the int64 range
+func wholeReal(name string, f float64) object.Obj {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return numberError(env.ErrorCodeArith, name+": cannot convert "+strconv.FormatFloat(f, 'g', -1, 64)+" to an integer")
+	}
+	if f >= math.MinInt64 && f < math.MaxInt64 {
+		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(f)}
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: sum}, nil
+	n, _ := big.NewFloat(f).Int(nil)
+	return object.IntegerFromBig(n)
 }
 
 func cmdRealAdd(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
@@ -460,13 +569,7 @@ func cmdRealDiv(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 	a := args[0].D.(object.Real)
 	b := args[1].D.(object.Real)
 	if b == 0.0 {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "real/div: division by zero",
-			},
-		}, nil
+		return numberError(env.ErrorCodeArith, "real/div: division by zero"), nil
 	}
 	return object.Obj{Type: object.OBJ_TYPE_REAL, D: a / b}, nil
 }
@@ -476,13 +579,7 @@ func cmdRealPow(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 	b := args[1].D.(object.Real)
 	result := math.Pow(float64(a), float64(b))
 	if math.IsNaN(result) || math.IsInf(result, 0) {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "real/pow: invalid result (NaN or Inf)",
-			},
-		}, nil
+		return numberError(env.ErrorCodeArith, "real/pow: invalid result (NaN or Inf)"), nil
 	}
 	return object.Obj{Type: object.OBJ_TYPE_REAL, D: object.Real(result)}, nil
 }
@@ -494,73 +591,51 @@ func cmdRealSum(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 	sum := object.Real(0.0)
 	for i, arg := range args {
 		if arg.Type != object.OBJ_TYPE_REAL {
-			return object.Obj{
-				Type: object.OBJ_TYPE_ERROR,
-				D: object.Error{
-					Position: 0,
-					Message:  "real/sum: all arguments must be reals, got " + string(arg.Type) + " at position " + strconv.Itoa(i),
-				},
-			}, nil
+			return numberError(env.ErrorCodeType, "real/sum: all arguments must be reals, got "+string(arg.Type)+" at position "+strconv.Itoa(i)), nil
 		}
 		sum += arg.D.(object.Real)
 	}
 	return object.Obj{Type: object.OBJ_TYPE_REAL, D: sum}, nil
 }
 
-func cmdIntToReal(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	i := args[0].D.(object.Integer)
-	return object.Obj{Type: object.OBJ_TYPE_REAL, D: object.Real(i)}, nil
-}
-
 func cmdRealToInt(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	r := args[0].D.(object.Real)
-	floored := math.Floor(float64(r))
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(floored)}, nil
+	return wholeReal("real/int", math.Floor(float64(r))), nil
 }
 
 func cmdIntEq(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	if a == b {
-		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	if errObj, ok := checkIntegers("int/eq", args); !ok {
+		return errObj, nil
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+	return boolObj(compareIntegers(args[0], args[1]) == 0), nil
 }
 
 func cmdIntGt(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	if a > b {
-		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	if errObj, ok := checkIntegers("int/gt", args); !ok {
+		return errObj, nil
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+	return boolObj(compareIntegers(args[0], args[1]) > 0), nil
 }
 
 func cmdIntGte(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	if a >= b {
-		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	if errObj, ok := checkIntegers("int/gte", args); !ok {
+		return errObj, nil
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+	return boolObj(compareIntegers(args[0], args[1]) >= 0), nil
 }
 
 func cmdIntLt(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	if a < b {
-		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	if errObj, ok := checkIntegers("int/lt", args); !ok {
+		return errObj, nil
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+	return boolObj(compareIntegers(args[0], args[1]) < 0), nil
 }
 
 func cmdIntLte(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	a := args[0].D.(object.Integer)
-	b := args[1].D.(object.Integer)
-	if a <= b {
-		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	if errObj, ok := checkIntegers("int/lte", args); !ok {
+		return errObj, nil
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+	return boolObj(compareIntegers(args[0], args[1]) <= 0), nil
 }
 
 func cmdRealEq(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
@@ -609,36 +684,40 @@ func cmdRealLte(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 }
 
 func cmdIntRand(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	lower := args[0].D.(object.Integer)
-	upper := args[1].D.(object.Integer)
-	if lower > upper {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "int/rand: lower bound must be less than or equal to upper bound",
-			},
-		}, nil
+	if errObj, ok := checkIntegers("int/rand", args); !ok {
+		return errObj, nil
 	}
-	if lower == upper {
-		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: lower}, nil
+	if compareIntegers(args[0], args[1]) > 0 {
+		return numberError(env.ErrorCodeArith, "int/rand: lower bound must be less than or equal to upper bound"), nil
+	}
+	if compareIntegers(args[0], args[1]) == 0 {
+		return args[0], nil
+	}
+	if args[0].Type == object.OBJ_TYPE_INTEGER && args[1].Type == object.OBJ_TYPE_INTEGER {
+		lower := int64(args[0].D.(object.Integer))
+		upper := int64(args[1].D.(object.Integer))
+		if rangeSize, ok := subInt(upper, lower); ok && rangeSize < math.MaxInt64 {
+			return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(lower + rand.Int64N(rangeSize+1))}, nil
+		}
 	}
-	rangeSize := upper - lower + 1
-	result := lower + object.Integer(rand.IntN(int(rangeSize)))
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: result}, nil
+
+	// the range doesn't fit in an int64, so draw from it as a big.Int
+	lower, _ := object.BigOf(args[0])
+	upper, _ := object.BigOf(args[1])
+	rangeSize := upper.Sub(upper, lower)
+	rangeSize.Add(rangeSize, big.NewInt(1))
+	offset, err := crand.Int(crand.Reader, rangeSize)
+	if err != nil {
+		return numberError("", "int/rand: "+err.Error()), nil
+	}
+	return object.IntegerFromBig(offset.Add(offset, lower)), nil
 }
 
 func cmdRealRand(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	lower := args[0].D.(object.Real)
 	upper := args[1].D.(object.Real)
 	if lower > upper {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "real/rand: lower bound must be less than or equal to upper bound",
-			},
-		}, nil
+		return numberError(env.ErrorCodeArith, "real/rand: lower bound must be less than or equal to upper bound"), nil
 	}
 	if lower == upper {
 		return object.Obj{Type: object.OBJ_TYPE_REAL, D: lower}, nil
@@ -651,13 +730,7 @@ func cmdRealRand(ctx env.EvaluationContext, args object.List) (object.Obj, error
 func cmdRealSqrt(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	value := args[0].D.(object.Real)
 	if value < 0.0 {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "real/sqrt: cannot compute square root of negative number",
-			},
-		}, nil
+		return numberError(env.ErrorCodeArith, "real/sqrt: cannot compute square root of negative number"), nil
 	}
 	result := math.Sqrt(float64(value))
 	return object.Obj{Type: object.OBJ_TYPE_REAL, D: object.Real(result)}, nil
@@ -667,13 +740,7 @@ func cmdRealExp(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 	value := args[0].D.(object.Real)
 	result := math.Exp(float64(value))
 	if math.IsInf(result, 0) {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "real/exp: result overflow (infinity)",
-			},
-		}, nil
+		return numberError(env.ErrorCodeArith, "real/exp: result overflow (infinity)"), nil
 	}
 	return object.Obj{Type: object.OBJ_TYPE_REAL, D: object.Real(result)}, nil
 }
@@ -681,13 +748,7 @@ func cmdRealExp(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 func cmdRealLog(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	value := args[0].D.(object.Real)
 	if value <= 0.0 {
-		return object.Obj{
-			Type: object.OBJ_TYPE_ERROR,
-			D: object.Error{
-				Position: 0,
-				Message:  "real/log: logarithm undefined for non-positive numbers",
-			},
-		}, nil
+		return numberError(env.ErrorCodeArith, "real/log: logarithm undefined for non-positive numbers"), nil
 	}
 	result := math.Log(float64(value))
 	return object.Obj{Type: object.OBJ_TYPE_REAL, D: object.Real(result)}, nil
@@ -695,14 +756,12 @@ func cmdRealLog(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 
 func cmdRealCeil(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	value := args[0].D.(object.Real)
-	ceiled := math.Ceil(float64(value))
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(ceiled)}, nil
+	return wholeReal("real/ceil", math.Ceil(float64(value))), nil
 }
 
 func cmdRealRound(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	value := args[0].D.(object.Real)
-	rounded := math.Round(float64(value))
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(rounded)}, nil
+	return wholeReal("real/round", math.Round(float64(value))), nil
 }
 
 func cmdRealIsNaN(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
@@ -730,11 +789,20 @@ func cmdRealIsFinite(ctx env.EvaluationContext, args object.List) (object.Obj, e
 }
 
 func cmdIntAbs(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
-	value := args[0].D.(object.Integer)
-	if value < 0 {
-		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: -value}, nil
+	if errObj, ok := checkIntegers("int/abs", args); !ok {
+		return errObj, nil
+	}
+	if args[0].Type == object.OBJ_TYPE_INTEGER {
+		value := args[0].D.(object.Integer)
+		if value >= 0 {
+			return args[0], nil
+		}
+		if value != math.MinInt64 {
+			return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: -value}, nil
+		}
 	}
-	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: value}, nil
+	value, _ := object.BigOf(args[0])
+	return object.IntegerFromBig(value.Abs(value)), nil
 }
 
 func cmdRealAbs(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
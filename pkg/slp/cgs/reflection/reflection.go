@@ -42,6 +42,14 @@ func (r *reflectionFunctions) Functions() map[object.Identifier]env.EnvFunction
 			ReturnType: object.OBJ_TYPE_INTEGER,
 			Body:       cmdReflectIsInt,
 		},
+		"reflect/bigint?": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "value", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdReflectIsBigInt,
+		},
 		"reflect/real?": {
 			EvaluateArgs: true,
 			Parameters: []env.EnvParameter{
@@ -66,6 +74,22 @@ func (r *reflectionFunctions) Functions() map[object.Identifier]env.EnvFunction
 			ReturnType: object.OBJ_TYPE_INTEGER,
 			Body:       cmdReflectIsList,
 		},
+		"reflect/map?": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "value", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdReflectIsMap,
+		},
+		"reflect/bytes?": {
+			EvaluateArgs: true,
+			Parameters: []env.EnvParameter{
+				{Name: "value", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body:       cmdReflectIsBytes,
+		},
 		"reflect/fn?": {
 			EvaluateArgs: true,
 			Parameters: []env.EnvParameter{
@@ -143,6 +167,14 @@ func cmdReflectIsInt(ctx env.EvaluationContext, args object.List) (object.Obj, e
 	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
 }
 
+func cmdReflectIsBigInt(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	value := args[0]
+	if value.Type == object.OBJ_TYPE_BIGINT {
+		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+}
+
 func cmdReflectIsReal(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	value := args[0]
 	if value.Type == object.OBJ_TYPE_REAL {
@@ -167,6 +199,22 @@ func cmdReflectIsList(ctx env.EvaluationContext, args object.List) (object.Obj,
 	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
 }
 
+func cmdReflectIsMap(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	value := args[0]
+	if value.Type == object.OBJ_TYPE_MAP {
+		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+}
+
+func cmdReflectIsBytes(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+	value := args[0]
+	if value.Type == object.OBJ_TYPE_BYTES {
+		return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, nil
+	}
+	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(0)}, nil
+}
+
 func cmdReflectIsFn(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
 	value := args[0]
 	if value.Type == object.OBJ_TYPE_FUNCTION {
@@ -217,8 +217,7 @@ func cmdStrInt(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "str/int: failed to parse integer: " + err.Error(),
+				Message: "str/int: failed to parse integer: " + err.Error(),
 			},
 		}, nil
 	}
@@ -232,8 +231,7 @@ func cmdStrReal(ctx env.EvaluationContext, args object.List) (object.Obj, error)
 		return object.Obj{
 			Type: object.OBJ_TYPE_ERROR,
 			D: object.Error{
-				Position: 0,
-				Message:  "str/real: failed to parse real: " + err.Error(),
+				Message: "str/real: failed to parse real: " + err.Error(),
 			},
 		}, nil
 	}
@@ -260,8 +258,7 @@ func cmdStrConcat(ctx env.EvaluationContext, args object.List) (object.Obj, erro
 			return object.Obj{
 				Type: object.OBJ_TYPE_ERROR,
 				D: object.Error{
-					Position: 0,
-					Message:  "str/concat: all arguments must be strings, got " + string(arg.Type) + " at position " + strconv.Itoa(i),
+					Message: "str/concat: all arguments must be strings, got " + string(arg.Type) + " at position " + strconv.Itoa(i),
 				},
 			}, nil
 		}
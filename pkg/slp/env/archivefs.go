@@ -0,0 +1,214 @@
+package env
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrReadOnly is the error (inside an *fs.PathError) for a change asked of a
+// read-only FS
+var ErrReadOnly = errors.New("read-only filesystem")
+
+// ErrArchiveTooLarge is the error for an archive that unpacks to more than
+// MaxArchiveEntrySize in one file or MaxArchiveSize in all
+var ErrArchiveTooLarge = errors.New("archive unpacks to too much data")
+
+// MaxArchiveEntrySize and MaxArchiveSize bound how much an archive may unpack
+// to, so that a small archive of well-compressed data cannot fill memory
+var (
+	MaxArchiveEntrySize int64 = 64 << 20
+	MaxArchiveSize      int64 = 256 << 20
+)
+
+// ArchiveExtensions are the file name endings OpenArchiveFS understands
+var ArchiveExtensions = []string{".zip", ".tar.gz", ".tgz"}
+
+// IsArchivePath reports whether OpenArchiveFS would take path
+func IsArchivePath(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range ArchiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+archiveFS serves the files of an archive, read-only. The archive is unpacked
+into memory when it is opened and its root becomes the filesystem's root and
+working directory, so a bundle's files find each other with `use` exactly as
+they did in the directory it was made from.
+*/
+type archiveFS struct {
+	*memoryFS
+
+	// unpacked is how many bytes of file data have been read so far
+	unpacked int64
+}
+
+var _ FS = &archiveFS{}
+
+// OpenArchiveFS opens a .zip, .tar.gz, or .tgz file from the host as an FS
+func OpenArchiveFS(path string) (FS, error) {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		reader, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return NewZipFS(&reader.Reader)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return NewTarGzFS(file)
+	default:
+		return nil, fmt.Errorf("%s is not an archive (expected one of %s)", path, strings.Join(ArchiveExtensions, ", "))
+	}
+}
+
+// NewZipFS serves the files of a zip archive
+func NewZipFS(reader *zip.Reader) (FS, error) {
+	archive := &archiveFS{memoryFS: newMemoryFS()}
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			if err := archive.memoryFS.MkDirAll(archivePath(file.Name), 0755); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		contents, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := archive.read(file.Name, contents)
+		contents.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := archive.add(file.Name, data); err != nil {
+			return nil, err
+		}
+	}
+	return archive, nil
+}
+
+// NewTarGzFS serves the files of a gzipped tar archive
+func NewTarGzFS(reader io.Reader) (FS, error) {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	archive := &archiveFS{memoryFS: newMemoryFS()}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := archive.memoryFS.MkDirAll(archivePath(header.Name), 0755); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			data, err := archive.read(header.Name, tr)
+			if err != nil {
+				return nil, err
+			}
+			if err := archive.add(header.Name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return archive, nil
+}
+
+// NewArchiveView is another view of an FS from OpenArchiveFS, NewZipFS, or
+// NewTarGzFS. It shares the archive's files, which never change, but has a
+// working directory of its own, so one unpacked archive can serve any number
+// of sessions
+func NewArchiveView(archive FS) (FS, error) {
+	shared, ok := archive.(*archiveFS)
+	if !ok {
+		return nil, fmt.Errorf("%T is not an archive", archive)
+	}
+	return &archiveFS{memoryFS: &memoryFS{root: shared.root, workingDir: shared.WorkingDir()}}, nil
+}
+
+// read reads one file's data, failing once it or the archive as a whole
+// unpacks to more than is allowed rather than reading it all first
+func (f *archiveFS) read(name string, r io.Reader) ([]byte, error) {
+	limit := min(MaxArchiveEntrySize, MaxArchiveSize-f.unpacked)
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s from archive: %w", name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("reading %s from archive: %w", name, ErrArchiveTooLarge)
+	}
+	f.unpacked += int64(len(data))
+	return data, nil
+}
+
+// archivePath places an entry's name under the root. Cleaning it from the
+// root keeps a name like ../x from landing anywhere but /x
+func archivePath(name string) string {
+	return filepath.Join(string(filepath.Separator), filepath.FromSlash(name))
+}
+
+func (f *archiveFS) add(name string, data []byte) error {
+	path := archivePath(name)
+	if err := f.memoryFS.MkDirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return f.memoryFS.WriteFile(path, data, 0444)
+}
+
+func (f *archiveFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return pathError("open", path, ErrReadOnly)
+}
+
+func (f *archiveFS) AppendFile(path string, data []byte) error {
+	return pathError("open", path, ErrReadOnly)
+}
+
+func (f *archiveFS) DeleteFile(path string) error {
+	return pathError("remove", path, ErrReadOnly)
+}
+
+func (f *archiveFS) RemoveDir(path string) error {
+	return pathError("remove", path, ErrReadOnly)
+}
+
+func (f *archiveFS) RemoveDirAll(path string) error {
+	return pathError("remove", path, ErrReadOnly)
+}
+
+func (f *archiveFS) MkDir(path string, perm os.FileMode) error {
+	return pathError("mkdir", path, ErrReadOnly)
+}
+
+func (f *archiveFS) MkDirAll(path string, perm os.FileMode) error {
+	return pathError("mkdir", path, ErrReadOnly)
+}
@@ -0,0 +1,147 @@
+package env
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func zipArchive(t *testing.T, files map[string]string) (FS, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, body := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewZipFS(reader)
+}
+
+func tarGzArchive(t *testing.T, files map[string]string) (FS, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for name, body := range files {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return NewTarGzFS(&buf)
+}
+
+var archiveFormats = map[string]func(*testing.T, map[string]string) (FS, error){
+	"zip":    zipArchive,
+	"tar.gz": tarGzArchive,
+}
+
+func TestArchiveContents(t *testing.T) {
+	for format, open := range archiveFormats {
+		t.Run(format, func(t *testing.T) {
+			archive, err := open(t, map[string]string{
+				"lib/util.slpx": "util",
+				"../escape.txt": "escape",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err := archive.ReadFile("lib/util.slpx"); err != nil || string(data) != "util" {
+				t.Errorf("expected lib/util.slpx, got %q %v", data, err)
+			}
+			if data, err := archive.ReadFile("/escape.txt"); err != nil || string(data) != "escape" {
+				t.Errorf("expected ../escape.txt to land at the root, got %q %v", data, err)
+			}
+			if err := archive.WriteFile("lib/util.slpx", nil, 0644); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("expected ErrReadOnly, got %v", err)
+			}
+			if err := archive.MkDir("new", 0755); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("expected ErrReadOnly, got %v", err)
+			}
+		})
+	}
+}
+
+func TestArchiveSizeLimits(t *testing.T) {
+	entry, total := MaxArchiveEntrySize, MaxArchiveSize
+	t.Cleanup(func() { MaxArchiveEntrySize, MaxArchiveSize = entry, total })
+	MaxArchiveEntrySize, MaxArchiveSize = 1024, 2048
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		fails bool
+	}{
+		{"at_the_limits", map[string]string{"a": strings.Repeat("a", 1024), "b": strings.Repeat("b", 1024)}, false},
+		{"entry_too_large", map[string]string{"a": strings.Repeat("a", 1025)}, true},
+		{"total_too_large", map[string]string{"a": strings.Repeat("a", 1024), "b": strings.Repeat("b", 1024), "c": "c"}, true},
+	}
+	for format, open := range archiveFormats {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				_, err := open(t, tt.files)
+				if tt.fails && !errors.Is(err, ErrArchiveTooLarge) {
+					t.Errorf("expected ErrArchiveTooLarge, got %v", err)
+				}
+				if !tt.fails && err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestArchiveView(t *testing.T) {
+	archive, err := zipArchive(t, map[string]string{"app/main.slpx": "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := NewArchiveView(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewArchiveView(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.SetWorkingDir("app"); err != nil {
+		t.Fatal(err)
+	}
+	if second.WorkingDir() != "/" || archive.WorkingDir() != "/" {
+		t.Errorf("expected other views to keep their working directory, got %s and %s", second.WorkingDir(), archive.WorkingDir())
+	}
+	if data, err := first.ReadFile("main.slpx"); err != nil || string(data) != "main" {
+		t.Errorf("expected the view to read relative to its working directory, got %q %v", data, err)
+	}
+	if data, err := second.ReadFile("app/main.slpx"); err != nil || string(data) != "main" {
+		t.Errorf("expected views to share the archive's files, got %q %v", data, err)
+	}
+	if err := first.WriteFile("main.slpx", nil, 0644); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected a view to be read-only, got %v", err)
+	}
+
+	if _, err := NewArchiveView(NewMemoryFS()); err == nil {
+		t.Error("expected a view of something other than an archive to fail")
+	}
+}
@@ -0,0 +1,373 @@
+package env
+
+import (
+	"strings"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+/*
+Bytecode
+
+With EngineVM a function body is compiled the second time the function is
+called, and every call after that runs the compiled code. The first call is
+walked as the tree walker would walk it, and so is code outside of any
+function: a script's top level, and many of its functions, run only once, and
+compiling them would cost more than it saves. The chunk is kept on the
+function's object.Code, which every copy of the function shares, so a closure
+made again and again from the same compiled `fn` is compiled only once.
+
+The compiler settles ahead of time what the tree walker works out on every
+evaluation:
+
+  - literals are placed in the chunk's constant pool
+  - a head naming an env function is looked up once and called directly,
+    skipping the lookup in the function registry
+  - parameters are loaded from their slots in the call's scope (see
+    scopeMem) rather than looked up by name
+  - the core forms if, do, set, try, and fn become jumps and dedicated ops
+    rather than calls into core.go (a try with catch or finally clauses is
+    left as a call)
+
+Everything else (env functions that take their arguments raw, calls through
+values, forms that are not well formed) compiles to a call that ends up in
+the same code the tree walker runs, so the two engines cannot disagree about
+what a program means. MEM still holds every binding, so closures and env
+functions see exactly the scopes they always have. A name resolved to an env
+function is checked against MEM again when it runs, and a binding that
+shadows it sends the call back through dispatch.
+
+A chunk belongs to the context that compiled it, and only until a function
+group is added to or removed from it; a function called anywhere else, or
+after that, starts over.
+*/
+
+type opcode uint8
+
+const (
+	opConst       opcode = iota // push consts[a]
+	opLoad                      // push the value of the identifier consts[a]
+	opLoadLocal                 // push parameter slot b, or opLoad consts[a] if it is unbound
+	opEval                      // push what the tree walker makes of consts[a]
+	opPop                       // drop the top of the stack
+	opCheck                     // raise the top of the stack if it is an error
+	opArgPos                    // report the top of the stack at spans[a]
+	opCheckCancel               // stop if the evaluation was cancelled
+	opJump                      // continue at a
+	opEnter                     // start the call sites[a]: cancellation and step
+	opEnterEnv                  // opEnter for a head resolved to an env function
+	opDispatch                  // decide how to call the evaluated head of sites[a]
+	opCall                      // call a user function with sites[a].argc arguments
+	opCallEnv                   // call the env function of sites[a]
+	opPushForm                  // enter the core form sites[a]
+	opPopForm                   // leave it, checking the result as callEnvFunction would
+	opBranch                    // if: pop the condition, going to sites[a].alt when false
+	opSet                       // bind the top of the stack to sites[a].name
+	opMakeFn                    // push sites[a].proto closed over the current scope
+	opGuard                     // errors raised until opUnguard resume at a
+	opUnguard                   // drop the innermost guard
+	opCatch                     // try: bind $error and run the handler, or skip to a
+	opEndHandler                // unbind $error
+)
+
+type instr struct {
+	op opcode
+	a  int32
+	b  int32
+}
+
+// site is a call in the source along with what the compiler knows about it
+type site struct {
+	list object.List
+	name object.Identifier
+	env  *EnvFunction
+	argc int
+	tail bool
+
+	// end is the first instruction after the call, exit the opPopForm of a
+	// core form and alt the false branch of an if
+	end  int
+	exit int
+	alt  int
+
+	proto *object.Function
+}
+
+type chunk struct {
+	code   []instr
+	consts []object.Obj
+	spans  []object.Span
+	sites  []site
+}
+
+// bodyCode is what object.Code holds under EngineVM: the chunk compiled for
+// a function body, or no chunk yet when the function has been called once
+type bodyCode struct {
+	shared     *sharedState
+	generation uint64
+	chunk      *chunk
+}
+
+// compiledBody returns the chunk to run the body of function with, or nil
+// when this call should walk it instead
+func (e *evalCtx) compiledBody(function object.Function) *chunk {
+	if function.Code == nil || len(function.Body) == 0 {
+		return nil
+	}
+	seen, _ := function.Code.Load().(*bodyCode)
+	if seen == nil || seen.shared != e.shared || seen.generation != e.shared.generation {
+		function.Code.Store(&bodyCode{shared: e.shared, generation: e.shared.generation})
+		return nil
+	}
+	if seen.chunk != nil {
+		return seen.chunk
+	}
+
+	c := &compiler{e: e, chunk: &chunk{}, locals: make(map[object.Identifier]int)}
+	c.body(function)
+	function.Code.Store(&bodyCode{shared: e.shared, generation: e.shared.generation, chunk: c.chunk})
+	return c.chunk
+}
+
+type compiler struct {
+	e     *evalCtx
+	chunk *chunk
+
+	// locals are the slots of the parameters of the function being compiled
+	locals map[object.Identifier]int
+}
+
+func (c *compiler) emit(op opcode, a int) int {
+	c.chunk.code = append(c.chunk.code, instr{op: op, a: int32(a)})
+	return len(c.chunk.code) - 1
+}
+
+func (c *compiler) here() int {
+	return len(c.chunk.code)
+}
+
+// patch points the instruction at to the next one emitted
+func (c *compiler) patch(at int) {
+	c.chunk.code[at].a = int32(c.here())
+}
+
+func (c *compiler) constant(obj object.Obj) int {
+	c.chunk.consts = append(c.chunk.consts, obj)
+	return len(c.chunk.consts) - 1
+}
+
+func (c *compiler) span(pos object.Span) int {
+	c.chunk.spans = append(c.chunk.spans, pos)
+	return len(c.chunk.spans) - 1
+}
+
+func (c *compiler) site(s site) int {
+	c.chunk.sites = append(c.chunk.sites, s)
+	return len(c.chunk.sites) - 1
+}
+
+// body compiles the instructions of a function the way runFunction runs
+// them, the last one in tail position
+func (c *compiler) body(function object.Function) {
+	if function.Variadic {
+		c.locals["$args"] = 0
+	}
+	for i, param := range function.Parameters {
+		if _, seen := c.locals[param.Name]; !seen {
+			c.locals[param.Name] = i
+		}
+	}
+
+	last := len(function.Body) - 1
+	for i, instruction := range function.Body {
+		c.emit(opCheckCancel, 0)
+		c.expr(instruction, i == last)
+		if i != last {
+			c.emit(opCheck, 0)
+			c.emit(opPop, 0)
+		}
+	}
+}
+
+func (c *compiler) expr(obj object.Obj, tail bool) {
+	switch obj.Type {
+	case object.OBJ_TYPE_NONE, object.OBJ_TYPE_STRING,
+		object.OBJ_TYPE_INTEGER, object.OBJ_TYPE_BIGINT, object.OBJ_TYPE_REAL,
+		object.OBJ_TYPE_ERROR, object.OBJ_TYPE_FUNCTION,
+		object.OBJ_TYPE_BYTES:
+		c.emit(opConst, c.constant(obj))
+
+	case object.OBJ_TYPE_SOME:
+		c.emit(opConst, c.constant(obj.D.(object.Some)))
+
+	case object.OBJ_TYPE_IDENTIFIER:
+		if slot, local := c.locals[obj.D.(object.Identifier)]; local {
+			at := c.emit(opLoadLocal, c.constant(obj))
+			c.chunk.code[at].b = int32(slot)
+		} else {
+			c.emit(opLoad, c.constant(obj))
+		}
+
+	case object.OBJ_TYPE_LIST:
+		c.call(obj.D.(object.List), tail)
+
+	default:
+		c.emit(opEval, c.constant(obj))
+	}
+}
+
+// arg compiles an argument that is evaluated before the call is made
+func (c *compiler) arg(arg object.Obj) {
+	c.expr(arg, false)
+	c.emit(opCheck, 0)
+	if !arg.Pos.IsZero() {
+		c.emit(opArgPos, c.span(arg.Pos))
+	}
+}
+
+func (c *compiler) call(list object.List, tail bool) {
+	if len(list) == 0 {
+		c.emit(opCheckCancel, 0)
+		c.emit(opConst, c.constant(object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}))
+		return
+	}
+
+	if list[0].Type == object.OBJ_TYPE_IDENTIFIER {
+		name := list[0].D.(object.Identifier)
+		_, local := c.locals[name]
+		if function, found := c.e.lookupEnvFunction(name); found && !local {
+			s := c.site(site{
+				list: list,
+				name: name,
+				env:  &function,
+				argc: len(list) - 1,
+				tail: tail,
+			})
+			if !c.coreForm(s) {
+				c.envCall(s)
+			}
+			c.chunk.sites[s].end = c.here()
+			return
+		}
+	}
+
+	s := c.site(site{list: list, argc: len(list) - 1, tail: tail})
+	c.emit(opEnter, s)
+	c.expr(list[0], false)
+	c.emit(opCheck, 0)
+	c.emit(opDispatch, s)
+	for _, arg := range list[1:] {
+		c.arg(arg)
+	}
+	c.emit(opCall, s)
+	c.chunk.sites[s].end = c.here()
+}
+
+func (c *compiler) envCall(s int) {
+	c.emit(opEnterEnv, s)
+	if c.chunk.sites[s].env.EvaluateArgs {
+		for _, arg := range c.chunk.sites[s].list[1:] {
+			c.arg(arg)
+		}
+	}
+	c.emit(opCallEnv, s)
+}
+
+// coreForm lowers a call to one of the core forms when it is well formed
+// enough that the checks callEnvFunction makes before the body runs would
+// pass. It reports false, having emitted nothing, otherwise
+func (c *compiler) coreForm(s int) bool {
+	if _, isCore := c.e.functions.group("core").(*coreFunctions); !isCore {
+		return false
+	}
+	if name := c.chunk.sites[s].name; c.e.functions.owner(name) != "core" || c.e.functions.restricted(name) {
+		return false
+	}
+
+	list := c.chunk.sites[s].list
+	args := list[1:]
+
+	var lower func(s int, args object.List)
+	switch c.chunk.sites[s].name {
+	case "if":
+		if len(args) == 3 {
+			lower = c.lowerIf
+		}
+	case "do":
+		if len(args) > 0 {
+			lower = c.lowerDo
+		}
+	case "set":
+		if len(args) == 2 && args[0].Type == object.OBJ_TYPE_IDENTIFIER &&
+			!strings.HasPrefix(string(args[0].D.(object.Identifier)), "$") {
+			lower = c.lowerSet
+		}
+	case "try":
+		if len(args) == 2 && !isTryClause(args[1]) {
+			lower = c.lowerTry
+		}
+	case "fn":
+		if proto, err := parseFunction(args); err == nil {
+			c.chunk.sites[s].proto = &proto
+			lower = c.lowerFn
+		}
+	}
+	if lower == nil {
+		return false
+	}
+
+	c.emit(opEnterEnv, s)
+	c.emit(opPushForm, s)
+	lower(s, args)
+	c.chunk.sites[s].exit = c.here()
+	c.emit(opPopForm, s)
+	return true
+}
+
+func (c *compiler) lowerIf(s int, args object.List) {
+	tail := c.chunk.sites[s].tail
+	c.expr(args[0], false)
+	c.emit(opCheck, 0)
+	c.emit(opBranch, s)
+	c.expr(args[1], tail)
+	skip := c.emit(opJump, 0)
+	c.chunk.sites[s].alt = c.here()
+	c.expr(args[2], tail)
+	c.patch(skip)
+}
+
+func (c *compiler) lowerDo(s int, args object.List) {
+	tail := c.chunk.sites[s].tail
+	last := len(args) - 1
+	for i, arg := range args {
+		c.emit(opCheckCancel, 0)
+		c.expr(arg, tail && i == last)
+		if i != last {
+			c.emit(opCheck, 0)
+			c.emit(opPop, 0)
+		}
+	}
+}
+
+func (c *compiler) lowerSet(s int, args object.List) {
+	guard := c.emit(opGuard, 0)
+	c.expr(args[1], false)
+	c.emit(opUnguard, 0)
+	c.patch(guard)
+	c.emit(opSet, s)
+}
+
+func (c *compiler) lowerTry(s int, args object.List) {
+	guard := c.emit(opGuard, 0)
+	c.expr(args[0], false)
+	c.emit(opUnguard, 0)
+	c.patch(guard)
+	catch := c.emit(opCatch, 0)
+	c.expr(args[1], false)
+	c.emit(opEndHandler, 0)
+	c.patch(catch)
+}
+
+func (c *compiler) lowerFn(s int, args object.List) {
+	c.emit(opMakeFn, s)
+}
@@ -0,0 +1,278 @@
+package env
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+	"github.com/bosley/slpx/pkg/slp/slp"
+)
+
+// testIntegers is just enough arithmetic to write loops with
+type testIntegers struct{}
+
+func (testIntegers) Name() string { return "int" }
+
+func (testIntegers) Functions() map[object.Identifier]EnvFunction {
+	binary := func(op func(a, b object.Integer) object.Integer) EnvFunction {
+		return EnvFunction{
+			EvaluateArgs: true,
+			Parameters: []EnvParameter{
+				{Name: "a", Type: object.OBJ_TYPE_INTEGER},
+				{Name: "b", Type: object.OBJ_TYPE_INTEGER},
+			},
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body: func(ctx EvaluationContext, args object.List) (object.Obj, error) {
+				return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: op(args[0].D.(object.Integer), args[1].D.(object.Integer))}, nil
+			},
+		}
+	}
+	truth := func(b bool) object.Integer {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return map[object.Identifier]EnvFunction{
+		"add": binary(func(a, b object.Integer) object.Integer { return a + b }),
+		"sub": binary(func(a, b object.Integer) object.Integer { return a - b }),
+		"lt":  binary(func(a, b object.Integer) object.Integer { return truth(a < b) }),
+		"eq":  binary(func(a, b object.Integer) object.Integer { return truth(a == b) }),
+	}
+}
+
+func newTestContext(engine Engine, limits Limits) *evalCtx {
+	return NewEvalBuilder(nil).
+		WithEngine(engine).
+		WithLimits(limits).
+		WithFunctionGroup(NewCoreFunctions()).
+		WithFunctionGroup(testIntegers{}).
+		Build().(*evalCtx)
+}
+
+func evaluateSource(t *testing.T, e *evalCtx, source string) object.Obj {
+	t.Helper()
+	items, err := slp.NewParser(source).ParseAll()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var result object.Obj
+	for _, item := range items {
+		result, err = e.Evaluate(item)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return result
+}
+
+func compiledChunk(t *testing.T, e *evalCtx, name object.Identifier) *chunk {
+	t.Helper()
+	functionObj, err := e.mem.Get(name, false)
+	if err != nil {
+		t.Fatalf("%s is not set", name)
+	}
+	seen, _ := functionObj.D.(object.Function).Code.Load().(*bodyCode)
+	if seen == nil || seen.generation != e.shared.generation {
+		return nil
+	}
+	return seen.chunk
+}
+
+// every program calls its functions more than once, so that their bodies run
+// compiled under EngineVM
+func TestCompiledBodiesAgree(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		source string
+	}{
+		{"recursion", Limits{}, `
+(set fib (fn (n :I) :I (if (lt n 2) n (add (fib (sub n 1)) (fib (sub n 2))))))
+(fib 15)`},
+		{"closures", Limits{}, `
+(set adder (fn (n :I) :F (fn (x :I) :I (add x n))))
+(set use (fn (n :I) :I ((adder n) 1)))
+(add (use 1) (add (use 2) (use 3)))`},
+		{"assign_parameter", Limits{}, `
+(set f (fn (n :I) :I (do (set n (add n 1)) (set m n) (add n m))))
+(add (f 1) (f 2))`},
+		{"drop_parameter", Limits{}, `
+(set n 100)
+(set f (fn (n :I) :I (do (drop n) n)))
+(add (f 1) (f 2))`},
+		{"parameter_shadows_env_function", Limits{}, `
+(set f (fn (add :I) :I add))
+(sub (f 5) (f 2))`},
+		{"duplicate_parameters", Limits{}, `
+(set f (fn (x :I x :I) :I x))
+(add (f 1 2) (f 3 4))`},
+		{"variadic", Limits{}, `
+(set f (fn (..) :L $args))
+(f 1 2)
+(f 3 4)`},
+		{"tail_calls", Limits{}, `
+(set loop (fn (n :I acc :I) :I (if (eq n 0) acc (loop (sub n 1) (add acc 1)))))
+(add (loop 5000 0) (loop 5000 0))`},
+		{"try", Limits{}, `
+(set f (fn (x :I) :I (try (add x "no") 7)))
+(add (f 1) (f 2))`},
+		{"errors", Limits{}, `
+(set f (fn (x :I) :I (add x "no")))
+(f 1)
+(f 2)`},
+		{"recursion_limit", Limits{MaxRecursionDepth: 40}, `
+(set down (fn (n :I) :I (if (eq n 0) 0 (add 1 (down (sub n 1))))))
+(down 10)
+(down 100)`},
+		{"step_limit", Limits{MaxSteps: 60}, `
+(set count (fn (n :I) :I (if (eq n 0) 0 (count (sub n 1)))))
+(count 5)
+(count 100)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestContext(EngineTree, tt.limits)
+			vm := newTestContext(EngineVM, tt.limits)
+			treeResult := evaluateSource(t, tree, tt.source)
+			vmResult := evaluateSource(t, vm, tt.source)
+
+			if treeResult.Encode() != vmResult.Encode() {
+				t.Fatalf("engines disagree:\n tree: %s\n   vm: %s", treeResult.Encode(), vmResult.Encode())
+			}
+			if treeResult.Type == object.OBJ_TYPE_ERROR {
+				var treeTrace, vmTrace []string
+				for _, frame := range treeResult.D.(object.Error).Trace {
+					treeTrace = append(treeTrace, frame.String())
+				}
+				for _, frame := range vmResult.D.(object.Error).Trace {
+					vmTrace = append(vmTrace, frame.String())
+				}
+				if !slices.Equal(treeTrace, vmTrace) {
+					t.Errorf("backtraces differ:\n tree: %v\n   vm: %v", treeTrace, vmTrace)
+				}
+			}
+			if tree.Usage() != vm.Usage() {
+				t.Errorf("usage differs:\n tree: %+v\n   vm: %+v", tree.Usage(), vm.Usage())
+			}
+		})
+	}
+}
+
+func TestBodiesCompileOnTheSecondCall(t *testing.T) {
+	e := newTestContext(EngineVM, Limits{})
+	evaluateSource(t, e, `(set f (fn (x :I) :I (add x 1)))`)
+	if compiledChunk(t, e, "f") != nil {
+		t.Fatal("expected nothing compiled before the first call")
+	}
+
+	evaluateSource(t, e, `(f 1)`)
+	if compiledChunk(t, e, "f") != nil {
+		t.Fatal("expected the first call to be walked")
+	}
+
+	evaluateSource(t, e, `(f 1)`)
+	compiled := compiledChunk(t, e, "f")
+	if compiled == nil {
+		t.Fatal("expected the second call to compile the body")
+	}
+	evaluateSource(t, e, `(f 1)`)
+	if compiledChunk(t, e, "f") != compiled {
+		t.Error("expected later calls to reuse the chunk")
+	}
+
+	// copies of a function share what was compiled for it
+	evaluateSource(t, e, `(set g f)`)
+	if compiledChunk(t, e, "g") != compiled {
+		t.Error("expected a copy of the function to share its chunk")
+	}
+
+	// changing the function groups makes compiled code stale
+	e.AddFunctionGroup(testIntegers{})
+	if compiledChunk(t, e, "f") != nil {
+		t.Fatal("expected adding a group to invalidate the chunk")
+	}
+	if result := evaluateSource(t, e, `(add (f 1) (f 1))`); result.Encode() != "4" {
+		t.Errorf("expected 4, got %s", result.Encode())
+	}
+	if compiledChunk(t, e, "f") == nil {
+		t.Error("expected the body to be compiled again")
+	}
+}
+
+func TestCompiledParametersUseSlots(t *testing.T) {
+	e := newTestContext(EngineVM, Limits{})
+	evaluateSource(t, e, `
+(set f (fn (a :I b :I) :I (add a b)))
+(f 1 2)
+(f 1 2)`)
+
+	compiled := compiledChunk(t, e, "f")
+	if compiled == nil {
+		t.Fatal("expected f to be compiled")
+	}
+	var slots []int32
+	for _, in := range compiled.code {
+		switch in.op {
+		case opLoadLocal:
+			slots = append(slots, in.b)
+		case opLoad:
+			t.Errorf("expected parameters to be loaded from slots, found a load of %s", compiled.consts[in.a].Encode())
+		}
+	}
+	if !slices.Equal(slots, []int32{0, 1}) {
+		t.Errorf("expected loads of slots 0 and 1, got %v", slots)
+	}
+}
+
+func TestScopeMem(t *testing.T) {
+	parent := DefaultMEM()
+	parent.Set("outer", object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}, false)
+
+	function := object.Function{Parameters: []object.Parameter{
+		{Name: "x", Type: object.OBJ_TYPE_INTEGER},
+		{Name: "x", Type: object.OBJ_TYPE_INTEGER},
+		{Name: "y", Type: object.OBJ_TYPE_INTEGER},
+	}}
+	scope := newScopeMem(parent, function)
+	integer := func(n int) object.Obj { return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(n)} }
+
+	if scope.Len() != 0 {
+		t.Fatalf("expected an empty scope, got %d bindings", scope.Len())
+	}
+
+	// as with a map, the last argument bound to a repeated name wins
+	scope.Set("x", integer(1), false)
+	scope.Set("x", integer(2), false)
+	scope.Set("y", integer(3), false)
+	scope.Set("z", integer(4), false)
+	if value, _ := scope.Get("x", false); value.Encode() != "2" {
+		t.Errorf("expected x to be 2, got %s", value.Encode())
+	}
+	if scope.Len() != 3 || len(scope.GetAll()) != 3 {
+		t.Errorf("expected 3 bindings, got %d (%v)", scope.Len(), scope.GetAll())
+	}
+
+	if _, err := scope.Get("outer", false); err == nil {
+		t.Error("expected the parent to be skipped without searchParent")
+	}
+	scope.Set("outer", integer(5), true)
+	if value, _ := parent.Get("outer", false); value.Encode() != "5" {
+		t.Errorf("expected the parent's binding to be set, got %s", value.Encode())
+	}
+
+	scope.Delete("y", false)
+	if _, err := scope.Get("y", false); err == nil {
+		t.Error("expected y to be deleted")
+	}
+	scope.Set("y", integer(6), false)
+	if value, _ := scope.Get("y", false); value.Encode() != "6" || scope.slots[2].Encode() != "6" {
+		t.Errorf("expected y to be bound in its slot again, got %s", value.Encode())
+	}
+
+	child := scope.Fork()
+	if value, err := child.Get("x", true); err != nil || value.Encode() != "2" {
+		t.Errorf("expected a child scope to see x, got %v %v", value, err)
+	}
+}
@@ -2,12 +2,11 @@ package env
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"math/big"
+	"slices"
 	"strings"
 
 	"github.com/bosley/slpx/pkg/slp/object"
-	"github.com/bosley/slpx/pkg/slp/slp"
 )
 
 type coreFunctions struct{}
@@ -54,19 +53,31 @@ func (c *coreFunctions) Functions() map[object.Identifier]EnvFunction {
 			EvaluateArgs: false,
 			Parameters: []EnvParameter{
 				{Name: "expr", Type: object.OBJ_TYPE_ANY},
-				{Name: "handler", Type: object.OBJ_TYPE_ANY},
+				{Name: "handlers", Type: object.OBJ_TYPE_ANY},
 			},
 			ReturnType: object.OBJ_TYPE_ANY,
+			Variadic:   true,
 			Body:       cmdTry,
 		},
+		"throw": {
+			EvaluateArgs: true,
+			Parameters: []EnvParameter{
+				{Name: "code", Type: object.OBJ_TYPE_STRING},
+				{Name: "rest", Type: object.OBJ_TYPE_ANY},
+			},
+			ReturnType: object.OBJ_TYPE_ERROR,
+			Variadic:   true,
+			Body:       cmdThrow,
+		},
 		"do": {
 			EvaluateArgs: false,
 			Parameters: []EnvParameter{
 				{Name: "exprs", Type: object.OBJ_TYPE_ANY},
 			},
-			ReturnType: object.OBJ_TYPE_ANY,
-			Variadic:   true,
-			Body:       cmdDo,
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Variadic:     true,
+			Body:         cmdDo,
+			tailPosition: true,
 		},
 		"drop": {
 			EvaluateArgs: false,
@@ -101,6 +112,57 @@ func (c *coreFunctions) Functions() map[object.Identifier]EnvFunction {
 			Variadic:   true,
 			Body:       cmdUse,
 		},
+		"import": {
+			EvaluateArgs: true,
+			Parameters: []EnvParameter{
+				{Name: "path", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_NONE,
+			Variadic:   true,
+			Body:       cmdImport,
+		},
+		"reload": {
+			EvaluateArgs: true,
+			Parameters: []EnvParameter{
+				{Name: "paths", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_NONE,
+			Variadic:   true,
+			Body:       cmdReload,
+		},
+		"macroexpand": {
+			EvaluateArgs: true,
+			Parameters: []EnvParameter{
+				{Name: "source", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_ANY,
+			Body:       cmdMacroexpand,
+		},
+		"macroexpand1": {
+			EvaluateArgs: true,
+			Parameters: []EnvParameter{
+				{Name: "source", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_ANY,
+			Body:       cmdMacroexpand1,
+		},
+		"macrotrace": {
+			EvaluateArgs: true,
+			Parameters: []EnvParameter{
+				{Name: "source", Type: object.OBJ_TYPE_STRING},
+			},
+			ReturnType: object.OBJ_TYPE_LIST,
+			Body:       cmdMacrotrace,
+		},
+		"export": {
+			EvaluateArgs: false,
+			Parameters: []EnvParameter{
+				{Name: "names", Type: object.OBJ_TYPE_IDENTIFIER},
+			},
+			ReturnType: object.OBJ_TYPE_NONE,
+			Variadic:   true,
+			Body:       cmdExport,
+		},
 		"exit": {
 			EvaluateArgs: false,
 			Parameters: []EnvParameter{
@@ -116,8 +178,9 @@ func (c *coreFunctions) Functions() map[object.Identifier]EnvFunction {
 				{Name: "true_body", Type: object.OBJ_TYPE_ANY},
 				{Name: "false_body", Type: object.OBJ_TYPE_ANY},
 			},
-			ReturnType: object.OBJ_TYPE_ANY,
-			Body:       cmdIf,
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Body:         cmdIf,
+			tailPosition: true,
 		},
 		"match": {
 			EvaluateArgs: false,
@@ -125,9 +188,10 @@ func (c *coreFunctions) Functions() map[object.Identifier]EnvFunction {
 				{Name: "value", Type: object.OBJ_TYPE_ANY},
 				{Name: "patterns", Type: object.OBJ_TYPE_ANY},
 			},
-			ReturnType: object.OBJ_TYPE_ANY,
-			Variadic:   true,
-			Body:       cmdMatch,
+			ReturnType:   object.OBJ_TYPE_ANY,
+			Variadic:     true,
+			Body:         cmdMatch,
+			tailPosition: true,
 		},
 	}
 }
@@ -154,6 +218,12 @@ func cmdSet(ctx EvaluationContext, args object.List) (object.Obj, error) {
 		return object.Obj{}, err
 	}
 
+	if _, err := evalCtx.mem.Get(name, true); err != nil {
+		if errObj, ok := evalCtx.bind(args[0].Pos, 1); !ok {
+			return errObj, nil
+		}
+	}
+
 	evalCtx.mem.Set(name, value, true)
 	return value, nil
 }
@@ -180,12 +250,29 @@ func cmdPutln(ctx EvaluationContext, args object.List) (object.Obj, error) {
 }
 
 func cmdFn(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	function, err := parseFunction(args)
+	if err != nil {
+		return object.Obj{}, err
+	}
+
+	evalCtx := ctx.(*evalCtx)
+
+	return object.Obj{
+		Type: object.OBJ_TYPE_FUNCTION,
+		D:    function,
+		C:    evalCtx.mem,
+	}, nil
+}
+
+// parseFunction reads the parameters, return type, and body of a `fn` form
+// from its raw arguments
+func parseFunction(args object.List) (object.Function, error) {
 	if len(args) < 2 {
-		return object.Obj{}, fmt.Errorf("fn: requires at least 2 arguments (params, body...)")
+		return object.Function{}, fmt.Errorf("fn: requires at least 2 arguments (params, body...)")
 	}
 
 	if args[0].Type != object.OBJ_TYPE_LIST {
-		return object.Obj{}, fmt.Errorf("fn: parameter list must be a list, got %s", args[0].Type)
+		return object.Function{}, fmt.Errorf("fn: parameter list must be a list, got %s", args[0].Type)
 	}
 
 	paramList := args[0].D.(object.List)
@@ -199,13 +286,13 @@ func cmdFn(ctx EvaluationContext, args object.List) (object.Obj, error) {
 			isVariadic = true
 			parameters = []object.Parameter{}
 		} else {
-			return object.Obj{}, fmt.Errorf("fn: single parameter must be '..' for variadic or name-type pair")
+			return object.Function{}, fmt.Errorf("fn: single parameter must be '..' for variadic or name-type pair")
 		}
 	} else if len(paramList) == 0 {
 		parameters = []object.Parameter{}
 	} else {
 		if len(paramList)%2 != 0 {
-			return object.Obj{}, fmt.Errorf("fn: parameters must be name-type pairs")
+			return object.Function{}, fmt.Errorf("fn: parameters must be name-type pairs")
 		}
 
 		parameters = make([]object.Parameter, len(paramList)/2)
@@ -214,10 +301,10 @@ func cmdFn(ctx EvaluationContext, args object.List) (object.Obj, error) {
 			typeObj := paramList[i+1]
 
 			if nameObj.Type != object.OBJ_TYPE_IDENTIFIER {
-				return object.Obj{}, fmt.Errorf("fn: parameter name must be identifier, got %s", nameObj.Type)
+				return object.Function{}, fmt.Errorf("fn: parameter name must be identifier, got %s", nameObj.Type)
 			}
 			if typeObj.Type != object.OBJ_TYPE_IDENTIFIER {
-				return object.Obj{}, fmt.Errorf("fn: parameter type must be identifier, got %s", typeObj.Type)
+				return object.Function{}, fmt.Errorf("fn: parameter type must be identifier, got %s", typeObj.Type)
 			}
 
 			name := nameObj.D.(object.Identifier)
@@ -225,7 +312,7 @@ func cmdFn(ctx EvaluationContext, args object.List) (object.Obj, error) {
 
 			objType, err := object.GetTypeFromIdentifier(typeIdent)
 			if err != nil {
-				return object.Obj{}, err
+				return object.Function{}, err
 			}
 
 			parameters[i/2] = object.Parameter{
@@ -248,69 +335,186 @@ func cmdFn(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	}
 
 	if bodyStartIdx >= len(args) {
-		return object.Obj{}, fmt.Errorf("fn: function body cannot be empty")
+		return object.Function{}, fmt.Errorf("fn: function body cannot be empty")
 	}
 
-	body := args[bodyStartIdx:]
+	return object.Function{
+		Parameters: parameters,
+		ReturnType: returnType,
+		Variadic:   isVariadic,
+		Body:       args[bodyStartIdx:],
+		Code:       &object.Code{},
+	}, nil
+}
 
-	evalCtx := ctx.(*evalCtx)
+/*
+try takes either a single handler, which catches every error:
 
-	return object.Obj{
-		Type: object.OBJ_TYPE_FUNCTION,
-		D: object.Function{
-			Parameters: parameters,
-			ReturnType: returnType,
-			Variadic:   isVariadic,
-			Body:       body,
-		},
-		C: evalCtx.mem,
-	}, nil
+	(try expr handler)
+
+or any number of catch clauses followed by an optional finally clause:
+
+	(try expr
+	    (catch "not_found" "gone" handler)
+	    (catch handler)
+	    (finally cleanup))
+
+A catch clause lists the error codes it handles (none at all handles every
+error) and the first clause that matches runs with $error bound. An error no
+clause matches is the result of the try. The finally clause runs once the rest
+of the try is done, whether or not anything failed; its value is dropped
+unless it is an error, which then replaces the result.
+
+finally also runs when an exit or a cancellation unwinds through the try, and
+the unwinding then carries on whatever finally did. A cancelled evaluation
+stays cancelled while finally runs, so anything it calls fails at once rather
+than outliving the deadline.
+*/
+
+type catchClause struct {
+	codes   []string
+	handler object.Obj
 }
 
-func cmdTry(ctx EvaluationContext, args object.List) (object.Obj, error) {
-	evalCtx := ctx.(*evalCtx)
-	if len(args) != 2 {
-		argPos := uint16(0)
-		if len(args) > 0 {
-			argPos = args[0].Pos
-		}
-		return evalCtx.makeError(argPos, fmt.Sprintf("try: requires 2 arguments, got %d", len(args))), nil
+func (c catchClause) matches(errData object.Error) bool {
+	return len(c.codes) == 0 || slices.Contains(c.codes, errData.Code)
+}
+
+// isTryClause reports whether obj is a (catch ...) or (finally ...) clause
+func isTryClause(obj object.Obj) bool {
+	if obj.Type != object.OBJ_TYPE_LIST {
+		return false
+	}
+	list := obj.D.(object.List)
+	if len(list) == 0 || list[0].Type != object.OBJ_TYPE_IDENTIFIER {
+		return false
 	}
+	head := list[0].D.(object.Identifier)
+	return head == "catch" || head == "finally"
+}
 
-	result, err := ctx.Evaluate(args[0])
-	if err != nil {
-		return object.Obj{}, err
+func (e *evalCtx) parseTryClauses(args object.List) ([]catchClause, *object.Obj, object.Obj, bool) {
+	if len(args) == 1 && !isTryClause(args[0]) {
+		return []catchClause{{handler: args[0]}}, nil, object.Obj{}, true
 	}
 
-	if result.Type == object.OBJ_TYPE_ERROR {
+	var catches []catchClause
+	var finally *object.Obj
+	for _, arg := range args {
+		if !isTryClause(arg) {
+			return nil, nil, e.makeErrorFromObj(arg, fmt.Sprintf("try: expected a (catch ...) or (finally ...) clause, got %s", arg.Type)), false
+		}
+		if finally != nil {
+			return nil, nil, e.makeErrorFromObj(arg, "try: the finally clause must come last"), false
+		}
+
+		clause := arg.D.(object.List)
+		if clause[0].D.(object.Identifier) == "finally" {
+			if len(clause) != 2 {
+				return nil, nil, e.makeErrorFromObj(arg, fmt.Sprintf("try: finally takes 1 expression, got %d", len(clause)-1)), false
+			}
+			finally = &clause[1]
+			continue
+		}
 
-		errorObj := result.D.(object.Error)
-		errorString := object.Obj{
-			Type: object.OBJ_TYPE_STRING,
-			D:    errorObj.Message,
+		if len(clause) < 2 {
+			return nil, nil, e.makeErrorFromObj(arg, "try: catch requires a handler"), false
+		}
+		catch := catchClause{handler: clause[len(clause)-1]}
+		for _, code := range clause[1 : len(clause)-1] {
+			if code.Type != object.OBJ_TYPE_STRING {
+				return nil, nil, e.makeErrorFromObj(code, fmt.Sprintf("try: catch codes must be strings, got %s", code.Type)), false
+			}
+			catch.codes = append(catch.codes, code.D.(string))
 		}
+		catches = append(catches, catch)
+	}
+	return catches, finally, object.Obj{}, true
+}
+
+func cmdTry(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	evalCtx := ctx.(*evalCtx)
+	catches, finally, errObj, ok := evalCtx.parseTryClauses(args[1:])
+	if !ok {
+		return errObj, nil
+	}
+
+	result, err := ctx.Evaluate(args[0])
+
+	if err == nil && result.Type == object.OBJ_TYPE_ERROR {
+		errData := result.D.(object.Error)
+		for _, catch := range catches {
+			if !catch.matches(errData) {
+				continue
+			}
 
-		evalCtx.mem.Set("$error", errorString, false)
+			evalCtx.mem.Set("$error", result, false)
 
-		handlerResult, handlerErr := ctx.Evaluate(args[1])
+			result, err = ctx.Evaluate(catch.handler)
 
-		evalCtx.mem.Delete("$error", false)
+			evalCtx.mem.Delete("$error", false)
+			break
+		}
+	}
 
-		return handlerResult, handlerErr
+	if finally != nil {
+		cleanup, cleanupErr := ctx.Evaluate(*finally)
+		if err != nil {
+			return object.Obj{}, err
+		}
+		if cleanupErr != nil {
+			return object.Obj{}, cleanupErr
+		}
+		if cleanup.Type == object.OBJ_TYPE_ERROR {
+			return cleanup, nil
+		}
 	}
 
+	if err != nil {
+		return object.Obj{}, err
+	}
 	return result, nil
 }
 
+// cmdThrow raises a new error: (throw code message) or (throw code message data)
+func cmdThrow(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	evalCtx := ctx.(*evalCtx)
+	if len(args) > 3 {
+		return evalCtx.makeErrorFromObj(args[3], fmt.Sprintf("throw: takes a code, a message, and optional data, got %d arguments", len(args))), nil
+	}
+	if args[1].Type != object.OBJ_TYPE_STRING {
+		return evalCtx.makeErrorFromObj(args[1], fmt.Sprintf("throw: message must be a string, got %s", args[1].Type)), nil
+	}
+
+	errData := object.Error{
+		Code:    args[0].D.(string),
+		Message: args[1].D.(string),
+	}
+	if len(args) == 3 && args[2].Type != object.OBJ_TYPE_NONE {
+		data := args[2]
+		errData.Data = &data
+	}
+	return object.Obj{Type: object.OBJ_TYPE_ERROR, D: errData}, nil
+}
+
 func cmdDo(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	if len(args) == 0 {
 		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
 	}
 
+	evalCtx := ctx.(*evalCtx)
+
 	var result object.Obj
 	var err error
-	for _, arg := range args {
-		result, err = ctx.Evaluate(arg)
+	for i, arg := range args {
+		if err = CheckCancelled(ctx); err != nil {
+			return object.Obj{}, err
+		}
+		if i == len(args)-1 {
+			result, err = evalCtx.evaluateResult(arg)
+		} else {
+			result, err = ctx.Evaluate(arg)
+		}
 		if err != nil {
 			return object.Obj{}, err
 		}
@@ -325,7 +529,7 @@ func cmdDo(ctx EvaluationContext, args object.List) (object.Obj, error) {
 func cmdDrop(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	evalCtx := ctx.(*evalCtx)
 	if len(args) != 1 {
-		argPos := uint16(0)
+		argPos := object.Span{}
 		if len(args) > 0 {
 			argPos = args[0].Pos
 		}
@@ -337,6 +541,9 @@ func cmdDrop(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	}
 
 	name := args[0].D.(object.Identifier)
+	if _, err := evalCtx.mem.Get(name, true); err == nil {
+		evalCtx.shared.meter.release(1)
+	}
 	evalCtx.mem.Delete(name, true)
 	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
 }
@@ -344,7 +551,7 @@ func cmdDrop(ctx EvaluationContext, args object.List) (object.Obj, error) {
 func cmdQu(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	evalCtx := ctx.(*evalCtx)
 	if len(args) != 1 {
-		argPos := uint16(0)
+		argPos := object.Span{}
 		if len(args) > 0 {
 			argPos = args[0].Pos
 		}
@@ -360,7 +567,7 @@ func cmdQu(ctx EvaluationContext, args object.List) (object.Obj, error) {
 func cmdUq(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	evalCtx := ctx.(*evalCtx)
 	if len(args) != 1 {
-		argPos := uint16(0)
+		argPos := object.Span{}
 		if len(args) > 0 {
 			argPos = args[0].Pos
 		}
@@ -386,7 +593,7 @@ func cmdUq(ctx EvaluationContext, args object.List) (object.Obj, error) {
 func cmdUse(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	evalCtx := ctx.(*evalCtx)
 	if len(args) == 0 {
-		return evalCtx.makeError(0, "use: requires at least 1 argument"), nil
+		return evalCtx.makeError(object.Span{}, "use: requires at least 1 argument"), nil
 	}
 
 	for _, arg := range args {
@@ -394,59 +601,24 @@ func cmdUse(ctx EvaluationContext, args object.List) (object.Obj, error) {
 			return evalCtx.makeErrorFromObj(arg, fmt.Sprintf("use: argument must be string, got %s", arg.Type)), nil
 		}
 
-		filePath := arg.D.(string)
+		fullPath := evalCtx.modules.resolve(evalCtx.fs, evalCtx.currentFilePath, arg.D.(string))
+		abs := evalCtx.absPath(fullPath)
 
-		var fullPath string
-		if filepath.IsAbs(filePath) {
-			fullPath = filePath
-		} else {
-			if evalCtx.currentFilePath != "" {
-				currentDir := filepath.Dir(evalCtx.currentFilePath)
-				fullPath = filepath.Join(currentDir, filePath)
-			} else {
-				fullPath = filePath
-			}
-		}
-
-		absPath, err := filepath.Abs(fullPath)
-		if err != nil {
-			absPath = fullPath
+		if errObj, ok := evalCtx.checkCircular("use", arg, abs); !ok {
+			return errObj, nil
 		}
-
-		if evalCtx.importedFiles[absPath] {
+		if evalCtx.modules.used[abs] {
 			continue
 		}
 
-		evalCtx.importedFiles[absPath] = true
+		evalCtx.modules.used[abs] = true
 
-		content, err := evalCtx.fs.ReadFile(fullPath)
-		if err != nil {
-			return evalCtx.makeErrorFromObj(arg, fmt.Sprintf("use: failed to read file %s: %v", fullPath, err)), nil
-		}
-
-		parser := slp.NewParser(string(content))
-		items, err := parser.ParseAll()
-		if err != nil {
-			return evalCtx.makeErrorFromObj(arg, fmt.Sprintf("use: failed to parse file %s: %v", fullPath, err)), nil
+		result, err := evalCtx.runFile("use", arg, fullPath, abs)
+		if err != nil || result.Type == object.OBJ_TYPE_ERROR {
+			// a file that failed part way is run again if used again
+			delete(evalCtx.modules.used, abs)
+			return result, err
 		}
-
-		previousFilePath := evalCtx.currentFilePath
-		evalCtx.currentFilePath = fullPath
-
-		for itemIdx, item := range items {
-			result, err := ctx.Evaluate(item)
-			if err != nil {
-				evalCtx.currentFilePath = previousFilePath
-				return evalCtx.makeErrorFromObj(item, fmt.Sprintf("use: error evaluating file %s at item %d: %v", fullPath, itemIdx, err)), nil
-			}
-			if result.Type == object.OBJ_TYPE_ERROR {
-				evalCtx.currentFilePath = previousFilePath
-				errObj := result.D.(object.Error)
-				return evalCtx.makeErrorFromObj(item, fmt.Sprintf("use: file %s item %d produced error: %s", fullPath, itemIdx, errObj.Message)), nil
-			}
-		}
-
-		evalCtx.currentFilePath = previousFilePath
 	}
 
 	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
@@ -455,7 +627,7 @@ func cmdUse(ctx EvaluationContext, args object.List) (object.Obj, error) {
 func cmdExit(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	evalCtx := ctx.(*evalCtx)
 	if len(args) != 1 {
-		argPos := uint16(0)
+		argPos := object.Span{}
 		if len(args) > 0 {
 			argPos = args[0].Pos
 		}
@@ -475,25 +647,23 @@ func cmdExit(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	} else {
 		result, err := ctx.Evaluate(arg)
 		if err != nil {
-			os.Exit(1)
+			return object.Obj{}, err
 		}
 
 		if result.Type != object.OBJ_TYPE_INTEGER {
-			os.Exit(1)
+			return object.Obj{}, &ExitError{Code: 1}
 		}
 
 		exitCode = int(result.D.(object.Integer))
 	}
 
-	os.Exit(exitCode)
-
-	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+	return object.Obj{}, &ExitError{Code: exitCode}
 }
 
 func cmdIf(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	evalCtx := ctx.(*evalCtx)
 	if len(args) != 3 {
-		argPos := uint16(0)
+		argPos := object.Span{}
 		if len(args) > 0 {
 			argPos = args[0].Pos
 		}
@@ -516,10 +686,40 @@ func cmdIf(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	condValue := condition.D.(object.Integer)
 
 	if condValue > 0 {
-		return ctx.Evaluate(args[1])
+		return evalCtx.evaluateResult(args[1])
 	}
 
-	return ctx.Evaluate(args[2])
+	return evalCtx.evaluateResult(args[2])
+}
+
+// matchValue reports whether value fits pattern: strings by wildcard, numbers
+// by equality, and maps when every key of the pattern is in the value with a
+// value that fits. Anything else inside a map pattern must be equal
+func matchValue(value, pattern object.Obj) bool {
+	if value.Type != pattern.Type {
+		return false
+	}
+	switch pattern.Type {
+	case object.OBJ_TYPE_STRING:
+		return matchString(value.D.(string), pattern.D.(string))
+	case object.OBJ_TYPE_INTEGER:
+		return value.D.(object.Integer) == pattern.D.(object.Integer)
+	case object.OBJ_TYPE_BIGINT:
+		return value.D.(*big.Int).Cmp(pattern.D.(*big.Int)) == 0
+	case object.OBJ_TYPE_REAL:
+		return value.D.(object.Real) == pattern.D.(object.Real)
+	case object.OBJ_TYPE_MAP:
+		entries := value.D.(*object.Map)
+		for _, entry := range pattern.D.(*object.Map).Entries() {
+			item, found := entries.Get(entry.Key)
+			if !found || !matchValue(item, entry.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return value.Encode() == pattern.Encode()
+	}
 }
 
 func matchString(value, pattern string) bool {
@@ -560,7 +760,7 @@ func matchString(value, pattern string) bool {
 func cmdMatch(ctx EvaluationContext, args object.List) (object.Obj, error) {
 	evalCtx := ctx.(*evalCtx)
 	if len(args) < 2 {
-		argPos := uint16(0)
+		argPos := object.Span{}
 		if len(args) > 0 {
 			argPos = args[0].Pos
 		}
@@ -617,25 +817,18 @@ func cmdMatch(ctx EvaluationContext, args object.List) (object.Obj, error) {
 			continue
 		}
 
-		matched := false
-
 		switch patternValue.Type {
-		case object.OBJ_TYPE_STRING:
-			matched = matchString(valueToMatch.D.(string), patternValue.D.(string))
-		case object.OBJ_TYPE_INTEGER:
-			matched = valueToMatch.D.(object.Integer) == patternValue.D.(object.Integer)
-		case object.OBJ_TYPE_REAL:
-			matched = valueToMatch.D.(object.Real) == patternValue.D.(object.Real)
+		case object.OBJ_TYPE_STRING, object.OBJ_TYPE_INTEGER, object.OBJ_TYPE_BIGINT, object.OBJ_TYPE_REAL, object.OBJ_TYPE_MAP:
 		default:
-			return evalCtx.makeErrorFromObj(patternValue, fmt.Sprintf("match: pattern value must be string, integer, or real, got %s", patternValue.Type)), nil
+			return evalCtx.makeErrorFromObj(patternValue, fmt.Sprintf("match: pattern value must be string, integer, real, or map, got %s", patternValue.Type)), nil
 		}
 
-		if matched {
-			result, err := evalCtx.executeObjectFunction(patternFunc, object.List{valueToMatch})
-			if err != nil {
-				return object.Obj{}, err
+		if matchValue(valueToMatch, patternValue) {
+			frame := evalCtx.frameFor(patternFuncObj)
+			if evalCtx.tailOf != nil {
+				return evalCtx.tailCallTo(frame, patternFunc, object.List{valueToMatch}), nil
 			}
-			return result, nil
+			return evalCtx.callFunction(frame, patternFunc, object.List{valueToMatch})
 		}
 	}
 
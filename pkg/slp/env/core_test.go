@@ -0,0 +1,85 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+	"github.com/bosley/slpx/pkg/slp/slp"
+)
+
+// cancelling is a group whose one function cancels the evaluation it is
+// called from, as a deadline passing mid-call would
+type cancelling struct{ cancel context.CancelFunc }
+
+func (cancelling) Name() string { return "cancel" }
+
+func (c cancelling) Functions() map[object.Identifier]EnvFunction {
+	return map[object.Identifier]EnvFunction{
+		"cancel": {
+			ReturnType: object.OBJ_TYPE_NONE,
+			Body: func(ctx EvaluationContext, args object.List) (object.Obj, error) {
+				c.cancel()
+				return object.Obj{}, CheckCancelled(ctx)
+			},
+		},
+	}
+}
+
+func TestFinallyRunsWhenUnwinding(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		// cleaned is what the finally clauses leave in `cleaned`
+		cleaned string
+		check   func(error) bool
+	}{
+		{"exit_in_expression", `(try (exit 3) (finally (set cleaned 1)))`, "1", func(err error) bool {
+			code, exited := ExitCode(err)
+			return exited && code == 3
+		}},
+		{"exit_in_handler", `(try (add 1 "no") (catch "type" (exit 4)) (finally (set cleaned 1)))`, "1", func(err error) bool {
+			code, exited := ExitCode(err)
+			return exited && code == 4
+		}},
+		{"nested", `(try (try (exit 5) (finally (set cleaned 1))) (finally (set cleaned (add cleaned 1))))`, "2", func(err error) bool {
+			code, exited := ExitCode(err)
+			return exited && code == 5
+		}},
+		{"exit_wins_over_finally", `(try (exit 6) (finally (do (set cleaned 1) (exit 7))))`, "1", func(err error) bool {
+			code, exited := ExitCode(err)
+			return exited && code == 6
+		}},
+		// the evaluation stays cancelled, so finally runs but its calls fail
+		{"cancelled", `(try (cancel) (finally (set cleaned 1)))`, "0", func(err error) bool {
+			return errors.Is(err, ErrCancelled)
+		}},
+	}
+
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				e := newTestContext(engine, Limits{})
+				e.AddFunctionGroup(cancelling{cancel: cancel})
+				evaluateSource(t, e, `(set cleaned 0)`)
+
+				items, err := slp.NewParser(tt.source).ParseAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = e.EvaluateContext(ctx, items[0])
+				if !tt.check(err) {
+					t.Errorf("expected the try to keep unwinding, got %v", err)
+				}
+
+				cleaned, _ := e.mem.Get("cleaned", false)
+				if cleaned.Encode() != tt.cleaned {
+					t.Errorf("expected cleaned to be %s, got %s", tt.cleaned, cleaned.Encode())
+				}
+			})
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package env
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/bosley/slpx/pkg/slp/object"
+	"github.com/bosley/slpx/pkg/slp/slp"
 )
 
 type IdentifiedType string
@@ -37,8 +41,15 @@ type EnvFunction struct {
 	ReturnType   object.ObjType
 	Variadic     bool
 	Body         func(ctx EvaluationContext, args object.List) (object.Obj, error)
+
+	// set for core forms (if, do, match) that pass tail position on to the
+	// expression that produces their result
+	tailPosition bool
 }
 
+// FunctionGroup is a named set of env functions. Functions is called once,
+// when the group is added to a context; a group whose functions change must
+// be added again for the change to be seen
 type FunctionGroup interface {
 	Name() string
 	Functions() map[object.Identifier]EnvFunction
@@ -51,9 +62,41 @@ type EvaluationContext interface {
 	Evaluate(obj object.Obj) (object.Obj, error)
 	Execute(list object.List) (object.Obj, error)
 
+	// EvaluateContext evaluates obj, stopping with an ErrCancelled error as soon
+	// as ctx is done. Context returns the context of the evaluation in progress
+	EvaluateContext(ctx context.Context, obj object.Obj) (object.Obj, error)
+	Context() context.Context
+
+	// Call calls function - a `fn` value, or the identifier of an env function
+	// as evaluating its name gives - with args exactly as they are given: they
+	// are never evaluated. As with Evaluate, SLP errors are the result and the
+	// error is kept for cancellation and exit. CallContext stops with an
+	// ErrCancelled error as soon as ctx is done
+	Call(function object.Obj, args object.List) (object.Obj, error)
+	CallContext(ctx context.Context, function object.Obj, args object.List) (object.Obj, error)
+
+	// Usage reports what has been consumed against the context's Limits
+	Usage() Usage
+	ResetUsage()
+
 	SetCurrentFilePath(path string)
 	GetCurrentFilePath() string
 
+	// ChangedFiles lists the files use and import have run whose modification
+	// time has changed since they last ran, in the order they first ran.
+	// Reload runs one of them again, as the reload command does, and
+	// ReloadContext stops with an ErrCancelled error as soon as ctx is done
+	ChangedFiles() []string
+	Reload(path string) (object.Obj, error)
+	ReloadContext(ctx context.Context, path string) (object.Obj, error)
+
+	// NewParser makes a parser for source, the content of the file at path,
+	// that can import macros from other files with $import. SetMacros tells
+	// the context which macros the code it is about to run was parsed with,
+	// for the macroexpand commands
+	NewParser(source string, path string) *slp.Parser
+	SetMacros(macros map[string]*slp.MacroDef)
+
 	GetRuntime() Runtime
 }
 
@@ -80,6 +123,7 @@ type FS interface {
 	Exists(path string) bool
 	IsDir(path string) bool
 	IsFile(path string) bool
+	ModTime(path string) (time.Time, error)
 	ListDir(path string) ([]string, error)
 	MkDir(path string, perm os.FileMode) error
 	MkDirAll(path string, perm os.FileMode) error
@@ -92,8 +136,40 @@ var (
 	ErrEmptyList           = errors.New("cannot execute empty list")
 	ErrNotCallable         = errors.New("first element of list is not callable")
 	ErrWrongArgCount       = errors.New("wrong number of arguments")
+	ErrCancelled           = errors.New("evaluation cancelled")
+)
+
+// The codes of the errors the interpreter raises itself, so that a script can
+// tell them apart with (catch "code" ...). Function groups give the same codes
+// to the same kinds of failure
+const (
+	ErrorCodeLimit  = "limit"  // a Limits bound or the recursion depth was reached
+	ErrorCodeDenied = "denied" // the Policy refused a function
+	ErrorCodeArity  = "arity"  // a call had the wrong number of arguments
+	ErrorCodeType   = "type"   // an argument or a result had the wrong type
+	ErrorCodeArith  = "arith"  // arithmetic failed, as in a division by zero
 )
 
+// ExitError is the Go error an evaluation returns when it runs `exit`. Like
+// ErrCancelled it unwinds everything in progress; whether the process then
+// ends is up to the host
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit with code %d", e.Code)
+}
+
+// ExitCode reports the code carried by err if it is (or wraps) an ExitError
+func ExitCode(err error) (int, bool) {
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		return exit.Code, true
+	}
+	return 0, false
+}
+
 type MEM interface {
 	Get(key object.Identifier, searchParent bool) (object.Obj, error)
 	Set(key object.Identifier, value object.Obj, searchParent bool) error
@@ -119,7 +195,11 @@ type Runtime interface {
 type EvalBuilder struct {
 	logger *slog.Logger
 
-	maxRecursionDepth int
+	limits Limits
+	engine Engine
+	policy Policy
+
+	modulePath []string
 
 	io  IO
 	fs  FS
@@ -149,11 +229,63 @@ func (x *EvalBuilder) WithMEM(mem MEM) *EvalBuilder {
 	return x
 }
 
+// WithMaxRecursionDepth limits how many calls may be active at once. Exceeding
+// it yields an SLP error rather than exhausting the Go stack. Zero or less
+// selects DefaultMaxRecursionDepth
 func (x *EvalBuilder) WithMaxRecursionDepth(depth int) *EvalBuilder {
-	x.maxRecursionDepth = depth
+	x.limits.MaxRecursionDepth = depth
+	return x
+}
+
+// WithLimits replaces every limit at once (see Limits)
+func (x *EvalBuilder) WithLimits(limits Limits) *EvalBuilder {
+	x.limits = limits
+	return x
+}
+
+func (x *EvalBuilder) WithMaxSteps(steps int64) *EvalBuilder {
+	x.limits.MaxSteps = steps
+	return x
+}
+
+func (x *EvalBuilder) WithMaxBindings(bindings int) *EvalBuilder {
+	x.limits.MaxBindings = bindings
+	return x
+}
+
+func (x *EvalBuilder) WithMaxStringSize(size int) *EvalBuilder {
+	x.limits.MaxStringSize = size
 	return x
 }
 
+func (x *EvalBuilder) WithMaxListSize(size int) *EvalBuilder {
+	x.limits.MaxListSize = size
+	return x
+}
+
+// WithEngine picks how code is run (see Engine.) The default is EngineTree
+func (x *EvalBuilder) WithEngine(engine Engine) *EvalBuilder {
+	x.engine = engine
+	return x
+}
+
+// WithPolicy restricts which env functions can be called (see Policy.) It
+// applies to every group, including those added after Build
+func (x *EvalBuilder) WithPolicy(policy Policy) *EvalBuilder {
+	x.policy = policy
+	return x
+}
+
+// WithModulePath sets the directories `use` and `import` search, in order,
+// for a relative path not found next to the current file
+func (x *EvalBuilder) WithModulePath(dirs []string) *EvalBuilder {
+	x.modulePath = dirs
+	return x
+}
+
+// WithFunctionGroup adds a group of env functions. Groups take precedence in
+// the order they are added, the last one winning; a group that replaces a
+// name without declaring it in its Overrides is logged as a conflict
 func (x *EvalBuilder) WithFunctionGroup(group FunctionGroup) *EvalBuilder {
 	x.functionGroups = append(x.functionGroups, group)
 	return x
@@ -170,45 +302,94 @@ func (x *EvalBuilder) Build() EvaluationContext {
 	if x.mem == nil {
 		x.mem = DefaultMEM()
 	}
-
-	functionGroupsMap := make(map[string]FunctionGroup)
-	for _, group := range x.functionGroups {
-		functionGroupsMap[group.Name()] = group
+	if x.logger == nil {
+		x.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 	}
 
-	return &evalCtx{
+	e := &evalCtx{
+		logger:          x.logger,
 		mem:             x.mem,
 		io:              x.io,
 		fs:              x.fs,
-		functionGroups:  functionGroupsMap,
+		functions:       newFunctionRegistry(x.policy),
 		currentFilePath: "",
-		importedFiles:   make(map[string]bool),
+		modules:         newModuleLoader(x.modulePath),
+		shared: &sharedState{
+			stack: newCallStack(x.limits.MaxRecursionDepth),
+			meter: &meter{
+				limits: x.limits,
+				usage: Usage{
+					Bindings:     x.mem.Len(),
+					PeakBindings: x.mem.Len(),
+				},
+			},
+			ctx:    context.Background(),
+			engine: x.engine,
+		},
+	}
+	for _, group := range x.functionGroups {
+		e.AddFunctionGroup(group)
 	}
+	return e
 }
 
 type evalCtx struct {
+	logger *slog.Logger
+
 	mem MEM
 	io  IO
 	fs  FS
 
-	functionGroups map[string]FunctionGroup
+	functions *functionRegistry
 
 	currentFilePath string
-	importedFiles   map[string]bool
+	modules         *moduleLoader
+
+	// the macros of the code being run (see macros.go)
+	macros map[string]*slp.MacroDef
+
+	// set while a module's top level runs (see modules.go)
+	module *moduleScope
+
+	// set on the short-lived copy handed to a tail-position form (see
+	// inTail); it points back at the context the copy was made from
+	tailOf *evalCtx
+
+	shared *sharedState
+}
+
+// sharedState is common to a root evalCtx and every context forked from it
+type sharedState struct {
+	stack *callStack
+	meter *meter
+
+	ctx  context.Context
+	done <-chan struct{}
+
+	engine Engine
+
+	// the stacks every running chunk shares (see vm.go)
+	operands []object.Obj
+	marks    []mark
+
+	// generation changes whenever compiled code goes stale (see compile.go)
+	generation uint64
 }
 
 var _ EvaluationContext = &evalCtx{}
 var _ Runtime = &evalCtx{}
 
 func (e *evalCtx) AddFunctionGroup(group FunctionGroup) {
-	if e.functionGroups == nil {
-		e.functionGroups = make(map[string]FunctionGroup)
+	for _, conflict := range e.functions.add(group) {
+		e.logger.Warn("function group conflict",
+			"group", conflict.Group, "name", string(conflict.Name), "existing", conflict.Existing)
 	}
-	e.functionGroups[group.Name()] = group
+	e.shared.generation++
 }
 
 func (e *evalCtx) RemoveFunctionGroup(name string) {
-	delete(e.functionGroups, name)
+	e.functions.remove(name)
+	e.shared.generation++
 }
 
 func (e *evalCtx) SetCurrentFilePath(path string) {
@@ -219,12 +400,111 @@ func (e *evalCtx) GetCurrentFilePath() string {
 	return e.currentFilePath
 }
 
-func (e *evalCtx) makeError(pos uint16, message string) object.Obj {
+func (e *evalCtx) fork(mem MEM) *evalCtx {
+	return &evalCtx{
+		logger:          e.logger,
+		mem:             mem,
+		io:              e.io,
+		fs:              e.fs,
+		functions:       e.functions,
+		currentFilePath: e.currentFilePath,
+		modules:         e.modules,
+		macros:          e.macros,
+		shared:          e.shared,
+	}
+}
+
+func (e *evalCtx) EvaluateContext(ctx context.Context, obj object.Obj) (object.Obj, error) {
+	defer e.withContext(ctx)()
+	return e.Evaluate(obj)
+}
+
+// withContext makes ctx the context of the evaluation, returning what puts the
+// previous one back
+func (e *evalCtx) withContext(ctx context.Context) func() {
+	previousCtx, previousDone := e.shared.ctx, e.shared.done
+	e.shared.ctx, e.shared.done = ctx, ctx.Done()
+	return func() {
+		e.shared.ctx, e.shared.done = previousCtx, previousDone
+	}
+}
+
+func (e *evalCtx) CallContext(ctx context.Context, function object.Obj, args object.List) (object.Obj, error) {
+	defer e.withContext(ctx)()
+	return e.Call(function, args)
+}
+
+// Call is a call made from Go rather than from a list, so there is nothing to
+// evaluate: the arguments are already the values the function gets
+func (e *evalCtx) Call(function object.Obj, args object.List) (object.Obj, error) {
+	if err := e.checkCancelled(); err != nil {
+		return object.Obj{}, err
+	}
+
+	if errObj, ok := e.step(function.Pos); !ok {
+		return errObj, nil
+	}
+
+	switch function.Type {
+	case object.OBJ_TYPE_ERROR:
+		return function, nil
+
+	case object.OBJ_TYPE_FUNCTION:
+		return e.callFunction(e.frameFor(function), function, args)
+
+	case object.OBJ_TYPE_IDENTIFIER:
+		ident := function.D.(object.Identifier)
+		envFunction, found := e.lookupEnvFunction(ident)
+		if !found {
+			return e.makeErrorFromObj(function, "function not found: "+string(ident)), nil
+		}
+		return e.callEnvFunction(e.frameFor(function), envFunction, args)
+
+	default:
+		return e.makeErrorFromObj(function, "not callable: "+string(function.Type)), nil
+	}
+}
+
+func (e *evalCtx) Context() context.Context {
+	return e.shared.ctx
+}
+
+// checkCancelled is the evaluator's per-step check; it only does a
+// non-blocking receive so it is cheap enough to run on every call
+func (e *evalCtx) checkCancelled() error {
+	select {
+	case <-e.shared.done:
+		return fmt.Errorf("%w: %w", ErrCancelled, e.shared.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// CheckCancelled reports whether the evaluation ctx belongs to has been
+// cancelled. Env functions that loop (list/map, list/iter, ...) call this
+// between iterations and return the error as-is so it cannot be caught by try
+func CheckCancelled(ctx EvaluationContext) error {
+	if err := ctx.Context().Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCancelled, err)
+	}
+	return nil
+}
+
+func (e *evalCtx) makeError(pos object.Span, message string) object.Obj {
+	return e.makeCodedError(pos, "", message)
+}
+
+func (e *evalCtx) makeCodedError(pos object.Span, code, message string) object.Obj {
+	file := pos.File()
+	if file == "" {
+		file = e.currentFilePath
+	}
 	return object.Obj{
 		Type: object.OBJ_TYPE_ERROR,
 		D: object.Error{
-			File:     e.currentFilePath,
-			Position: int(pos),
+			File:     file,
+			Position: pos,
+			Code:     code,
 			Message:  message,
 		},
 		Pos: pos,
@@ -238,43 +518,103 @@ func (e *evalCtx) makeErrorFromObj(obj object.Obj, message string) object.Obj {
 func (e *evalCtx) Evaluate(obj object.Obj) (object.Obj, error) {
 	switch obj.Type {
 	case object.OBJ_TYPE_NONE, object.OBJ_TYPE_STRING,
-		object.OBJ_TYPE_INTEGER, object.OBJ_TYPE_REAL,
-		object.OBJ_TYPE_ERROR, object.OBJ_TYPE_FUNCTION:
+		object.OBJ_TYPE_INTEGER, object.OBJ_TYPE_BIGINT, object.OBJ_TYPE_REAL,
+		object.OBJ_TYPE_ERROR, object.OBJ_TYPE_FUNCTION,
+		object.OBJ_TYPE_BYTES:
 		return obj, nil
 
 	case object.OBJ_TYPE_SOME:
 		quoted := obj.D.(object.Some)
 		return quoted, nil
 
+	case object.OBJ_TYPE_QUASI:
+		result, _, err := e.expandQuasi(obj.D.(object.Quasi), 1)
+		return result, err
+
+	case object.OBJ_TYPE_UNQUOTE:
+		return e.makeErrorFromObj(obj, "quasiquote: , is only allowed inside a quasiquote"), nil
+
+	case object.OBJ_TYPE_SPLICE:
+		return e.makeErrorFromObj(obj, "quasiquote: ,@ is only allowed inside a list in a quasiquote"), nil
+
 	case object.OBJ_TYPE_IDENTIFIER:
 		ident := obj.D.(object.Identifier)
 		return e.lookupIdentifier(obj, ident)
 
 	case object.OBJ_TYPE_LIST:
-		list := obj.D.(object.List)
-		return e.Execute(list)
+		return e.Execute(obj.D.(object.List))
+
+	case object.OBJ_TYPE_MAP:
+		return e.evaluateMap(obj)
 
 	default:
 		return e.makeErrorFromObj(obj, "unknown object type: "+string(obj.Type)), nil
 	}
 }
 
+// evaluateMap makes a map from a map literal by evaluating its values. Every
+// evaluation makes a new map, so changing one never changes the literal
+func (e *evalCtx) evaluateMap(obj object.Obj) (object.Obj, error) {
+	result := object.NewMap()
+	for _, entry := range obj.D.(*object.Map).Entries() {
+		value, err := e.Evaluate(entry.Value)
+		if err != nil {
+			return object.Obj{}, err
+		}
+		if value.Type == object.OBJ_TYPE_ERROR {
+			return value, nil
+		}
+		result.Set(entry.Key, value)
+	}
+
+	mapObj := object.Obj{Type: object.OBJ_TYPE_MAP, D: result, Pos: obj.Pos}
+	if errObj, ok := e.checkSize(obj.Pos, mapObj); !ok {
+		return errObj, nil
+	}
+	return mapObj, nil
+}
+
 func (e *evalCtx) Execute(list object.List) (object.Obj, error) {
+	return e.execute(list, false)
+}
+
+func (e *evalCtx) execute(list object.List, tail bool) (object.Obj, error) {
+	if e.tailOf != nil {
+		e = e.tailOf
+	}
+
+	if err := e.checkCancelled(); err != nil {
+		return object.Obj{}, err
+	}
+
 	if len(list) == 0 {
 		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
 	}
 
+	if errObj, ok := e.step(list[0].Pos); !ok {
+		return errObj, nil
+	}
+
 	firstEval, err := e.Evaluate(list[0])
 	if err != nil {
 		return object.Obj{}, err
 	}
-	if firstEval.Type == object.OBJ_TYPE_ERROR {
-		return firstEval, nil
-	}
 
+	return e.dispatch(list, firstEval, tail)
+}
+
+// dispatch makes the call described by list once its head has been evaluated
+// to firstEval. The VM comes in here too when it can't use what it compiled
+func (e *evalCtx) dispatch(list object.List, firstEval object.Obj, tail bool) (object.Obj, error) {
 	switch firstEval.Type {
+	case object.OBJ_TYPE_ERROR:
+		return firstEval, nil
+
 	case object.OBJ_TYPE_FUNCTION:
-		return e.executeObjectFunction(firstEval, list[1:])
+		if tail {
+			return e.makeTailCall(e.frameFor(list[0]), firstEval, list[1:])
+		}
+		return e.executeObjectFunction(e.frameFor(list[0]), firstEval, list[1:])
 
 	case object.OBJ_TYPE_IDENTIFIER:
 		ident := firstEval.D.(object.Identifier)
@@ -282,7 +622,10 @@ func (e *evalCtx) Execute(list object.List) (object.Obj, error) {
 		if !found {
 			return e.makeErrorFromObj(list[0], "function not found: "+string(ident)), nil
 		}
-		return e.executeEnvFunction(envFunction, list[1:])
+		if tail && envFunction.tailPosition {
+			return e.inTail().executeEnvFunction(e.frameFor(list[0]), envFunction, list[1:])
+		}
+		return e.executeEnvFunction(e.frameFor(list[0]), envFunction, list[1:])
 
 	default:
 		return e.makeErrorFromObj(list[0], "first element is not callable: "+string(firstEval.Type)), nil
@@ -304,133 +647,177 @@ func (e *evalCtx) lookupIdentifier(identObj object.Obj, ident object.Identifier)
 }
 
 func (e *evalCtx) lookupEnvFunction(ident object.Identifier) (EnvFunction, bool) {
-	for _, group := range e.functionGroups {
-		functions := group.Functions()
-		if function, exists := functions[ident]; exists {
-			return function, true
-		}
-	}
-	return EnvFunction{}, false
+	return e.functions.lookup(ident)
 }
 
-func (e *evalCtx) executeObjectFunction(functionObj object.Obj, args object.List) (object.Obj, error) {
-	function := functionObj.D.(object.Function)
-
-	var childMem MEM
-	if functionObj.C != nil {
-		closureMem := functionObj.C.(MEM)
-		childMem = closureMem.Fork()
-	} else {
-		childMem = e.mem.Fork()
+func (e *evalCtx) executeObjectFunction(frame object.Frame, functionObj object.Obj, args object.List) (object.Obj, error) {
+	evaledArgs, errObj, err := e.evaluateCallArgs(frame, functionObj.D.(object.Function), args)
+	if err != nil {
+		return object.Obj{}, err
 	}
-
-	if function.Variadic {
-		return e.executeVariadicFunction(function, args, childMem)
+	if errObj.Type == object.OBJ_TYPE_ERROR {
+		return errObj, nil
 	}
 
-	return e.executeNormalFunction(function, args, childMem)
+	return e.callFunction(frame, functionObj, evaledArgs)
 }
 
-func (e *evalCtx) executeVariadicFunction(function object.Function, args object.List, childMem MEM) (object.Obj, error) {
+// evaluateCallArgs evaluates the arguments of a call to a user function in
+// the caller's scope. The arity of non-variadic functions is checked first so
+// that a bad call has no side effects
+func (e *evalCtx) evaluateCallArgs(frame object.Frame, function object.Function, args object.List) (object.List, object.Obj, error) {
+	if errObj, ok := e.checkArity(frame, function, args); !ok {
+		return nil, errObj, nil
+	}
+
 	evaledArgs := make(object.List, len(args))
-	firstArgPos := uint16(0)
 	for i, arg := range args {
-		if i == 0 && len(args) > 0 {
-			firstArgPos = args[0].Pos
-		}
 		evaledArg, err := e.Evaluate(arg)
 		if err != nil {
-			return object.Obj{}, err
+			return nil, object.Obj{}, err
 		}
 		if evaledArg.Type == object.OBJ_TYPE_ERROR {
-			return evaledArg, nil
+			return nil, evaledArg, nil
+		}
+		if !arg.Pos.IsZero() {
+			// report problems with the argument where it was written, not
+			// where its value happened to come from
+			evaledArg.Pos = arg.Pos
 		}
 		evaledArgs[i] = evaledArg
 	}
 
-	argsObj := object.Obj{
-		Type: object.OBJ_TYPE_LIST,
-		D:    evaledArgs,
-		Pos:  firstArgPos,
+	return evaledArgs, object.Obj{}, nil
+}
+
+func (e *evalCtx) checkArity(frame object.Frame, function object.Function, args object.List) (object.Obj, bool) {
+	if function.Variadic || len(args) == len(function.Parameters) {
+		return object.Obj{}, true
+	}
+	argPos := frame.Position
+	if len(args) > 0 {
+		argPos = args[0].Pos
 	}
-	childMem.Set("$args", argsObj, false)
+	return e.makeCodedError(argPos, ErrorCodeArity, "wrong number of arguments"), false
+}
 
-	childCtx := &evalCtx{
-		mem:             childMem,
-		io:              e.io,
-		fs:              e.fs,
-		functionGroups:  e.functionGroups,
-		currentFilePath: e.currentFilePath,
-		importedFiles:   e.importedFiles,
+/*
+callFunction runs a user function with arguments that have already been
+evaluated.
+
+The last instruction of a body is evaluated in tail position, so a call made
+there comes back as a tailCall instead of being made (see tail.go.) This loop
+then runs it in place of the current call: the frame is replaced rather than
+pushed and the finished scope is released first, so tail recursion runs in
+constant Go stack and holds a single frame no matter how deep it goes.
+
+Every function that handed its result off this way still has its return type
+checked against the value that finally comes back.
+*/
+func (e *evalCtx) callFunction(frame object.Frame, functionObj object.Obj, args object.List) (object.Obj, error) {
+	if errObj, ok := e.pushFrame(frame); !ok {
+		return errObj, nil
 	}
+	defer e.popFrame()
 
-	var result object.Obj
-	var err error
-	for _, instruction := range function.Body {
-		result, err = childCtx.Evaluate(instruction)
+	var pendingReturnTypes []object.ObjType
+	for {
+		function := functionObj.D.(object.Function)
+
+		result, err := e.runFunction(frame, functionObj, function, args)
 		if err != nil {
 			return object.Obj{}, err
 		}
+
+		if result.Type == objTypeTailCall {
+			if function.ReturnType != object.OBJ_TYPE_ANY && !slices.Contains(pendingReturnTypes, function.ReturnType) {
+				pendingReturnTypes = append(pendingReturnTypes, function.ReturnType)
+			}
+			call := result.D.(tailCall)
+			frame, functionObj, args = call.frame, call.function, call.args
+			e.shared.stack.replace(frame)
+			continue
+		}
+
 		if result.Type == object.OBJ_TYPE_ERROR {
-			return result, nil
+			return e.traced(result), nil
 		}
-	}
 
-	if function.ReturnType != object.OBJ_TYPE_ANY && function.ReturnType != result.Type {
-		resultPos := result.Pos
-		if resultPos == 0 && len(function.Body) > 0 {
-			resultPos = function.Body[len(function.Body)-1].Pos
+		for _, returnType := range append(pendingReturnTypes, function.ReturnType) {
+			if returnType != object.OBJ_TYPE_ANY && returnType != result.Type {
+				resultPos := result.Pos
+				if resultPos.IsZero() && len(function.Body) > 0 {
+					resultPos = function.Body[len(function.Body)-1].Pos
+				}
+				return e.traced(e.makeCodedError(resultPos, ErrorCodeType, fmt.Sprintf("return type mismatch: expected %s, got %s", returnType, result.Type))), nil
+			}
 		}
-		return e.makeError(resultPos, fmt.Sprintf("return type mismatch: expected %s, got %s", function.ReturnType, result.Type)), nil
-	}
 
-	return result, nil
+		return result, nil
+	}
 }
 
-func (e *evalCtx) executeNormalFunction(function object.Function, args object.List, childMem MEM) (object.Obj, error) {
-	if len(args) != len(function.Parameters) {
-		argPos := uint16(0)
-		if len(args) > 0 {
-			argPos = args[0].Pos
-		}
-		return e.makeError(argPos, "wrong number of arguments"), nil
+// runFunction binds args in a fresh scope and runs the body once. The result
+// may be a tailCall, which callFunction is responsible for
+func (e *evalCtx) runFunction(frame object.Frame, functionObj object.Obj, function object.Function, args object.List) (object.Obj, error) {
+	parent := e.mem
+	if functionObj.C != nil {
+		parent = functionObj.C.(MEM)
 	}
+	childMem := newScopeMem(parent, function)
+	defer e.releaseScope(childMem)
 
-	evaledArgs := make(object.List, len(args))
-	for i, arg := range args {
-		evaledArg, err := e.Evaluate(arg)
-		if err != nil {
-			return object.Obj{}, err
+	if errObj, ok := e.checkArity(frame, function, args); !ok {
+		return errObj, nil
+	}
+
+	if function.Variadic {
+		argsObj := object.Obj{
+			Type: object.OBJ_TYPE_LIST,
+			D:    args,
 		}
-		if evaledArg.Type == object.OBJ_TYPE_ERROR {
-			return evaledArg, nil
+		if len(args) > 0 {
+			argsObj.Pos = args[0].Pos
 		}
-		evaledArgs[i] = evaledArg
-	}
+		if errObj, ok := e.bind(frame.Position, 1); !ok {
+			return errObj, nil
+		}
+		childMem.Set("$args", argsObj, false)
+	} else {
+		for i, arg := range args {
+			param := function.Parameters[i]
 
-	for i, arg := range evaledArgs {
-		param := function.Parameters[i]
+			if param.Type != object.OBJ_TYPE_ANY && param.Type != arg.Type {
+				return e.makeCodedError(arg.Pos, ErrorCodeType, fmt.Sprintf("type mismatch for parameter '%s': expected %s, got %s", param.Name, param.Type, arg.Type)), nil
+			}
 
-		if param.Type != object.OBJ_TYPE_ANY && param.Type != arg.Type {
-			return e.makeErrorFromObj(arg, fmt.Sprintf("type mismatch for parameter '%s': expected %s, got %s", param.Name, param.Type, arg.Type)), nil
+			if errObj, ok := e.bind(arg.Pos, 1); !ok {
+				return errObj, nil
+			}
+			childMem.Set(param.Name, arg, false)
 		}
-
-		childMem.Set(param.Name, arg, false)
 	}
 
-	childCtx := &evalCtx{
-		mem:             childMem,
-		io:              e.io,
-		fs:              e.fs,
-		functionGroups:  e.functionGroups,
-		currentFilePath: e.currentFilePath,
-		importedFiles:   e.importedFiles,
+	childCtx := e.fork(childMem)
+
+	if e.shared.engine == EngineVM {
+		if compiled := e.compiledBody(function); compiled != nil {
+			return childCtx.run(compiled)
+		}
 	}
 
 	var result object.Obj
 	var err error
-	for _, instruction := range function.Body {
-		result, err = childCtx.Evaluate(instruction)
+	last := len(function.Body) - 1
+	for i, instruction := range function.Body {
+		if err = childCtx.checkCancelled(); err != nil {
+			return object.Obj{}, err
+		}
+		if i == last {
+			result, err = childCtx.evaluateTail(instruction)
+		} else {
+			result, err = childCtx.Evaluate(instruction)
+		}
 		if err != nil {
 			return object.Obj{}, err
 		}
@@ -439,18 +826,10 @@ func (e *evalCtx) executeNormalFunction(function object.Function, args object.Li
 		}
 	}
 
-	if function.ReturnType != object.OBJ_TYPE_ANY && function.ReturnType != result.Type {
-		resultPos := result.Pos
-		if resultPos == 0 && len(function.Body) > 0 {
-			resultPos = function.Body[len(function.Body)-1].Pos
-		}
-		return e.makeError(resultPos, fmt.Sprintf("return type mismatch: expected %s, got %s", function.ReturnType, result.Type)), nil
-	}
-
 	return result, nil
 }
 
-func (e *evalCtx) executeEnvFunction(function EnvFunction, args object.List) (object.Obj, error) {
+func (e *evalCtx) executeEnvFunction(frame object.Frame, function EnvFunction, args object.List) (object.Obj, error) {
 	evaledArgs := args
 	if function.EvaluateArgs {
 		evaledArgs = make(object.List, len(args))
@@ -462,17 +841,31 @@ func (e *evalCtx) executeEnvFunction(function EnvFunction, args object.List) (ob
 			if evaledArg.Type == object.OBJ_TYPE_ERROR {
 				return evaledArg, nil
 			}
+			if !arg.Pos.IsZero() {
+				evaledArg.Pos = arg.Pos
+			}
 			evaledArgs[i] = evaledArg
 		}
 	}
 
+	return e.callEnvFunction(frame, function, evaledArgs)
+}
+
+// callEnvFunction runs an env function on args that are ready to hand over:
+// evaluated if the function asked for that, raw otherwise
+func (e *evalCtx) callEnvFunction(frame object.Frame, function EnvFunction, evaledArgs object.List) (object.Obj, error) {
+	if errObj, ok := e.pushFrame(frame); !ok {
+		return errObj, nil
+	}
+	defer e.popFrame()
+
 	if len(function.Parameters) > 0 {
 		if errObj := e.validateEnvArgCount(function, evaledArgs); errObj.Type == object.OBJ_TYPE_ERROR {
-			return errObj, nil
+			return e.traced(errObj), nil
 		}
 
 		if errObj := e.validateEnvArgTypes(function, evaledArgs); errObj.Type == object.OBJ_TYPE_ERROR {
-			return errObj, nil
+			return e.traced(errObj), nil
 		}
 	}
 
@@ -480,30 +873,56 @@ func (e *evalCtx) executeEnvFunction(function EnvFunction, args object.List) (ob
 	if err != nil {
 		return object.Obj{}, err
 	}
+	if result.Type == objTypeTailCall {
+		return result, nil
+	}
+
+	return e.envResult(frame, function, result), nil
+}
+
+// envResult checks the result of an env function on its way out of the call.
+// It must run before the call's frame is popped so that errors are traced
+// from inside the call
+func (e *evalCtx) envResult(frame object.Frame, function EnvFunction, result object.Obj) object.Obj {
+	if errObj, ok := e.checkSize(frame.Position, result); !ok {
+		return e.traced(errObj)
+	}
+
+	if result.Type == object.OBJ_TYPE_ERROR {
+		// env functions build their errors without knowing where they were
+		// called from, so anchor them to the call site
+		if errData := result.D.(object.Error); errData.Position.IsZero() && !frame.Position.IsZero() {
+			anchored := e.makeError(frame.Position, errData.Message)
+			errData.File, errData.Position = anchored.D.(object.Error).File, frame.Position
+			anchored.D = errData
+			result = anchored
+		}
+		return e.traced(result)
+	}
 
 	if function.ReturnType != "" && function.ReturnType != object.OBJ_TYPE_ANY {
-		if errObj := e.validateEnvReturnType(function, result); errObj.Type == object.OBJ_TYPE_ERROR {
-			return errObj, nil
+		if errObj := e.validateEnvReturnType(frame.Position, function, result); errObj.Type == object.OBJ_TYPE_ERROR {
+			return e.traced(errObj)
 		}
 	}
 
-	return result, nil
+	return result
 }
 
 func (e *evalCtx) validateEnvArgCount(fn EnvFunction, args object.List) object.Obj {
 	minArgs := len(fn.Parameters)
-	argPos := uint16(0)
+	argPos := object.Span{}
 	if len(args) > 0 {
 		argPos = args[0].Pos
 	}
 
 	if fn.Variadic {
 		if len(args) < minArgs {
-			return e.makeError(argPos, fmt.Sprintf("insufficient arguments: expected at least %d, got %d", minArgs, len(args)))
+			return e.makeCodedError(argPos, ErrorCodeArity, fmt.Sprintf("insufficient arguments: expected at least %d, got %d", minArgs, len(args)))
 		}
 	} else {
 		if len(args) != minArgs {
-			return e.makeError(argPos, fmt.Sprintf("wrong number of arguments: expected %d, got %d", minArgs, len(args)))
+			return e.makeCodedError(argPos, ErrorCodeArity, fmt.Sprintf("wrong number of arguments: expected %d, got %d", minArgs, len(args)))
 		}
 	}
 
@@ -511,7 +930,7 @@ func (e *evalCtx) validateEnvArgCount(fn EnvFunction, args object.List) object.O
 }
 
 func (e *evalCtx) validateEnvArgTypes(fn EnvFunction, args object.List) object.Obj {
-	argPos := uint16(0)
+	argPos := object.Span{}
 	if len(args) > 0 {
 		argPos = args[0].Pos
 	}
@@ -524,7 +943,7 @@ func (e *evalCtx) validateEnvArgTypes(fn EnvFunction, args object.List) object.O
 		arg := args[i]
 
 		if param.Type != object.OBJ_TYPE_ANY && param.Type != arg.Type {
-			return e.makeErrorFromObj(arg, fmt.Sprintf("type mismatch for parameter '%s': expected %s, got %s", param.Name, param.Type, arg.Type))
+			return e.makeCodedError(arg.Pos, ErrorCodeType, fmt.Sprintf("type mismatch for parameter '%s': expected %s, got %s", param.Name, param.Type, arg.Type))
 		}
 	}
 
@@ -533,7 +952,7 @@ func (e *evalCtx) validateEnvArgTypes(fn EnvFunction, args object.List) object.O
 		for i := len(fn.Parameters); i < len(args); i++ {
 			arg := args[i]
 			if lastParam.Type != object.OBJ_TYPE_ANY && lastParam.Type != arg.Type {
-				return e.makeErrorFromObj(arg, fmt.Sprintf("type mismatch for variadic parameter '%s' at position %d: expected %s, got %s", lastParam.Name, i, lastParam.Type, arg.Type))
+				return e.makeCodedError(arg.Pos, ErrorCodeType, fmt.Sprintf("type mismatch for variadic parameter '%s' at position %d: expected %s, got %s", lastParam.Name, i, lastParam.Type, arg.Type))
 			}
 		}
 	}
@@ -541,13 +960,19 @@ func (e *evalCtx) validateEnvArgTypes(fn EnvFunction, args object.List) object.O
 	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: argPos}
 }
 
-func (e *evalCtx) validateEnvReturnType(fn EnvFunction, result object.Obj) object.Obj {
+// validateEnvReturnType checks the result of an env function, blaming the call
+// at callPos when the result was made without a position
+func (e *evalCtx) validateEnvReturnType(callPos object.Span, fn EnvFunction, result object.Obj) object.Obj {
 	if result.Type == object.OBJ_TYPE_ERROR {
 		return result
 	}
 
 	if fn.ReturnType != result.Type {
-		return e.makeErrorFromObj(result, fmt.Sprintf("return type mismatch: expected %s, got %s", fn.ReturnType, result.Type))
+		pos := result.Pos
+		if pos.IsZero() {
+			pos = callPos
+		}
+		return e.makeCodedError(pos, ErrorCodeType, fmt.Sprintf("return type mismatch: expected %s, got %s", fn.ReturnType, result.Type))
 	}
 
 	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: result.Pos}
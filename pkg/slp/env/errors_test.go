@@ -0,0 +1,71 @@
+package env
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		limits Limits
+		policy Policy
+		source string
+	}{
+		{"steps", ErrorCodeLimit, Limits{MaxSteps: 20}, Policy{}, `
+(set count (fn (n :I) :I (if (eq n 0) 0 (count (sub n 1)))))
+(try (count 100) (catch "limit" "caught"))`},
+		{"recursion", ErrorCodeLimit, Limits{MaxRecursionDepth: 10}, Policy{}, `
+(set down (fn (n :I) :I (if (eq n 0) 0 (add 1 (down (sub n 1))))))
+(try (down 100) (catch "limit" "caught"))`},
+		{"denied", ErrorCodeDenied, Limits{}, Policy{}.With(DenyFunction("sub")), `
+(try (sub 2 1) (catch "denied" "caught"))`},
+		{"env_function_arity", ErrorCodeArity, Limits{}, Policy{}, `
+(try (add 1) (catch "arity" "caught"))`},
+		{"variadic_env_function_arity", ErrorCodeArity, Limits{}, Policy{}, `
+(try (throw "code") (catch "arity" "caught"))`},
+		{"lambda_arity", ErrorCodeArity, Limits{}, Policy{}, `
+(set f (fn (x :I) :I x))
+(try (f 1 2) (catch "arity" "caught"))`},
+		{"env_function_type", ErrorCodeType, Limits{}, Policy{}, `
+(try (add 1 "two") (catch "type" "caught"))`},
+		{"parameter_type", ErrorCodeType, Limits{}, Policy{}, `
+(set f (fn (x :I) :I x))
+(try (f "one") (catch "type" "caught"))`},
+		{"return_type", ErrorCodeType, Limits{}, Policy{}, `
+(set f (fn (x :I) :S x))
+(try (f 1) (catch "type" "caught"))`},
+	}
+
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				newContext := func() *evalCtx {
+					return NewEvalBuilder(nil).
+						WithEngine(engine).
+						WithLimits(tt.limits).
+						WithPolicy(tt.policy).
+						WithFunctionGroup(NewCoreFunctions()).
+						WithFunctionGroup(testIntegers{}).
+						Build().(*evalCtx)
+				}
+
+				if result := evaluateSource(t, newContext(), tt.source); result.Encode() != `"caught"` {
+					t.Fatalf("expected the error to be caught by its code, got %s", result.Encode())
+				}
+
+				// a handler for any other code lets it through, code and all
+				uncaught := evaluateSource(t, newContext(), strings.ReplaceAll(tt.source, `(catch "`+tt.code+`"`, `(catch "other"`))
+				if uncaught.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected the error to pass the other handler, got %s", uncaught.Encode())
+				}
+				if code := uncaught.D.(object.Error).Code; code != tt.code {
+					t.Errorf("expected the code %q, got %q", tt.code, code)
+				}
+			})
+		}
+	}
+}
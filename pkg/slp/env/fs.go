@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type fsImpl struct {
@@ -78,6 +79,15 @@ func (f *fsImpl) IsFile(path string) bool {
 	return !info.IsDir()
 }
 
+func (f *fsImpl) ModTime(path string) (time.Time, error) {
+	fullPath := f.resolvePath(path)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
 func (f *fsImpl) ListDir(path string) ([]string, error) {
 	fullPath := f.resolvePath(path)
 	entries, err := os.ReadDir(fullPath)
@@ -0,0 +1,287 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+/*
+GoFunction makes an env function out of an ordinary Go func, taking its
+parameter and return types from the func's signature and converting values
+with object.Unmarshal and object.Marshal:
+
+	bool, int*, uint8-32     :I   (a bool is 1 or 0, as the core's predicates give)
+	uint, uint64, uintptr    :*   an integer of either size, :Z past the int64 range
+	float32, float64         :R
+	string                   :S
+	[]byte                   :B
+	big.Int, *big.Int        :*   an integer of either size, :I or :Z
+	object.Identifier        identifier
+	slices                   :L
+	maps, structs            :M   an argument may also be a list of (key value) pairs
+	object.Obj, any, *T      :*
+
+A first parameter of type context.Context is not an argument; it is given the
+context of the evaluation so that long running Go code can stop when it is
+cancelled. A variadic func becomes a variadic function, which like every other
+takes at least one argument for its last parameter.
+
+The func may return nothing, a value, an error, or a value and then an error.
+A non-nil error becomes an SLP error (so scripts can `try` it) and so does an
+argument that cannot be converted, such as an integer too big for an int8, and
+a panic in the func.
+
+	group, err := env.NewGoFunctions("geo", map[object.Identifier]any{
+		"geo/distance": func(x1, y1, x2, y2 float64) float64 { ... },
+		"geo/lookup":   func(ctx context.Context, name string) ([]float64, error) { ... },
+	})
+*/
+func GoFunction(fn any) (EnvFunction, error) {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return EnvFunction{}, fmt.Errorf("expected a func, got %T", fn)
+	}
+	signature := value.Type()
+
+	first := 0
+	takesContext := signature.NumIn() > 0 && signature.In(0) == contextType
+	if takesContext {
+		first = 1
+	}
+
+	var parameters []EnvParameter
+	for i := first; i < signature.NumIn(); i++ {
+		in := signature.In(i)
+		if signature.IsVariadic() && i == signature.NumIn()-1 {
+			in = in.Elem()
+		}
+		objType, err := goObjType(in)
+		if err != nil {
+			return EnvFunction{}, fmt.Errorf("parameter %d: %w", i+1, err)
+		}
+		// object.Unmarshal fills these from a map as well as from pairs
+		if in.Kind() == reflect.Map || in.Kind() == reflect.Struct {
+			objType = object.OBJ_TYPE_ANY
+		}
+		parameters = append(parameters, EnvParameter{
+			Name: fmt.Sprintf("arg%d", i-first+1),
+			Type: objType,
+		})
+	}
+
+	returnsError := signature.NumOut() > 0 && signature.Out(signature.NumOut()-1) == errorType
+	returnType := object.OBJ_TYPE_NONE
+	switch {
+	case signature.NumOut() == 0, signature.NumOut() == 1 && returnsError:
+	case signature.NumOut() == 1 || signature.NumOut() == 2 && returnsError:
+		objType, err := goObjType(signature.Out(0))
+		if err != nil {
+			return EnvFunction{}, fmt.Errorf("result: %w", err)
+		}
+		returnType = objType
+	default:
+		return EnvFunction{}, fmt.Errorf("expected a value, an error, or a value and an error as results, got %s", signature)
+	}
+
+	body := func(ctx EvaluationContext, args object.List) (object.Obj, error) {
+		// the call has only checked the count when there are parameters
+		if len(parameters) == 0 && len(args) > 0 {
+			return goError(ErrorCodeArity, fmt.Sprintf("wrong number of arguments: expected 0, got %d", len(args))), nil
+		}
+
+		in := make([]reflect.Value, 0, first+len(args))
+		if takesContext {
+			in = append(in, reflect.ValueOf(ctx.Context()))
+		}
+		for i, arg := range args {
+			index := min(first+i, signature.NumIn()-1)
+			want := signature.In(index)
+			if signature.IsVariadic() && index == signature.NumIn()-1 {
+				want = want.Elem()
+			}
+			converted := reflect.New(want)
+			if err := object.Unmarshal(arg, converted.Interface()); err != nil {
+				return argumentError(i+1, err), nil
+			}
+			in = append(in, converted.Elem())
+		}
+
+		out, err := call(value, in)
+		if err != nil {
+			return goError("", err.Error()), nil
+		}
+
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				// a func that gave up because the evaluation was cancelled must
+				// not turn the cancellation into something try can catch
+				if cancelled := CheckCancelled(ctx); cancelled != nil {
+					return object.Obj{}, cancelled
+				}
+				return goError("", err.Error()), nil
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+		}
+
+		result, err := object.Marshal(out[0].Interface())
+		if err != nil {
+			return goError("", fmt.Sprintf("result: %s", err)), nil
+		}
+		return result, nil
+	}
+
+	return EnvFunction{
+		EvaluateArgs: true,
+		Parameters:   parameters,
+		ReturnType:   returnType,
+		Variadic:     signature.IsVariadic(),
+		Body:         body,
+	}, nil
+}
+
+type goFunctions struct {
+	name      string
+	functions map[object.Identifier]EnvFunction
+}
+
+// NewGoFunctions is a function group made of Go funcs, each turned into an env
+// function by GoFunction. It fails on the first func (by name) that GoFunction
+// can't take
+func NewGoFunctions(name string, funcs map[object.Identifier]any) (FunctionGroup, error) {
+	group := &goFunctions{
+		name:      name,
+		functions: make(map[object.Identifier]EnvFunction, len(funcs)),
+	}
+
+	names := make([]object.Identifier, 0, len(funcs))
+	for ident := range funcs {
+		names = append(names, ident)
+	}
+	slices.Sort(names)
+
+	for _, ident := range names {
+		function, err := GoFunction(funcs[ident])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ident, err)
+		}
+		group.functions[ident] = function
+	}
+	return group, nil
+}
+
+func (g *goFunctions) Name() string {
+	return g.name
+}
+
+func (g *goFunctions) Functions() map[object.Identifier]EnvFunction {
+	return g.functions
+}
+
+var (
+	contextType    = reflect.TypeFor[context.Context]()
+	errorType      = reflect.TypeFor[error]()
+	objType        = reflect.TypeFor[object.Obj]()
+	identifierType = reflect.TypeFor[object.Identifier]()
+	functionType   = reflect.TypeFor[object.Function]()
+	bigIntType     = reflect.TypeFor[big.Int]()
+)
+
+// goObjType is the SLP type that stands for Go type t, as object.Marshal
+// converts it
+func goObjType(t reflect.Type) (object.ObjType, error) {
+	switch t {
+	case objType:
+		return object.OBJ_TYPE_ANY, nil
+	case identifierType:
+		return object.OBJ_TYPE_IDENTIFIER, nil
+	case functionType:
+		return object.OBJ_TYPE_FUNCTION, nil
+	case bigIntType:
+		return object.OBJ_TYPE_ANY, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return object.OBJ_TYPE_INTEGER, nil
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		// a bigint past the int64 range, so either size of integer
+		return object.OBJ_TYPE_ANY, nil
+	case reflect.Float32, reflect.Float64:
+		return object.OBJ_TYPE_REAL, nil
+	case reflect.String:
+		return object.OBJ_TYPE_STRING, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return object.OBJ_TYPE_BYTES, nil
+		}
+		if _, err := goObjType(t.Elem()); err != nil {
+			return "", err
+		}
+		return object.OBJ_TYPE_LIST, nil
+	case reflect.Map:
+		if _, err := goObjType(t.Key()); err != nil {
+			return "", err
+		}
+		if _, err := goObjType(t.Elem()); err != nil {
+			return "", err
+		}
+		return object.OBJ_TYPE_MAP, nil
+	case reflect.Struct:
+		return object.OBJ_TYPE_MAP, nil
+	case reflect.Pointer:
+		// none when nil, so the type can't be promised
+		if _, err := goObjType(t.Elem()); err != nil {
+			return "", err
+		}
+		return object.OBJ_TYPE_ANY, nil
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return object.OBJ_TYPE_ANY, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type %s", t)
+}
+
+// call calls the func, turning a panic in it into an error so that a bug in a
+// registered func fails the call rather than the whole interpreter
+func call(value reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return value.Call(in), nil
+}
+
+// argumentError names the argument that failed to convert, and the place in it
+// when that is deeper: argument 2[0].port
+func argumentError(n int, err error) object.Obj {
+	where, message := fmt.Sprintf("argument %d", n), err.Error()
+	var marshalErr *object.MarshalError
+	if errors.As(err, &marshalErr) && marshalErr.Path != "" {
+		if !strings.HasPrefix(marshalErr.Path, "[") {
+			where += "."
+		}
+		where, message = where+marshalErr.Path, marshalErr.Message
+	}
+	return goError(ErrorCodeType, where+": "+message)
+}
+
+func goError(code, message string) object.Obj {
+	return object.Obj{
+		Type: object.OBJ_TYPE_ERROR,
+		D:    object.Error{Code: code, Message: message},
+	}
+}
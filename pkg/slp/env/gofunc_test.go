@@ -0,0 +1,107 @@
+package env
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+func TestGoFunctionPanics(t *testing.T) {
+	group, err := NewGoFunctions("go", map[object.Identifier]any{
+		"go/index": func(items []int64, i int) int64 { return items[i] },
+		"go/fail":  func() { panic("gave up") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{`(go/index '(1 2) 5)`, "panic: runtime error: index out of range"},
+		{`(go/fail)`, "panic: gave up"},
+	}
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		e := newTestContext(engine, Limits{})
+		e.AddFunctionGroup(group)
+		for _, tt := range tests {
+			result := evaluateSource(t, e, tt.source)
+			if result.Type != object.OBJ_TYPE_ERROR {
+				t.Fatalf("%s: expected an error, got %s", tt.source, result.Encode())
+			}
+			if message := result.D.(object.Error).Message; !strings.Contains(message, tt.message) {
+				t.Errorf("%s: expected the error to mention %q, got %q", tt.source, tt.message, message)
+			}
+		}
+
+		// the panic is an error like any other, and the interpreter carries on
+		caught := evaluateSource(t, e, `(try (go/fail) (add 1 1))`)
+		if caught.Encode() != "2" {
+			t.Errorf("expected the panic to be caught, got %s", caught.Encode())
+		}
+	}
+}
+
+func TestGoFunctionUnsigned(t *testing.T) {
+	group, err := NewGoFunctions("go", map[object.Identifier]any{
+		"go/max":  func() uint64 { return math.MaxUint64 },
+		"go/echo": func(n uint64) uint64 { return n },
+		"go/word": func(n uint) uint { return n },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source   string
+		expected string
+		objType  object.ObjType
+	}{
+		{`(go/max)`, "18446744073709551615", object.OBJ_TYPE_BIGINT},
+		{`(go/echo (go/max))`, "18446744073709551615", object.OBJ_TYPE_BIGINT},
+		{`(go/echo 5)`, "5", object.OBJ_TYPE_INTEGER},
+		{`(go/word 5)`, "5", object.OBJ_TYPE_INTEGER},
+	}
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		e := newTestContext(engine, Limits{})
+		e.AddFunctionGroup(group)
+		for _, tt := range tests {
+			result := evaluateSource(t, e, tt.source)
+			if result.Type != tt.objType || result.Encode() != tt.expected {
+				t.Errorf("%s: expected %s %s, got %s %s", tt.source, tt.objType, tt.expected, result.Type, result.Encode())
+			}
+		}
+		if result := evaluateSource(t, e, `(go/echo (sub 0 1))`); result.Type != object.OBJ_TYPE_ERROR {
+			t.Errorf("expected a negative argument to be refused, got %s", result.Encode())
+		}
+	}
+}
+
+// the type a func's signature promises is the type its results marshal to
+func TestGoObjTypeAgreesWithMarshal(t *testing.T) {
+	values := []any{
+		true, int16(1), uint32(1), 1.5, "s", []byte{1}, object.Identifier("x"),
+		[]int{1}, [2]string{"a", "b"},
+		map[string]int{"a": 1},
+		struct {
+			X int `slpx:"x"`
+		}{X: 1},
+	}
+	for _, value := range values {
+		objType, err := goObjType(reflect.TypeOf(value))
+		if err != nil {
+			t.Fatalf("%T: %v", value, err)
+		}
+		marshalled, err := object.Marshal(value)
+		if err != nil {
+			t.Fatalf("%T: %v", value, err)
+		}
+		if objType != marshalled.Type {
+			t.Errorf("%T: signature says %s, but it marshals to %s", value, objType, marshalled.Type)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrOutsideJail is the error (inside an *fs.PathError) for a path that a
+// jailed FS will not touch
+var ErrOutsideJail = errors.New("path is outside of the jail")
+
+/*
+jailFS is the host filesystem confined to one directory. Paths keep their
+host meaning, so a session's file path and `use` work unchanged, but any path
+that leads out of the root is refused: absolute paths elsewhere, `..` past the
+root, and symlinks inside the root that point outside of it.
+*/
+type jailFS struct {
+	root string
+	disk *fsImpl
+}
+
+var _ FS = &jailFS{}
+
+// NewJailedFS confines the host filesystem to root, which must be an existing
+// directory. It is also the initial working directory
+func NewJailedFS(root string) (FS, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("jail root %s is not a directory", root)
+	}
+	return &jailFS{root: resolved, disk: &fsImpl{workingDir: resolved}}, nil
+}
+
+// maxLinks bounds how many symlinks one path may pass through
+const maxLinks = 255
+
+var errTooManyLinks = errors.New("too many levels of symbolic links")
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolve returns the host path that path really leads to, or an error if that
+// is outside of the jail. Symlinks are read one component at a time, dangling
+// ones included, so a link to a file that does not exist yet cannot be used to
+// create it elsewhere. The result has no symlinks left in it, except the last
+// component when follow is false, so that removing a link removes the link
+func (f *jailFS) resolve(op, path string, follow bool) (string, error) {
+	fullPath := filepath.Clean(f.disk.resolvePath(path))
+	volume := filepath.VolumeName(fullPath)
+	resolved := volume + string(filepath.Separator)
+	pending := splitPath(fullPath[len(volume):])
+
+	links := 0
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(next)
+		if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return "", pathError(op, path, err)
+		}
+		if err != nil || info.Mode()&os.ModeSymlink == 0 || (len(pending) == 0 && !follow) {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxLinks {
+			return "", pathError(op, path, errTooManyLinks)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", pathError(op, path, err)
+		}
+		if filepath.IsAbs(target) {
+			volume = filepath.VolumeName(target)
+			resolved = volume + string(filepath.Separator)
+			target = target[len(volume):]
+		}
+		pending = append(splitPath(target), pending...)
+	}
+
+	if !within(f.root, resolved) {
+		return "", pathError(op, path, ErrOutsideJail)
+	}
+	return resolved, nil
+}
+
+func (f *jailFS) ReadFile(path string) ([]byte, error) {
+	fullPath, err := f.resolve("open", path, true)
+	if err != nil {
+		return nil, err
+	}
+	return f.disk.ReadFile(fullPath)
+}
+
+func (f *jailFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	fullPath, err := f.resolve("open", path, true)
+	if err != nil {
+		return err
+	}
+	return f.disk.WriteFile(fullPath, data, perm)
+}
+
+func (f *jailFS) AppendFile(path string, data []byte) error {
+	fullPath, err := f.resolve("open", path, true)
+	if err != nil {
+		return err
+	}
+	return f.disk.AppendFile(fullPath, data)
+}
+
+func (f *jailFS) DeleteFile(path string) error {
+	fullPath, err := f.resolve("remove", path, false)
+	if err != nil {
+		return err
+	}
+	return f.disk.DeleteFile(fullPath)
+}
+
+func (f *jailFS) RemoveDir(path string) error {
+	fullPath, err := f.resolve("remove", path, false)
+	if err != nil {
+		return err
+	}
+	if fullPath == f.root {
+		return pathError("remove", path, ErrOutsideJail)
+	}
+	return f.disk.RemoveDir(fullPath)
+}
+
+func (f *jailFS) RemoveDirAll(path string) error {
+	fullPath, err := f.resolve("remove", path, false)
+	if err != nil {
+		return err
+	}
+	if fullPath == f.root {
+		return pathError("remove", path, ErrOutsideJail)
+	}
+	return f.disk.RemoveDirAll(fullPath)
+}
+
+func (f *jailFS) Exists(path string) bool {
+	fullPath, err := f.resolve("stat", path, true)
+	return err == nil && f.disk.Exists(fullPath)
+}
+
+func (f *jailFS) IsDir(path string) bool {
+	fullPath, err := f.resolve("stat", path, true)
+	return err == nil && f.disk.IsDir(fullPath)
+}
+
+func (f *jailFS) IsFile(path string) bool {
+	fullPath, err := f.resolve("stat", path, true)
+	return err == nil && f.disk.IsFile(fullPath)
+}
+
+func (f *jailFS) ModTime(path string) (time.Time, error) {
+	fullPath, err := f.resolve("stat", path, true)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return f.disk.ModTime(fullPath)
+}
+
+func (f *jailFS) ListDir(path string) ([]string, error) {
+	fullPath, err := f.resolve("open", path, true)
+	if err != nil {
+		return nil, err
+	}
+	return f.disk.ListDir(fullPath)
+}
+
+func (f *jailFS) MkDir(path string, perm os.FileMode) error {
+	fullPath, err := f.resolve("mkdir", path, true)
+	if err != nil {
+		return err
+	}
+	return f.disk.MkDir(fullPath, perm)
+}
+
+func (f *jailFS) MkDirAll(path string, perm os.FileMode) error {
+	fullPath, err := f.resolve("mkdir", path, true)
+	if err != nil {
+		return err
+	}
+	return f.disk.MkDirAll(fullPath, perm)
+}
+
+func (f *jailFS) WorkingDir() string {
+	return f.disk.WorkingDir()
+}
+
+func (f *jailFS) SetWorkingDir(path string) error {
+	fullPath, err := f.resolve("chdir", path, true)
+	if err != nil {
+		return err
+	}
+	return f.disk.SetWorkingDir(fullPath)
+}
@@ -0,0 +1,141 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestJail(t *testing.T) (jail FS, root, outside string) {
+	t.Helper()
+	outside = t.TempDir()
+	root = t.TempDir()
+	jail, err := NewJailedFS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jail, jail.WorkingDir(), outside
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("cannot make symlinks here: %v", err)
+	}
+}
+
+func TestJailRefusesPathsOutside(t *testing.T) {
+	jail, root, outside := newTestJail(t)
+	symlink(t, outside, filepath.Join(root, "escape"))
+
+	for _, path := range []string{
+		filepath.Join(outside, "x.txt"),
+		"../x.txt",
+		"nested/../../x.txt",
+		"escape/x.txt",
+	} {
+		if err := jail.WriteFile(path, []byte("x"), 0644); !errors.Is(err, ErrOutsideJail) {
+			t.Errorf("expected %s to be refused, got %v", path, err)
+		}
+	}
+	if err := jail.RemoveDirAll("."); !errors.Is(err, ErrOutsideJail) {
+		t.Errorf("expected removing the root to be refused, got %v", err)
+	}
+	if err := jail.SetWorkingDir(".."); !errors.Is(err, ErrOutsideJail) {
+		t.Errorf("expected leaving the root to be refused, got %v", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("expected nothing written outside the jail, got %v", entries)
+	}
+}
+
+func TestJailRefusesDanglingSymlinksOutside(t *testing.T) {
+	jail, root, outside := newTestJail(t)
+	target := filepath.Join(outside, "pwned.txt")
+	symlink(t, target, filepath.Join(root, "link"))
+	symlink(t, filepath.Join(outside, "dir"), filepath.Join(root, "dirlink"))
+	// a chain whose last hop dangles outside
+	symlink(t, "link", filepath.Join(root, "chain"))
+
+	for _, path := range []string{"link", "chain"} {
+		if err := jail.WriteFile(path, []byte("x"), 0644); !errors.Is(err, ErrOutsideJail) {
+			t.Errorf("expected writing %s to be refused, got %v", path, err)
+		}
+		if err := jail.AppendFile(path, []byte("x")); !errors.Is(err, ErrOutsideJail) {
+			t.Errorf("expected appending to %s to be refused, got %v", path, err)
+		}
+	}
+	if err := jail.MkDir("dirlink", 0755); !errors.Is(err, ErrOutsideJail) {
+		t.Errorf("expected making dirlink to be refused, got %v", err)
+	}
+	if err := jail.MkDirAll("dirlink/nested", 0755); !errors.Is(err, ErrOutsideJail) {
+		t.Errorf("expected making beneath dirlink to be refused, got %v", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("expected nothing created outside the jail, got %v", entries)
+	}
+
+	// the link itself is inside, so it may be removed, leaving its target alone
+	if err := jail.DeleteFile("link"); err != nil {
+		t.Fatalf("expected the link to be removed, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "link")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the link to be gone, got %v", err)
+	}
+}
+
+func TestJailFollowsSymlinksInside(t *testing.T) {
+	jail, root, _ := newTestJail(t)
+	if err := os.Mkdir(filepath.Join(root, "real"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, "real", filepath.Join(root, "alias"))
+	symlink(t, "real/new.txt", filepath.Join(root, "pending"))
+
+	// a dangling link that stays inside creates its target
+	if err := jail.WriteFile("pending", []byte("made"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := jail.ReadFile("alias/new.txt"); err != nil || string(data) != "made" {
+		t.Errorf("expected to read through the alias, got %q %v", data, err)
+	}
+	if err := jail.SetWorkingDir("alias"); err != nil {
+		t.Fatal(err)
+	}
+	if got := jail.WorkingDir(); got != filepath.Join(root, "real") {
+		t.Errorf("expected the working directory to be resolved, got %s", got)
+	}
+	if !jail.IsFile("../pending") {
+		t.Error("expected paths relative to the new working directory to resolve")
+	}
+
+	symlink(t, "loop", filepath.Join(root, "loop"))
+	if err := jail.WriteFile(filepath.Join(root, "loop"), nil, 0644); !errors.Is(err, errTooManyLinks) {
+		t.Errorf("expected a symlink loop to be refused, got %v", err)
+	}
+}
+
+func TestJailRootThroughSymlink(t *testing.T) {
+	root := t.TempDir()
+	alias := filepath.Join(t.TempDir(), "alias")
+	symlink(t, root, alias)
+
+	jail, err := NewJailedFS(alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jail.WorkingDir() != resolved {
+		t.Errorf("expected the working directory to be the resolved root %s, got %s", resolved, jail.WorkingDir())
+	}
+	if err := jail.WriteFile("a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := jail.ReadFile(filepath.Join(alias, "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("expected the root's alias to lead into the jail, got %q %v", data, err)
+	}
+}
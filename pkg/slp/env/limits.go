@@ -0,0 +1,157 @@
+package env
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+/*
+Limits put hard upper bounds on what a single evaluation context may do, so
+that untrusted snippets can be run without handing them the whole machine.
+
+A zero value for any field means "unlimited" (MaxRecursionDepth instead falls
+back to DefaultMaxRecursionDepth.) Exceeding a limit yields an ordinary SLP
+error object with the code "limit" (ErrorCodeLimit) so scripts can catch it
+with `try` - but note that the step budget is sticky: once it is spent, every
+further call fails too, including the ones in a handler.
+*/
+type Limits struct {
+	// MaxSteps is the number of list executions (calls) allowed
+	MaxSteps int64
+
+	// MaxBindings is the number of live MEM bindings across all scopes
+	MaxBindings int
+
+	// MaxStringSize is the largest string, bytes, or bigint (in bytes) a
+	// function may produce
+	MaxStringSize int
+
+	// MaxListSize is the largest list (in elements) or map (in entries) a
+	// function may produce
+	MaxListSize int
+
+	MaxRecursionDepth int
+}
+
+// Usage reports what an evaluation context has consumed so far
+type Usage struct {
+	// Steps is the number of list executions
+	Steps int64
+
+	// Allocations is the number of bindings created (set, parameters, $args)
+	Allocations int64
+
+	// Bindings is the number of bindings currently live, PeakBindings the most
+	// that were ever live at once
+	Bindings     int
+	PeakBindings int
+
+	// PeakDepth is the deepest the call stack has been
+	PeakDepth int
+}
+
+type meter struct {
+	limits Limits
+	usage  Usage
+}
+
+func (m *meter) step() bool {
+	m.usage.Steps++
+	return m.limits.MaxSteps <= 0 || m.usage.Steps <= m.limits.MaxSteps
+}
+
+func (m *meter) bind(count int) bool {
+	if m.limits.MaxBindings > 0 && m.usage.Bindings+count > m.limits.MaxBindings {
+		return false
+	}
+	m.usage.Bindings += count
+	m.usage.Allocations += int64(count)
+	if m.usage.Bindings > m.usage.PeakBindings {
+		m.usage.PeakBindings = m.usage.Bindings
+	}
+	return true
+}
+
+func (m *meter) release(count int) {
+	m.usage.Bindings -= count
+	if m.usage.Bindings < 0 {
+		m.usage.Bindings = 0
+	}
+}
+
+func (m *meter) enter(depth int) {
+	if depth > m.usage.PeakDepth {
+		m.usage.PeakDepth = depth
+	}
+}
+
+func (m *meter) reset() {
+	m.usage = Usage{
+		Bindings:     m.usage.Bindings,
+		PeakBindings: m.usage.Bindings,
+	}
+}
+
+func (e *evalCtx) Usage() Usage {
+	return e.shared.meter.usage
+}
+
+// ResetUsage zeroes the counters (refilling the step budget.) Bindings that are
+// still live stay counted
+func (e *evalCtx) ResetUsage() {
+	e.shared.meter.reset()
+}
+
+func (e *evalCtx) makeLimitError(pos object.Span, limit string, max any) object.Obj {
+	return e.makeCodedError(pos, ErrorCodeLimit, fmt.Sprintf("limit exceeded: %s (max %v)", limit, max))
+}
+
+func (e *evalCtx) step(pos object.Span) (object.Obj, bool) {
+	if !e.shared.meter.step() {
+		return e.makeLimitError(pos, "steps", e.shared.meter.limits.MaxSteps), false
+	}
+	return object.Obj{}, true
+}
+
+func (e *evalCtx) bind(pos object.Span, count int) (object.Obj, bool) {
+	if !e.shared.meter.bind(count) {
+		return e.makeLimitError(pos, "bindings", e.shared.meter.limits.MaxBindings), false
+	}
+	return object.Obj{}, true
+}
+
+// releaseScope gives back every binding a function call made in its own scope
+// once the call returns. Bindings captured by closures are treated as released
+// too - this is a quota, not a garbage collector
+func (e *evalCtx) releaseScope(mem MEM) {
+	e.shared.meter.release(mem.Len())
+}
+
+func (e *evalCtx) checkSize(pos object.Span, result object.Obj) (object.Obj, bool) {
+	limits := e.shared.meter.limits
+	switch result.Type {
+	case object.OBJ_TYPE_STRING:
+		if limits.MaxStringSize > 0 && len(result.D.(string)) > limits.MaxStringSize {
+			return e.makeLimitError(pos, "string size", limits.MaxStringSize), false
+		}
+	case object.OBJ_TYPE_LIST:
+		if limits.MaxListSize > 0 && len(result.D.(object.List)) > limits.MaxListSize {
+			return e.makeLimitError(pos, "list size", limits.MaxListSize), false
+		}
+	case object.OBJ_TYPE_BYTES:
+		if limits.MaxStringSize > 0 && len(result.D.(object.Bytes)) > limits.MaxStringSize {
+			return e.makeLimitError(pos, "bytes size", limits.MaxStringSize), false
+		}
+	case object.OBJ_TYPE_BIGINT:
+		if limits.MaxStringSize > 0 && (result.D.(*big.Int).BitLen()+7)/8 > limits.MaxStringSize {
+			return e.makeLimitError(pos, "integer size", limits.MaxStringSize), false
+		}
+	case object.OBJ_TYPE_MAP:
+		if limits.MaxListSize > 0 && result.D.(*object.Map).Len() > limits.MaxListSize {
+			return e.makeLimitError(pos, "map size", limits.MaxListSize), false
+		}
+	}
+	return object.Obj{}, true
+}
@@ -0,0 +1,162 @@
+package env
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+	"github.com/bosley/slpx/pkg/slp/slp"
+)
+
+/*
+Macro libraries
+
+Macros belong to the parser, and every file is parsed on its own, so a macro
+defined in one file is not seen by another. A file takes the macros of another
+one at parse time with ($import "path"), which is looked for the same way
+`use` and `import` look for a file. The file imported from is only parsed, not
+run: it offers the macros it names with ($export name ...), or every macro it
+defines when it has no $export.
+
+	; lib/control.slpx
+	$(unless ?cond ?body...) (if ?cond _ (do ?body...))
+	($export unless)
+
+	; main.slpx
+	($import "lib/control.slpx")
+	($unless ready (putln "waiting") (wait))
+
+At runtime, `macroexpand` and `macroexpand1` show what a form (given as source)
+expands to with the macros of the code being run, fully or by one step, and
+`macrotrace` lists every macro the full expansion applies:
+
+	(macroexpand1 "($unless ready (wait))")   ; (if ready _ (do (wait)))
+*/
+
+// NewParser makes a parser for source, the content of the file at path, whose
+// $import loads macros through the context's FS and module path
+func (e *evalCtx) NewParser(source string, path string) *slp.Parser {
+	parser := slp.NewParserForSource(source, path)
+	parser.MacroLoader = func(target string) (map[string]*slp.MacroDef, error) {
+		return e.loadMacros(path, target)
+	}
+	return parser
+}
+
+// SetMacros sets the macros of the code being run, which macroexpand and its
+// kin expand with. runFile sets them for the files it runs
+func (e *evalCtx) SetMacros(macros map[string]*slp.MacroDef) {
+	e.macros = macros
+}
+
+// loadMacros parses the file target names, relative to currentFile, for the
+// macros it exports
+func (e *evalCtx) loadMacros(currentFile string, target string) (map[string]*slp.MacroDef, error) {
+	fullPath := e.modules.resolve(e.fs, currentFile, target)
+	abs := e.absPath(fullPath)
+
+	if start := slices.Index(e.modules.macroLoading, abs); start >= 0 {
+		cycle := append(slices.Clone(e.modules.macroLoading[start:]), abs)
+		return nil, fmt.Errorf("circular import: %s", strings.Join(cycle, " -> "))
+	}
+
+	content, err := e.fs.ReadFile(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %v", fullPath, err)
+	}
+
+	e.modules.macroLoading = append(e.modules.macroLoading, abs)
+	defer func() {
+		e.modules.macroLoading = e.modules.macroLoading[:len(e.modules.macroLoading)-1]
+	}()
+
+	parser := e.NewParser(string(content), fullPath)
+	if _, err := parser.ParseAll(); err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %v", fullPath, err)
+	}
+	return parser.ExportedMacros()
+}
+
+// parseMacroForm parses the single form in the source arg holds, leaving its
+// macro calls as they are, with a parser that has the macros of the code
+// being run
+func (e *evalCtx) parseMacroForm(command string, arg object.Obj) (*slp.Parser, object.Obj, object.Obj, bool) {
+	parser := slp.NewParser(arg.D.(string))
+	parser.NoExpand = true
+	currentFile := e.currentFilePath
+	parser.MacroLoader = func(target string) (map[string]*slp.MacroDef, error) {
+		return e.loadMacros(currentFile, target)
+	}
+	for name, macroDef := range e.macros {
+		parser.Macros[name] = macroDef
+	}
+
+	forms, err := parser.ParseAll()
+	if err != nil {
+		return nil, object.Obj{}, e.makeErrorFromObj(arg, fmt.Sprintf("%s: %v", command, err)), false
+	}
+	if len(forms) != 1 {
+		return nil, object.Obj{}, e.makeErrorFromObj(arg, fmt.Sprintf("%s: expected 1 form, got %d", command, len(forms))), false
+	}
+	return parser, forms[0], object.Obj{}, true
+}
+
+func cmdMacroexpand(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	evalCtx := ctx.(*evalCtx)
+	parser, form, errObj, ok := evalCtx.parseMacroForm("macroexpand", args[0])
+	if !ok {
+		return errObj, nil
+	}
+	expanded, err := parser.Expand(form)
+	if err != nil {
+		return evalCtx.makeErrorFromObj(args[0], fmt.Sprintf("macroexpand: %v", err)), nil
+	}
+	return expanded, nil
+}
+
+func cmdMacroexpand1(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	evalCtx := ctx.(*evalCtx)
+	parser, form, errObj, ok := evalCtx.parseMacroForm("macroexpand1", args[0])
+	if !ok {
+		return errObj, nil
+	}
+	expanded, _, err := parser.Expand1(form)
+	if err != nil {
+		return evalCtx.makeErrorFromObj(args[0], fmt.Sprintf("macroexpand1: %v", err)), nil
+	}
+	return expanded, nil
+}
+
+// cmdMacrotrace returns a map for each macro the full expansion of a form
+// applies, in the order they were applied
+func cmdMacrotrace(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	evalCtx := ctx.(*evalCtx)
+	parser, form, errObj, ok := evalCtx.parseMacroForm("macrotrace", args[0])
+	if !ok {
+		return errObj, nil
+	}
+
+	var steps object.List
+	parser.Trace = func(step slp.MacroExpansion) {
+		entry := object.NewMap()
+		entry.Set(object.Obj{Type: object.OBJ_TYPE_STRING, D: "macro"}, object.Obj{Type: object.OBJ_TYPE_STRING, D: step.Macro.Name})
+		entry.Set(object.Obj{Type: object.OBJ_TYPE_STRING, D: "call"}, object.Obj{Type: object.OBJ_TYPE_STRING, D: step.Call.Pos.String()})
+		entry.Set(object.Obj{Type: object.OBJ_TYPE_STRING, D: "defined"}, object.Obj{Type: object.OBJ_TYPE_STRING, D: step.Macro.Pos.String()})
+		entry.Set(object.Obj{Type: object.OBJ_TYPE_STRING, D: "depth"}, object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(step.Depth)})
+		entry.Set(object.Obj{Type: object.OBJ_TYPE_STRING, D: "result"}, step.Result)
+		steps = append(steps, object.Obj{Type: object.OBJ_TYPE_MAP, D: entry})
+	}
+	if _, err := parser.Expand(form); err != nil {
+		return evalCtx.makeErrorFromObj(args[0], fmt.Sprintf("macrotrace: %v", err)), nil
+	}
+
+	if steps == nil {
+		steps = object.List{}
+	}
+	result := object.Obj{Type: object.OBJ_TYPE_LIST, D: steps, Pos: args[0].Pos}
+	if errObj, ok := evalCtx.checkSize(args[0].Pos, result); !ok {
+		return errObj, nil
+	}
+	return result, nil
+}
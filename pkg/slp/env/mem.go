@@ -3,7 +3,7 @@ package env
 import "github.com/bosley/slpx/pkg/slp/object"
 
 type memImpl struct {
-	parent  *memImpl
+	parent  MEM
 	symbols map[object.Identifier]object.Obj
 }
 
@@ -91,3 +91,165 @@ func (m *memImpl) GetAll() map[object.Identifier]object.Obj {
 func (m *memImpl) Fork() MEM {
 	return &memImpl{parent: m, symbols: make(map[object.Identifier]object.Obj)}
 }
+
+/*
+scopeMem is the scope of a call to a user function. The parameters are kept
+in slots, in the order the function declares them ($args for a variadic
+function), so that a compiled body can load one by its index instead of by
+name. Anything else the body binds goes in a map made the first time it is
+needed, so a call that binds nothing but its arguments allocates no map.
+*/
+type scopeMem struct {
+	parent   MEM
+	params   []object.Parameter
+	variadic bool
+	slots    []object.Obj
+	symbols  map[object.Identifier]object.Obj
+
+	// the slots of a function with few parameters
+	inline [4]object.Obj
+}
+
+var _ MEM = &scopeMem{}
+
+func newScopeMem(parent MEM, function object.Function) *scopeMem {
+	s := &scopeMem{parent: parent, params: function.Parameters, variadic: function.Variadic}
+	n := len(function.Parameters)
+	if function.Variadic {
+		n = 1
+	}
+	if n <= len(s.inline) {
+		s.slots = s.inline[:n]
+	} else {
+		s.slots = make([]object.Obj, n)
+	}
+	return s
+}
+
+func (s *scopeMem) slotName(i int) object.Identifier {
+	if s.variadic {
+		return "$args"
+	}
+	return s.params[i].Name
+}
+
+// slot returns the index of the first slot named key, or -1. A slot whose
+// binding was deleted has no type
+func (s *scopeMem) slot(key object.Identifier) int {
+	for i := range s.slots {
+		if s.slotName(i) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *scopeMem) Get(key object.Identifier, searchParent bool) (object.Obj, error) {
+	if i := s.slot(key); i >= 0 && s.slots[i].Type != "" {
+		return s.slots[i], nil
+	}
+	if value, exists := s.symbols[key]; exists {
+		return value, nil
+	}
+	if searchParent && s.parent != nil {
+		return s.parent.Get(key, searchParent)
+	}
+	return object.Obj{}, ErrUndefinedIdentifier
+}
+
+func (s *scopeMem) Set(key object.Identifier, value object.Obj, searchParent bool) error {
+	i := s.slot(key)
+	if i >= 0 && s.slots[i].Type != "" {
+		s.slots[i] = value
+		return nil
+	}
+	if _, exists := s.symbols[key]; exists {
+		s.symbols[key] = value
+		return nil
+	}
+
+	if searchParent && s.parent != nil {
+		_, err := s.parent.Get(key, true)
+		if err == nil {
+			return s.parent.Set(key, value, searchParent)
+		}
+	}
+
+	if i >= 0 {
+		s.slots[i] = value
+		return nil
+	}
+	if s.symbols == nil {
+		s.symbols = make(map[object.Identifier]object.Obj)
+	}
+	s.symbols[key] = value
+	return nil
+}
+
+func (s *scopeMem) Delete(key object.Identifier, searchParent bool) error {
+	if i := s.slot(key); i >= 0 && s.slots[i].Type != "" {
+		s.slots[i] = object.Obj{}
+		return nil
+	}
+	if _, exists := s.symbols[key]; exists {
+		delete(s.symbols, key)
+		return nil
+	}
+	if searchParent && s.parent != nil {
+		return s.parent.Delete(key, searchParent)
+	}
+	return nil
+}
+
+func (s *scopeMem) Keys() []object.Identifier {
+	keys := make([]object.Identifier, 0, s.Len())
+	for key := range s.GetAll() {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (s *scopeMem) Values() []object.Obj {
+	values := make([]object.Obj, 0, s.Len())
+	for _, value := range s.GetAll() {
+		values = append(values, value)
+	}
+	return values
+}
+
+func (s *scopeMem) Len() int {
+	n := len(s.symbols)
+	for i, value := range s.slots {
+		if value.Type != "" && s.slot(s.slotName(i)) == i {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *scopeMem) IsEmpty() bool {
+	return s.Len() == 0
+}
+
+func (s *scopeMem) Clear() {
+	clear(s.slots)
+	s.symbols = nil
+}
+
+// GetAll returns a map made for the call, not the scope itself
+func (s *scopeMem) GetAll() map[object.Identifier]object.Obj {
+	all := make(map[object.Identifier]object.Obj, len(s.symbols)+len(s.slots))
+	for key, value := range s.symbols {
+		all[key] = value
+	}
+	for i, value := range s.slots {
+		if value.Type != "" && s.slot(s.slotName(i)) == i {
+			all[s.slotName(i)] = value
+		}
+	}
+	return all
+}
+
+func (s *scopeMem) Fork() MEM {
+	return &memImpl{parent: s, symbols: make(map[object.Identifier]object.Obj)}
+}
@@ -0,0 +1,315 @@
+package env
+
+import (
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errNotDir   = errors.New("not a directory")
+	errIsDir    = errors.New("is a directory")
+	errNotEmpty = errors.New("directory not empty")
+)
+
+// memNode is a file (children == nil) or a directory in a memoryFS
+type memNode struct {
+	data     []byte
+	perm     os.FileMode
+	modTime  time.Time
+	children map[string]*memNode
+}
+
+func (n *memNode) isDir() bool {
+	return n.children != nil
+}
+
+type memoryFS struct {
+	mu         sync.Mutex
+	root       *memNode
+	workingDir string
+}
+
+var _ FS = &memoryFS{}
+
+// NewMemoryFS is an FS that exists only in memory, starting out as an empty
+// root directory that is also the working directory. Nothing it is asked to
+// do reaches the host
+func NewMemoryFS() FS {
+	return newMemoryFS()
+}
+
+func newMemoryFS() *memoryFS {
+	return &memoryFS{
+		root:       &memNode{perm: os.ModeDir | 0755, modTime: time.Now(), children: make(map[string]*memNode)},
+		workingDir: string(filepath.Separator),
+	}
+}
+
+func (f *memoryFS) resolvePath(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(f.workingDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, string(filepath.Separator))
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, string(filepath.Separator))
+}
+
+// lookup finds the node at an absolute, clean path
+func (f *memoryFS) lookup(path string) (*memNode, error) {
+	node := f.root
+	for _, name := range splitPath(path) {
+		if !node.isDir() {
+			return nil, errNotDir
+		}
+		child, ok := node.children[name]
+		if !ok {
+			return nil, iofs.ErrNotExist
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// parent finds the directory that holds path, and the name path has in it
+func (f *memoryFS) parent(path string) (*memNode, string, error) {
+	dir, err := f.lookup(filepath.Dir(path))
+	if err != nil {
+		return nil, "", err
+	}
+	if !dir.isDir() {
+		return nil, "", errNotDir
+	}
+	return dir, filepath.Base(path), nil
+}
+
+func pathError(op, path string, err error) error {
+	return &iofs.PathError{Op: op, Path: path, Err: err}
+}
+
+func (f *memoryFS) ReadFile(path string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	node, err := f.lookup(fullPath)
+	if err != nil {
+		return nil, pathError("open", fullPath, err)
+	}
+	if node.isDir() {
+		return nil, pathError("read", fullPath, errIsDir)
+	}
+	return slices.Clone(node.data), nil
+}
+
+func (f *memoryFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	dir, name, err := f.parent(fullPath)
+	if err != nil {
+		return pathError("open", fullPath, err)
+	}
+	if existing, ok := dir.children[name]; ok {
+		if existing.isDir() {
+			return pathError("open", fullPath, errIsDir)
+		}
+		existing.data = slices.Clone(data)
+		existing.modTime = time.Now()
+		return nil
+	}
+	dir.children[name] = &memNode{data: slices.Clone(data), perm: perm, modTime: time.Now()}
+	return nil
+}
+
+func (f *memoryFS) AppendFile(path string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	dir, name, err := f.parent(fullPath)
+	if err != nil {
+		return pathError("open", fullPath, err)
+	}
+	existing, ok := dir.children[name]
+	if !ok {
+		dir.children[name] = &memNode{data: slices.Clone(data), perm: 0644, modTime: time.Now()}
+		return nil
+	}
+	if existing.isDir() {
+		return pathError("open", fullPath, errIsDir)
+	}
+	existing.data = append(existing.data, data...)
+	existing.modTime = time.Now()
+	return nil
+}
+
+// DeleteFile and RemoveDir both behave as os.Remove does: either removes a
+// file or an empty directory
+func (f *memoryFS) DeleteFile(path string) error {
+	return f.remove(path)
+}
+
+func (f *memoryFS) RemoveDir(path string) error {
+	return f.remove(path)
+}
+
+func (f *memoryFS) remove(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	dir, name, err := f.parent(fullPath)
+	if err != nil {
+		return pathError("remove", fullPath, err)
+	}
+	node, ok := dir.children[name]
+	if !ok {
+		return pathError("remove", fullPath, iofs.ErrNotExist)
+	}
+	if node.isDir() && len(node.children) > 0 {
+		return pathError("remove", fullPath, errNotEmpty)
+	}
+	delete(dir.children, name)
+	return nil
+}
+
+func (f *memoryFS) RemoveDirAll(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	if fullPath == string(filepath.Separator) {
+		clear(f.root.children)
+		return nil
+	}
+	dir, name, err := f.parent(fullPath)
+	if err != nil {
+		// like os.RemoveAll, a path that is not there is already removed
+		return nil
+	}
+	delete(dir.children, name)
+	return nil
+}
+
+func (f *memoryFS) stat(path string) (*memNode, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	node, err := f.lookup(f.resolvePath(path))
+	return node, err == nil
+}
+
+func (f *memoryFS) Exists(path string) bool {
+	_, found := f.stat(path)
+	return found
+}
+
+func (f *memoryFS) IsDir(path string) bool {
+	node, found := f.stat(path)
+	return found && node.isDir()
+}
+
+func (f *memoryFS) IsFile(path string) bool {
+	node, found := f.stat(path)
+	return found && !node.isDir()
+}
+
+func (f *memoryFS) ModTime(path string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	node, err := f.lookup(fullPath)
+	if err != nil {
+		return time.Time{}, pathError("stat", fullPath, err)
+	}
+	return node.modTime, nil
+}
+
+func (f *memoryFS) ListDir(path string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	node, err := f.lookup(fullPath)
+	if err != nil {
+		return nil, pathError("open", fullPath, err)
+	}
+	if !node.isDir() {
+		return nil, pathError("readdirent", fullPath, errNotDir)
+	}
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (f *memoryFS) MkDir(path string, perm os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	dir, name, err := f.parent(fullPath)
+	if err != nil {
+		return pathError("mkdir", fullPath, err)
+	}
+	if _, exists := dir.children[name]; exists || fullPath == string(filepath.Separator) {
+		return pathError("mkdir", fullPath, iofs.ErrExist)
+	}
+	dir.children[name] = &memNode{perm: os.ModeDir | perm, modTime: time.Now(), children: make(map[string]*memNode)}
+	return nil
+}
+
+func (f *memoryFS) MkDirAll(path string, perm os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	node := f.root
+	for _, name := range splitPath(fullPath) {
+		child, ok := node.children[name]
+		if !ok {
+			child = &memNode{perm: os.ModeDir | perm, modTime: time.Now(), children: make(map[string]*memNode)}
+			node.children[name] = child
+		}
+		if !child.isDir() {
+			return pathError("mkdir", fullPath, errNotDir)
+		}
+		node = child
+	}
+	return nil
+}
+
+func (f *memoryFS) WorkingDir() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.workingDir
+}
+
+func (f *memoryFS) SetWorkingDir(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fullPath := f.resolvePath(path)
+	node, err := f.lookup(fullPath)
+	if err != nil || !node.isDir() {
+		return os.ErrNotExist
+	}
+	f.workingDir = fullPath
+	return nil
+}
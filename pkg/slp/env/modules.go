@@ -0,0 +1,307 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+/*
+Modules
+
+`use` runs a file in the caller's scope: everything the file sets is bound in
+the caller afterwards, and a file that has already been used is skipped.
+`import` runs a file as a module instead. The module gets a scope of its own,
+is run once per context no matter how often it is imported, and only what it
+lists with `export` (or, with no `export` at all, everything it sets) is bound
+in the importer, each name under a prefix:
+
+	; lib/strings.slpx
+	(set pad (fn (s :S) :S (str/concat " " s)))
+	(export pad)
+
+	; main.slpx
+	(import "lib/strings.slpx")        ; binds strings/pad
+	(import "lib/strings.slpx" "s")    ; binds s/pad
+
+Both look for a relative path next to the current file first and then in each
+directory of the module path, in order; a path without an extension may leave
+off ".slpx". A file that is reached again while it is still being run, by
+either form, is a circular import and an error.
+*/
+
+// ModuleFileExtension is tried after a `use` or `import` path that has no
+// extension of its own
+const ModuleFileExtension = ".slpx"
+
+// DefaultModulePath is the module path the command line tools use: every
+// directory in SLPX_PATH (separated as PATH is), then the lib directory of
+// the SLPX home when home is not empty
+func DefaultModulePath(home string) []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("SLPX_PATH")) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if home != "" {
+		dirs = append(dirs, filepath.Join(home, "lib"))
+	}
+	return dirs
+}
+
+// moduleLoader is shared by a root context and everything forked from it
+type moduleLoader struct {
+	path []string
+
+	// files `use` has run, modules `import` has run (by absolute path), and
+	// the files being run right now, outermost first
+	used    map[string]bool
+	modules map[string]*module
+	loading []string
+
+	// the files $import is parsing for macros right now, outermost first
+	macroLoading []string
+
+	// every file either has run, in the order they first ran (see reload.go)
+	files []*loadedFile
+}
+
+type module struct {
+	names  []object.Identifier
+	values map[object.Identifier]object.Obj
+
+	// where the module has been imported, so that reloading it can bind its
+	// exports there again
+	imports []moduleImport
+}
+
+type moduleImport struct {
+	mem    MEM
+	prefix string
+}
+
+// moduleScope is set on the context running a module's top level, where
+// `export` is allowed
+type moduleScope struct {
+	exports  []object.Identifier
+	declared bool
+}
+
+func newModuleLoader(path []string) *moduleLoader {
+	return &moduleLoader{
+		path:    slices.Clone(path),
+		used:    make(map[string]bool),
+		modules: make(map[string]*module),
+	}
+}
+
+// resolve finds the file target names, relative to currentFile when it is not
+// absolute. When nothing matches, it returns the first place it looked so that
+// reading it reports the failure
+func (l *moduleLoader) resolve(fs FS, currentFile string, target string) string {
+	var candidates []string
+	if filepath.IsAbs(target) {
+		candidates = append(candidates, target)
+	} else {
+		if currentFile != "" {
+			candidates = append(candidates, filepath.Join(filepath.Dir(currentFile), target))
+		} else {
+			candidates = append(candidates, target)
+		}
+		for _, dir := range l.path {
+			candidates = append(candidates, filepath.Join(dir, target))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if fs.IsFile(candidate) {
+			return candidate
+		}
+		if filepath.Ext(candidate) == "" && fs.IsFile(candidate+ModuleFileExtension) {
+			return candidate + ModuleFileExtension
+		}
+	}
+	return candidates[0]
+}
+
+// absPath is the absolute form of path, which is what a module is known by. A
+// relative path is taken from the working directory of e's filesystem rather
+// than the process's, which that filesystem may not even share
+func (e *evalCtx) absPath(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(e.fs.WorkingDir(), path)
+	}
+	return filepath.Clean(path)
+}
+
+// checkCircular reports an error when absPath is already being run
+func (e *evalCtx) checkCircular(command string, arg object.Obj, absPath string) (object.Obj, bool) {
+	start := slices.Index(e.modules.loading, absPath)
+	if start < 0 {
+		return object.Obj{}, true
+	}
+	cycle := append(slices.Clone(e.modules.loading[start:]), absPath)
+	return e.makeErrorFromObj(arg, fmt.Sprintf("%s: circular import: %s", command, strings.Join(cycle, " -> "))), false
+}
+
+// runFile evaluates every item of the file at fullPath in e, on behalf of
+// command (use, import, or reload) called with arg
+func (e *evalCtx) runFile(command string, arg object.Obj, fullPath string, absPath string) (object.Obj, error) {
+	// taken before reading so that a change made in between is not missed
+	modTime, _ := e.fs.ModTime(fullPath)
+	content, err := e.fs.ReadFile(fullPath)
+	if err != nil {
+		return e.makeErrorFromObj(arg, fmt.Sprintf("%s: failed to read file %s: %v", command, fullPath, err)), nil
+	}
+	e.modules.track(fullPath, absPath, modTime)
+
+	parser := e.NewParser(string(content), fullPath)
+	items, err := parser.ParseAll()
+	if err != nil {
+		return e.makeErrorFromObj(arg, fmt.Sprintf("%s: failed to parse file %s: %v", command, fullPath, err)), nil
+	}
+
+	previousFilePath, previousMacros := e.currentFilePath, e.macros
+	e.currentFilePath, e.macros = fullPath, parser.Macros
+	e.modules.loading = append(e.modules.loading, absPath)
+	defer func() {
+		e.currentFilePath, e.macros = previousFilePath, previousMacros
+		e.modules.loading = e.modules.loading[:len(e.modules.loading)-1]
+	}()
+
+	for itemIdx, item := range items {
+		result, err := e.Evaluate(item)
+		if err != nil {
+			if _, exited := ExitCode(err); exited || errors.Is(err, ErrCancelled) {
+				return object.Obj{}, err
+			}
+			return e.makeErrorFromObj(item, fmt.Sprintf("%s: error evaluating file %s at item %d: %v", command, fullPath, itemIdx, err)), nil
+		}
+		if result.Type == object.OBJ_TYPE_ERROR {
+			cause := result.D.(object.Error)
+			wrapped := e.makeErrorFromObj(item, fmt.Sprintf("%s: file %s item %d produced an error", command, fullPath, itemIdx))
+			errData := wrapped.D.(object.Error)
+			errData.Cause = &cause
+			wrapped.D = errData
+			return wrapped, nil
+		}
+	}
+
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+}
+
+// loadModule runs the module at fullPath in a scope of its own, or returns it
+// as it was the first time it was imported
+func (e *evalCtx) loadModule(arg object.Obj, fullPath string, absPath string) (*module, object.Obj, error) {
+	if loaded, ok := e.modules.modules[absPath]; ok {
+		return loaded, object.Obj{}, nil
+	}
+	loaded, errObj, err := e.runModule("import", arg, fullPath, absPath)
+	if loaded != nil {
+		e.modules.modules[absPath] = loaded
+	}
+	return loaded, errObj, err
+}
+
+// runModule runs the module at fullPath, whether or not it has been run before
+func (e *evalCtx) runModule(command string, arg object.Obj, fullPath string, absPath string) (*module, object.Obj, error) {
+	moduleCtx := e.fork(DefaultMEM())
+	moduleCtx.module = &moduleScope{}
+	result, err := moduleCtx.runFile(command, arg, fullPath, absPath)
+	if err != nil || result.Type == object.OBJ_TYPE_ERROR {
+		return nil, result, err
+	}
+
+	names := moduleCtx.module.exports
+	if !moduleCtx.module.declared {
+		for _, name := range moduleCtx.mem.Keys() {
+			if !strings.HasPrefix(string(name), "$") {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+	}
+
+	loaded := &module{names: names, values: make(map[object.Identifier]object.Obj, len(names))}
+	for _, name := range names {
+		value, err := moduleCtx.mem.Get(name, false)
+		if err != nil {
+			return nil, e.makeErrorFromObj(arg, fmt.Sprintf("%s: %s exports %s but never sets it", command, fullPath, name)), nil
+		}
+		loaded.values[name] = value
+	}
+	return loaded, object.Obj{}, nil
+}
+
+// bindModule binds the exports of loaded in mem under prefix
+func (e *evalCtx) bindModule(pos object.Span, mem MEM, prefix string, loaded *module) (object.Obj, bool) {
+	for _, name := range loaded.names {
+		ident := object.Identifier(prefix + "/" + string(name))
+		if _, err := mem.Get(ident, true); err != nil {
+			if errObj, ok := e.bind(pos, 1); !ok {
+				return errObj, false
+			}
+		}
+		mem.Set(ident, loaded.values[name], true)
+	}
+	return object.Obj{}, true
+}
+
+func cmdImport(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	evalCtx := ctx.(*evalCtx)
+	if len(args) > 2 {
+		return evalCtx.makeErrorFromObj(args[2], fmt.Sprintf("import: takes a path and an optional prefix, got %d arguments", len(args))), nil
+	}
+
+	fullPath := evalCtx.modules.resolve(evalCtx.fs, evalCtx.currentFilePath, args[0].D.(string))
+	abs := evalCtx.absPath(fullPath)
+
+	prefix := strings.TrimSuffix(filepath.Base(fullPath), filepath.Ext(fullPath))
+	if len(args) == 2 {
+		prefix = args[1].D.(string)
+		if prefix == "" || strings.ContainsAny(prefix, "/ \t\n") || strings.HasPrefix(prefix, "$") {
+			return evalCtx.makeErrorFromObj(args[1], fmt.Sprintf("import: invalid prefix %q", prefix)), nil
+		}
+	}
+
+	if errObj, ok := evalCtx.checkCircular("import", args[0], abs); !ok {
+		return errObj, nil
+	}
+
+	loaded, errObj, err := evalCtx.loadModule(args[0], fullPath, abs)
+	if err != nil || loaded == nil {
+		return errObj, err
+	}
+
+	if errObj, ok := evalCtx.bindModule(args[0].Pos, evalCtx.mem, prefix, loaded); !ok {
+		return errObj, nil
+	}
+	imported := moduleImport{mem: evalCtx.mem, prefix: prefix}
+	if !slices.Contains(loaded.imports, imported) {
+		loaded.imports = append(loaded.imports, imported)
+	}
+
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+}
+
+func cmdExport(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	evalCtx := ctx.(*evalCtx)
+	if evalCtx.module == nil {
+		return evalCtx.makeErrorFromObj(args[0], "export: only allowed at the top level of a module run by import"), nil
+	}
+
+	evalCtx.module.declared = true
+	for _, arg := range args {
+		name := arg.D.(object.Identifier)
+		if !slices.Contains(evalCtx.module.exports, name) {
+			evalCtx.module.exports = append(evalCtx.module.exports, name)
+		}
+	}
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+}
@@ -0,0 +1,41 @@
+package env
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// a module is known by its absolute path, which for a relative path depends on
+// the working directory of the context's filesystem and not the process's
+func TestImportFollowsTheWorkingDirectory(t *testing.T) {
+	fs := NewMemoryFS()
+	for dir, source := range map[string]string{"/a": `(set value 1)`, "/b": `(set value 2)`} {
+		if err := fs.MkDirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.WriteFile(filepath.Join(dir, "lib.slpx"), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.SetWorkingDir("/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEvalBuilder(nil).
+		WithFS(fs).
+		WithFunctionGroup(NewCoreFunctions()).
+		Build().(*evalCtx)
+
+	if result := evaluateSource(t, e, `(import "lib.slpx") lib/value`); result.Encode() != "1" {
+		t.Fatalf("expected /a/lib.slpx to be imported, got %s", result.Encode())
+	}
+	if err := fs.SetWorkingDir("/b"); err != nil {
+		t.Fatal(err)
+	}
+	if result := evaluateSource(t, e, `(import "lib.slpx") lib/value`); result.Encode() != "2" {
+		t.Errorf("expected /b/lib.slpx to be imported as a module of its own, got %s", result.Encode())
+	}
+	if got := e.absPath("lib.slpx"); got != filepath.FromSlash("/b/lib.slpx") {
+		t.Errorf("expected lib.slpx to be known as /b/lib.slpx, got %s", got)
+	}
+}
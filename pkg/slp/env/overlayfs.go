@@ -0,0 +1,264 @@
+package env
+
+import (
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+overlayFS is copy-on-write over a base FS. Reads fall through to the base for
+anything the overlay has not written; writes, appends, and new directories
+land in an in-memory upper layer; and deletions are recorded as whiteouts that
+hide the base's entry (and everything beneath it) without touching it.
+
+A path the upper layer has is always taken from there, so a directory removed
+and then made again is empty rather than showing what the base still holds.
+*/
+type overlayFS struct {
+	mu         sync.Mutex
+	base       FS
+	upper      *memoryFS
+	whiteouts  map[string]bool
+	workingDir string
+}
+
+var _ FS = &overlayFS{}
+
+// NewOverlayFS layers an in-memory FS over base. Changes made through it are
+// never written to base. The working directory starts as base's
+func NewOverlayFS(base FS) FS {
+	return &overlayFS{
+		base:       base,
+		upper:      newMemoryFS(),
+		whiteouts:  make(map[string]bool),
+		workingDir: base.WorkingDir(),
+	}
+}
+
+func (f *overlayFS) resolvePath(path string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(f.workingDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// hidden reports whether path or any directory above it has been deleted
+func (f *overlayFS) hidden(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		if f.whiteouts[path] {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// inBase reports whether the base's entry at path shows through
+func (f *overlayFS) inBase(path string) bool {
+	return !f.upper.Exists(path) && !f.hidden(path) && f.base.Exists(path)
+}
+
+// copyUp gives the upper layer the directories above path, so that it can be
+// written to, provided the merged view has them
+func (f *overlayFS) copyUp(path string) error {
+	dir := filepath.Dir(path)
+	if !f.isDir(dir) {
+		return pathError("open", path, iofs.ErrNotExist)
+	}
+	return f.upper.MkDirAll(dir, 0755)
+}
+
+func (f *overlayFS) whiteout(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.whiteouts[path] = true
+}
+
+func (f *overlayFS) ReadFile(path string) ([]byte, error) {
+	fullPath := f.resolvePath(path)
+	if f.inBase(fullPath) {
+		return f.base.ReadFile(fullPath)
+	}
+	return f.upper.ReadFile(fullPath)
+}
+
+func (f *overlayFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	fullPath := f.resolvePath(path)
+	if f.isDir(fullPath) {
+		return pathError("open", fullPath, errIsDir)
+	}
+	if err := f.copyUp(fullPath); err != nil {
+		return err
+	}
+	return f.upper.WriteFile(fullPath, data, perm)
+}
+
+func (f *overlayFS) AppendFile(path string, data []byte) error {
+	fullPath := f.resolvePath(path)
+	if f.inBase(fullPath) {
+		existing, err := f.base.ReadFile(fullPath)
+		if err != nil {
+			return err
+		}
+		data = append(existing, data...)
+		return f.WriteFile(fullPath, data, 0644)
+	}
+	if err := f.copyUp(fullPath); err != nil {
+		return err
+	}
+	return f.upper.AppendFile(fullPath, data)
+}
+
+func (f *overlayFS) DeleteFile(path string) error {
+	return f.remove(path)
+}
+
+func (f *overlayFS) RemoveDir(path string) error {
+	return f.remove(path)
+}
+
+func (f *overlayFS) remove(path string) error {
+	fullPath := f.resolvePath(path)
+	if !f.exists(fullPath) {
+		return pathError("remove", fullPath, iofs.ErrNotExist)
+	}
+	if f.isDir(fullPath) {
+		entries, err := f.listDir(fullPath)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return pathError("remove", fullPath, errNotEmpty)
+		}
+	}
+	if f.upper.Exists(fullPath) {
+		if err := f.upper.RemoveDirAll(fullPath); err != nil {
+			return err
+		}
+	}
+	f.whiteout(fullPath)
+	return nil
+}
+
+func (f *overlayFS) RemoveDirAll(path string) error {
+	fullPath := f.resolvePath(path)
+	if err := f.upper.RemoveDirAll(fullPath); err != nil {
+		return err
+	}
+	f.whiteout(fullPath)
+	return nil
+}
+
+func (f *overlayFS) exists(path string) bool {
+	return f.upper.Exists(path) || f.inBase(path)
+}
+
+func (f *overlayFS) isDir(path string) bool {
+	if f.upper.Exists(path) {
+		return f.upper.IsDir(path)
+	}
+	return f.inBase(path) && f.base.IsDir(path)
+}
+
+func (f *overlayFS) Exists(path string) bool {
+	return f.exists(f.resolvePath(path))
+}
+
+func (f *overlayFS) IsDir(path string) bool {
+	return f.isDir(f.resolvePath(path))
+}
+
+func (f *overlayFS) IsFile(path string) bool {
+	fullPath := f.resolvePath(path)
+	return f.exists(fullPath) && !f.isDir(fullPath)
+}
+
+func (f *overlayFS) ModTime(path string) (time.Time, error) {
+	fullPath := f.resolvePath(path)
+	if f.inBase(fullPath) {
+		return f.base.ModTime(fullPath)
+	}
+	return f.upper.ModTime(fullPath)
+}
+
+func (f *overlayFS) ListDir(path string) ([]string, error) {
+	return f.listDir(f.resolvePath(path))
+}
+
+func (f *overlayFS) listDir(path string) ([]string, error) {
+	if !f.isDir(path) {
+		if f.exists(path) {
+			return nil, pathError("readdirent", path, errNotDir)
+		}
+		return nil, pathError("open", path, iofs.ErrNotExist)
+	}
+
+	var names []string
+	if f.upper.IsDir(path) {
+		upperNames, err := f.upper.ListDir(path)
+		if err != nil {
+			return nil, err
+		}
+		names = upperNames
+	}
+	if !f.hidden(path) && f.base.IsDir(path) {
+		baseNames, err := f.base.ListDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range baseNames {
+			if !slices.Contains(names, name) && f.inBase(filepath.Join(path, name)) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (f *overlayFS) MkDir(path string, perm os.FileMode) error {
+	fullPath := f.resolvePath(path)
+	if f.exists(fullPath) {
+		return pathError("mkdir", fullPath, iofs.ErrExist)
+	}
+	if err := f.copyUp(fullPath); err != nil {
+		return err
+	}
+	return f.upper.MkDir(fullPath, perm)
+}
+
+func (f *overlayFS) MkDirAll(path string, perm os.FileMode) error {
+	fullPath := f.resolvePath(path)
+	if f.exists(fullPath) && !f.isDir(fullPath) {
+		return pathError("mkdir", fullPath, errNotDir)
+	}
+	return f.upper.MkDirAll(fullPath, perm)
+}
+
+func (f *overlayFS) WorkingDir() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.workingDir
+}
+
+func (f *overlayFS) SetWorkingDir(path string) error {
+	fullPath := f.resolvePath(path)
+	if !f.isDir(fullPath) {
+		return os.ErrNotExist
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.workingDir = fullPath
+	return nil
+}
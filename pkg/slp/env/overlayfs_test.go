@@ -0,0 +1,80 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestOverlay(t *testing.T) (overlay FS, dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "base.txt"), []byte("base"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	base := DefaultFS()
+	if err := base.SetWorkingDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return NewOverlayFS(base), dir
+}
+
+func TestOverlayLeavesBaseUntouched(t *testing.T) {
+	overlay, dir := newTestOverlay(t)
+
+	if err := overlay.AppendFile("base.txt", []byte("+upper")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := overlay.ReadFile("base.txt"); string(data) != "base+upper" {
+		t.Errorf("expected the overlay to see its own append, got %q", data)
+	}
+	if err := overlay.WriteFile("sub/new.txt", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := overlay.ListDir("sub"); len(names) != 1 || names[0] != "new.txt" {
+		t.Errorf("expected the new file to be listed, got %v", names)
+	}
+	if err := overlay.DeleteFile("base.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if overlay.Exists("base.txt") {
+		t.Error("expected the overlay to hide a deleted base file")
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "base.txt")); string(data) != "base" {
+		t.Errorf("expected the base file to be untouched, got %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "sub")); len(entries) != 0 {
+		t.Errorf("expected the base directory to be untouched, got %v", entries)
+	}
+}
+
+func TestOverlayWriteOverDirectory(t *testing.T) {
+	overlay, _ := newTestOverlay(t)
+
+	if err := overlay.WriteFile("sub", []byte("x"), 0644); !errors.Is(err, errIsDir) {
+		t.Errorf("expected writing over a base directory to fail, got %v", err)
+	}
+	if !overlay.IsDir("sub") {
+		t.Error("expected the base directory to still show through")
+	}
+
+	if err := overlay.MkDir("made", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := overlay.WriteFile("made", []byte("x"), 0644); !errors.Is(err, errIsDir) {
+		t.Errorf("expected writing over an upper directory to fail, got %v", err)
+	}
+
+	// once the directory is gone the name is free again
+	if err := overlay.RemoveDir("sub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := overlay.WriteFile("sub", []byte("x"), 0644); err != nil {
+		t.Errorf("expected a removed directory's name to be writable, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package env
+
+import (
+	"fmt"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+/*
+Policy decides which env functions a context may call. It is applied as
+function groups are added to the registry, so a restricted context resolves
+names exactly as an unrestricted one would: a denied function is still
+defined, but calling it yields an SLP error naming the function rather than
+doing anything.
+
+Rules are matched against the group a function comes from and its name. The
+last rule that matches decides, and a call no rule matches is allowed, so a
+policy reads as a list of exceptions:
+
+	policy := env.Policy{}.
+		With(env.DenyGroup("host")).
+		With(env.AllowFunction("host/os")).
+		With(env.NoExit()...)
+
+Groups that know which of their functions touch the machine offer rules of
+their own (fs.ReadOnly, fs.WritesUnder, host.NoEnvMutation, ...)
+*/
+type Policy struct {
+	Rules []Rule
+}
+
+// Rule allows or denies the functions it matches. An empty Group or Function
+// matches any
+type Rule struct {
+	Group    string
+	Function object.Identifier
+
+	Deny bool
+
+	// Guard, when set on a rule that allows, is asked about every call and
+	// refuses it by returning an error (the reason, reported as an SLP error.)
+	// Arguments have been evaluated if the function evaluates them
+	Guard func(runtime Runtime, args object.List) error
+}
+
+// With returns a copy of p with rules added after the existing ones
+func (p Policy) With(rules ...Rule) Policy {
+	p.Rules = append(append([]Rule(nil), p.Rules...), rules...)
+	return p
+}
+
+func DenyGroup(group string) Rule {
+	return Rule{Group: group, Deny: true}
+}
+
+func DenyFunction(name object.Identifier) Rule {
+	return Rule{Function: name, Deny: true}
+}
+
+func AllowGroup(group string) Rule {
+	return Rule{Group: group}
+}
+
+func AllowFunction(name object.Identifier) Rule {
+	return Rule{Function: name}
+}
+
+// NoExit keeps scripts from ending the evaluation with `exit`
+func NoExit() []Rule {
+	return []Rule{DenyFunction("exit")}
+}
+
+// decide reports the rule that governs a function, if any does
+func (p Policy) decide(group string, name object.Identifier) (Rule, bool) {
+	for i := len(p.Rules) - 1; i >= 0; i-- {
+		rule := p.Rules[i]
+		if rule.Group != "" && rule.Group != group {
+			continue
+		}
+		if rule.Function != "" && rule.Function != name {
+			continue
+		}
+		return rule, true
+	}
+	return Rule{}, false
+}
+
+// restrict returns function as the policy would have it, reporting whether
+// it changed
+func (p Policy) restrict(group string, name object.Identifier, function EnvFunction) (EnvFunction, bool) {
+	rule, found := p.decide(group, name)
+	if !found || (!rule.Deny && rule.Guard == nil) {
+		return function, false
+	}
+
+	body := function.Body
+	if rule.Deny {
+		function.Body = func(ctx EvaluationContext, args object.List) (object.Obj, error) {
+			return deniedError(name, "denied by policy"), nil
+		}
+	} else {
+		guard := rule.Guard
+		function.Body = func(ctx EvaluationContext, args object.List) (object.Obj, error) {
+			if err := guard(ctx.(Runtime), args); err != nil {
+				return deniedError(name, err.Error()), nil
+			}
+			return body(ctx, args)
+		}
+	}
+	return function, true
+}
+
+func deniedError(name object.Identifier, reason string) object.Obj {
+	return object.Obj{
+		Type: object.OBJ_TYPE_ERROR,
+		D: object.Error{
+			Code:    ErrorCodeDenied,
+			Message: fmt.Sprintf("%s: %s", name, reason),
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package env
+
+import (
+	"fmt"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+/*
+Quasiquote
+
+A quasiquoted template evaluates to itself, like a quoted one, except for the
+parts inside it that are unquoted: `,x` is replaced by the value of x and
+`,@xs` by the items of the list xs, spliced into the list around it:
+
+	(set n 2)
+	(set rest '(3 4))
+	`(1 ,n ,@rest)             ; (1 2 3 4)
+	`{"total" ,(int/add n 1)}  ; {"total" 3}
+
+A template inside a template is left as it is, and so are the unquotes inside
+it, other than those unquoted once for each template they are nested in:
+
+	`(a `(b ,(c ,n)))          ; (a `(b ,(c 2)))
+*/
+
+// expandQuasi fills in the unquoted parts of template, which is depth
+// quasiquotes deep. When an unquoted part fails, ok is false and the result is
+// the error (an error written into the template is just part of it)
+func (e *evalCtx) expandQuasi(template object.Obj, depth int) (result object.Obj, ok bool, err error) {
+	switch template.Type {
+	case object.OBJ_TYPE_UNQUOTE:
+		if depth == 1 {
+			value, err := e.Evaluate(template.D.(object.Unquote))
+			return value, err == nil && value.Type != object.OBJ_TYPE_ERROR, err
+		}
+		return e.expandNested(template, depth-1)
+
+	case object.OBJ_TYPE_SPLICE:
+		if depth == 1 {
+			return e.makeErrorFromObj(template, "quasiquote: ,@ is only allowed inside a list in a quasiquote"), false, nil
+		}
+		return e.expandNested(template, depth-1)
+
+	case object.OBJ_TYPE_QUASI:
+		return e.expandNested(template, depth+1)
+
+	case object.OBJ_TYPE_SOME:
+		return e.expandNested(template, depth)
+
+	case object.OBJ_TYPE_LIST:
+		var items object.List
+		for _, item := range template.D.(object.List) {
+			if item.Type == object.OBJ_TYPE_SPLICE && depth == 1 {
+				spliced, err := e.Evaluate(item.D.(object.Splice))
+				if err != nil || spliced.Type == object.OBJ_TYPE_ERROR {
+					return spliced, false, err
+				}
+				if spliced.Type != object.OBJ_TYPE_LIST {
+					return e.makeErrorFromObj(item, fmt.Sprintf("quasiquote: ,@ expects a list, got %s", spliced.Type)), false, nil
+				}
+				items = append(items, spliced.D.(object.List)...)
+				continue
+			}
+
+			expanded, ok, err := e.expandQuasi(item, depth)
+			if !ok || err != nil {
+				return expanded, ok, err
+			}
+			items = append(items, expanded)
+		}
+		if items == nil {
+			items = object.List{}
+		}
+		listObj := object.Obj{Type: object.OBJ_TYPE_LIST, D: items, Pos: template.Pos}
+		if errObj, ok := e.checkSize(template.Pos, listObj); !ok {
+			return errObj, false, nil
+		}
+		return listObj, true, nil
+
+	case object.OBJ_TYPE_MAP:
+		entries := object.NewMap()
+		for _, entry := range template.D.(*object.Map).Entries() {
+			expanded, ok, err := e.expandQuasi(entry.Value, depth)
+			if !ok || err != nil {
+				return expanded, ok, err
+			}
+			entries.Set(entry.Key, expanded)
+		}
+		mapObj := object.Obj{Type: object.OBJ_TYPE_MAP, D: entries, Pos: template.Pos}
+		if errObj, ok := e.checkSize(template.Pos, mapObj); !ok {
+			return errObj, false, nil
+		}
+		return mapObj, true, nil
+
+	default:
+		return template, true, nil
+	}
+}
+
+// expandNested expands what template wraps and wraps the result the same way
+func (e *evalCtx) expandNested(template object.Obj, depth int) (object.Obj, bool, error) {
+	expanded, ok, err := e.expandQuasi(template.D.(object.Obj), depth)
+	if !ok || err != nil {
+		return expanded, ok, err
+	}
+	return object.Obj{Type: template.Type, D: expanded, Pos: template.Pos}, true, nil
+}
@@ -0,0 +1,211 @@
+package env
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+// Overrides is how a group changes functions defined by the groups added
+// before it. A group that has any implements OverridingGroup
+type Overrides struct {
+	// Shadow names functions of this group that are meant to replace an
+	// existing definition. Replacing one that is not listed is a conflict
+	Shadow []object.Identifier
+
+	// Alias binds new names (the keys) to existing functions (the values.)
+	// Targets are resolved before this group's own functions are added, so an
+	// alias keeps a shadowed original reachable under another name
+	Alias map[object.Identifier]object.Identifier
+
+	// Remove hides existing functions
+	Remove []object.Identifier
+}
+
+type OverridingGroup interface {
+	FunctionGroup
+	Overrides() Overrides
+}
+
+// FunctionConflict is a name that two groups disagree about, or an override
+// that refers to a function that does not exist
+type FunctionConflict struct {
+	Name  object.Identifier
+	Group string
+
+	// Existing is the group that defined Name first. It is empty when an
+	// alias or remove found nothing to act on
+	Existing string
+}
+
+func (c FunctionConflict) Error() string {
+	if c.Existing == "" {
+		return fmt.Sprintf("function group %q overrides %q, which is not defined", c.Group, c.Name)
+	}
+	return fmt.Sprintf("function group %q redefines %q from group %q without shadowing it", c.Group, c.Name, c.Existing)
+}
+
+// FunctionConflicts reports every conflict found adding groups in order, for
+// embedders that would rather fail than be warned
+func FunctionConflicts(groups ...FunctionGroup) []FunctionConflict {
+	registry := newFunctionRegistry(Policy{})
+	var conflicts []FunctionConflict
+	for _, group := range groups {
+		conflicts = append(conflicts, registry.add(group)...)
+	}
+	return conflicts
+}
+
+/*
+functionRegistry resolves env function names. A group's Functions() and
+Overrides() are read once when the group is added and applied, in the order
+groups were added, to one table, so a lookup is a single map access rather
+than a search through every group (each of which builds its map afresh.)
+
+Functions pass through the context's Policy on the way in (see policy.go.)
+Where two groups define the same name, the group added last wins. Removing it
+brings the earlier definition back. Re-adding a group under the same name
+replaces it where it stood.
+*/
+type functionRegistry struct {
+	policy Policy
+
+	order   []string
+	entries map[string]registryEntry
+
+	functions map[object.Identifier]registeredFunction
+}
+
+type registryEntry struct {
+	group     FunctionGroup
+	table     map[object.Identifier]EnvFunction
+	overrides Overrides
+}
+
+type registeredFunction struct {
+	function EnvFunction
+	group    string
+
+	// set when the policy replaced the function's body
+	restricted bool
+}
+
+func newFunctionRegistry(policy Policy) *functionRegistry {
+	return &functionRegistry{
+		policy:    policy,
+		entries:   make(map[string]registryEntry),
+		functions: make(map[object.Identifier]registeredFunction),
+	}
+}
+
+// add registers group under its name and reports any conflicts it brings
+func (r *functionRegistry) add(group FunctionGroup) []FunctionConflict {
+	name := group.Name()
+	entry := registryEntry{group: group, table: group.Functions()}
+	if overriding, ok := group.(OverridingGroup); ok {
+		entry.overrides = overriding.Overrides()
+	}
+
+	if _, exists := r.entries[name]; exists {
+		r.entries[name] = entry
+		return r.rebuild()
+	}
+
+	r.entries[name] = entry
+	r.order = append(r.order, name)
+	return r.apply(name, entry)
+}
+
+func (r *functionRegistry) remove(name string) {
+	if _, exists := r.entries[name]; !exists {
+		return
+	}
+	delete(r.entries, name)
+	for i, existing := range r.order {
+		if existing == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	r.rebuild()
+}
+
+// rebuild applies every group again from an empty table. Only conflicts from
+// the group being replaced are new, but reporting all of them is harmless
+func (r *functionRegistry) rebuild() []FunctionConflict {
+	clear(r.functions)
+	var conflicts []FunctionConflict
+	for _, name := range r.order {
+		conflicts = append(conflicts, r.apply(name, r.entries[name])...)
+	}
+	return conflicts
+}
+
+func (r *functionRegistry) apply(name string, entry registryEntry) []FunctionConflict {
+	var conflicts []FunctionConflict
+
+	aliased := make(map[object.Identifier]registeredFunction, len(entry.overrides.Alias))
+	for alias, target := range entry.overrides.Alias {
+		existing, found := r.functions[target]
+		if !found {
+			conflicts = append(conflicts, FunctionConflict{Name: target, Group: name})
+			continue
+		}
+		aliased[alias] = registeredFunction{function: existing.function, group: name, restricted: existing.restricted}
+	}
+
+	for _, ident := range entry.overrides.Remove {
+		if _, found := r.functions[ident]; !found {
+			conflicts = append(conflicts, FunctionConflict{Name: ident, Group: name})
+			continue
+		}
+		delete(r.functions, ident)
+	}
+
+	shadows := make(map[object.Identifier]bool, len(entry.overrides.Shadow))
+	for _, ident := range entry.overrides.Shadow {
+		shadows[ident] = true
+	}
+	for ident, function := range entry.table {
+		if existing, found := r.functions[ident]; found && !shadows[ident] {
+			conflicts = append(conflicts, FunctionConflict{Name: ident, Group: name, Existing: existing.group})
+		}
+		function, restricted := r.policy.restrict(name, ident, function)
+		r.functions[ident] = registeredFunction{function: function, group: name, restricted: restricted}
+	}
+
+	for alias, function := range aliased {
+		if existing, found := r.functions[alias]; found && !shadows[alias] {
+			conflicts = append(conflicts, FunctionConflict{Name: alias, Group: name, Existing: existing.group})
+		}
+		r.functions[alias] = function
+	}
+
+	// tables are maps, so put the report in an order that does not change
+	// from run to run
+	slices.SortFunc(conflicts, func(a, b FunctionConflict) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return conflicts
+}
+
+func (r *functionRegistry) group(name string) FunctionGroup {
+	return r.entries[name].group
+}
+
+// owner is the name of the group that a function resolves through
+func (r *functionRegistry) owner(ident object.Identifier) string {
+	return r.functions[ident].group
+}
+
+// restricted reports whether the policy has a say in calls to a function
+func (r *functionRegistry) restricted(ident object.Identifier) bool {
+	return r.functions[ident].restricted
+}
+
+func (r *functionRegistry) lookup(ident object.Identifier) (EnvFunction, bool) {
+	registered, found := r.functions[ident]
+	return registered.function, found
+}
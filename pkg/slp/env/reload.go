@@ -0,0 +1,121 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+/*
+Reloading
+
+Every file `use` or `import` runs is remembered along with its modification
+time. `reload` runs one of them again. A module is run in a fresh scope of its
+own and its exports are bound again everywhere it was imported, dropping any
+name it no longer exports; if it fails, it keeps what it had. Any other file
+is run again in the scope reload is called from, as `use` runs it.
+
+ChangedFiles and Reload do the same for a host. repl.Session's watch mode
+uses them to reload edited files before each evaluation.
+*/
+
+type loadedFile struct {
+	path    string
+	absPath string
+	modTime time.Time
+}
+
+func (l *moduleLoader) track(path string, absPath string, modTime time.Time) {
+	if file := l.file(absPath); file != nil {
+		file.path, file.modTime = path, modTime
+		return
+	}
+	l.files = append(l.files, &loadedFile{path: path, absPath: absPath, modTime: modTime})
+}
+
+func (l *moduleLoader) file(absPath string) *loadedFile {
+	for _, file := range l.files {
+		if file.absPath == absPath {
+			return file
+		}
+	}
+	return nil
+}
+
+func (e *evalCtx) ChangedFiles() []string {
+	var changed []string
+	for _, file := range e.modules.files {
+		modTime, err := e.fs.ModTime(file.path)
+		if err == nil && !modTime.Equal(file.modTime) {
+			changed = append(changed, file.absPath)
+		}
+	}
+	return changed
+}
+
+func (e *evalCtx) ReloadContext(ctx context.Context, path string) (object.Obj, error) {
+	defer e.withContext(ctx)()
+	return e.Reload(path)
+}
+
+func (e *evalCtx) Reload(path string) (object.Obj, error) {
+	return e.reload(object.Obj{Type: object.OBJ_TYPE_STRING, D: path}, e.absPath(path))
+}
+
+func (e *evalCtx) reload(arg object.Obj, abs string) (object.Obj, error) {
+	file := e.modules.file(abs)
+	if file == nil {
+		return e.makeErrorFromObj(arg, fmt.Sprintf("reload: %s has not been run by use or import", abs)), nil
+	}
+	if errObj, ok := e.checkCircular("reload", arg, abs); !ok {
+		return errObj, nil
+	}
+
+	previous, isModule := e.modules.modules[abs]
+	if !isModule {
+		result, err := e.runFile("reload", arg, file.path, abs)
+		if err != nil || result.Type == object.OBJ_TYPE_ERROR {
+			return result, err
+		}
+		e.modules.used[abs] = true
+		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+	}
+
+	loaded, errObj, err := e.runModule("reload", arg, file.path, abs)
+	if err != nil || loaded == nil {
+		return errObj, err
+	}
+	loaded.imports = previous.imports
+	e.modules.modules[abs] = loaded
+
+	for _, imported := range loaded.imports {
+		for _, name := range previous.names {
+			if _, kept := loaded.values[name]; kept {
+				continue
+			}
+			ident := object.Identifier(imported.prefix + "/" + string(name))
+			if _, err := imported.mem.Get(ident, true); err == nil {
+				e.shared.meter.release(1)
+			}
+			imported.mem.Delete(ident, true)
+		}
+		if errObj, ok := e.bindModule(arg.Pos, imported.mem, imported.prefix, loaded); !ok {
+			return errObj, nil
+		}
+	}
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+}
+
+func cmdReload(ctx EvaluationContext, args object.List) (object.Obj, error) {
+	evalCtx := ctx.(*evalCtx)
+	for _, arg := range args {
+		fullPath := evalCtx.modules.resolve(evalCtx.fs, evalCtx.currentFilePath, arg.D.(string))
+		result, err := evalCtx.reload(arg, evalCtx.absPath(fullPath))
+		if err != nil || result.Type == object.OBJ_TYPE_ERROR {
+			return result, err
+		}
+	}
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+}
@@ -0,0 +1,114 @@
+package env
+
+import (
+	"fmt"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+// DefaultMaxRecursionDepth is used when the builder is not given a depth. Every
+// call (user `fn` or env function) counts as one frame
+const DefaultMaxRecursionDepth = 10000
+
+/*
+The call stack is shared by every evalCtx forked from the same root so that
+depth is counted across closures, `use`d files, and callbacks made from inside
+env functions (list/map, match, etc.)
+
+Frames are only used for diagnostics and the depth limit - memory scoping is
+still entirely handled by MEM forks.
+*/
+type callStack struct {
+	frames   []object.Frame
+	maxDepth int
+}
+
+func newCallStack(maxDepth int) *callStack {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxRecursionDepth
+	}
+	return &callStack{
+		maxDepth: maxDepth,
+	}
+}
+
+func (s *callStack) push(frame object.Frame) bool {
+	if len(s.frames) >= s.maxDepth {
+		return false
+	}
+	s.frames = append(s.frames, frame)
+	return true
+}
+
+// replace swaps the innermost frame for a tail call
+func (s *callStack) replace(frame object.Frame) {
+	if len(s.frames) > 0 {
+		s.frames[len(s.frames)-1] = frame
+	}
+}
+
+func (s *callStack) pop() {
+	if len(s.frames) > 0 {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+}
+
+// snapshot returns a copy of the stack, innermost frame first
+func (s *callStack) snapshot() []object.Frame {
+	trace := make([]object.Frame, len(s.frames))
+	for i, frame := range s.frames {
+		trace[len(s.frames)-1-i] = frame
+	}
+	return trace
+}
+
+func (e *evalCtx) frameFor(callee object.Obj) object.Frame {
+	name := "<fn>"
+	if callee.Type == object.OBJ_TYPE_IDENTIFIER {
+		name = string(callee.D.(object.Identifier))
+	}
+
+	file := callee.Pos.File()
+	if file == "" {
+		file = e.currentFilePath
+	}
+
+	return object.Frame{
+		Name:     name,
+		File:     file,
+		Position: callee.Pos,
+	}
+}
+
+// pushFrame enters a call. If the recursion limit has been reached the frame
+// is not pushed and the depth error is returned instead
+func (e *evalCtx) pushFrame(frame object.Frame) (object.Obj, bool) {
+	if !e.shared.stack.push(frame) {
+		return e.makeCodedError(
+			frame.Position,
+			ErrorCodeLimit,
+			fmt.Sprintf("maximum recursion depth exceeded (%d) calling %s", e.shared.stack.maxDepth, frame.Name),
+		), false
+	}
+	e.shared.meter.enter(len(e.shared.stack.frames))
+	return object.Obj{}, true
+}
+
+func (e *evalCtx) popFrame() {
+	e.shared.stack.pop()
+}
+
+// traced stamps the current call stack onto an error that is leaving a call
+// for the first time. Errors that already carry a trace keep the original one
+func (e *evalCtx) traced(result object.Obj) object.Obj {
+	if result.Type != object.OBJ_TYPE_ERROR {
+		return result
+	}
+	errData := result.D.(object.Error)
+	if errData.Trace != nil {
+		return result
+	}
+	errData.Trace = e.shared.stack.snapshot()
+	result.D = errData
+	return result
+}
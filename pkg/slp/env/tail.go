@@ -0,0 +1,81 @@
+package env
+
+import (
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+/*
+Tail calls
+
+An expression is in tail position when its value becomes the result of the
+function it appears in: the last instruction of a body, either branch of an
+`if` that is itself in tail position, the last item of such a `do`, and the
+handler a `match` in tail position dispatches to.
+
+A call to a user function found there is not made. Its arguments are
+evaluated in the caller's scope and it is handed back as a tailCall, which
+callFunction runs in place of the call that produced it. Nothing ever calls
+into a tailCall, so the Go stack does not grow with tail recursion.
+
+tailCall values never escape callFunction: only the body loop starts a tail
+evaluation, and only the tail-aware forms continue one.
+*/
+
+// objTypeTailCall is internal to the evaluator and never seen by scripts
+const objTypeTailCall object.ObjType = "tail_call"
+
+type tailCall struct {
+	frame    object.Frame
+	function object.Obj
+	args     object.List
+}
+
+// evaluateTail evaluates obj in tail position
+func (e *evalCtx) evaluateTail(obj object.Obj) (object.Obj, error) {
+	if obj.Type != object.OBJ_TYPE_LIST {
+		return e.Evaluate(obj)
+	}
+	return e.execute(obj.D.(object.List), true)
+}
+
+// evaluateResult is used by tail-aware forms for the expression that becomes
+// their result; it stays in tail position only if the form itself was
+func (e *evalCtx) evaluateResult(obj object.Obj) (object.Obj, error) {
+	if e.tailOf != nil {
+		return e.evaluateTail(obj)
+	}
+	return e.Evaluate(obj)
+}
+
+// inTail returns a copy of the context for a tail-aware form to run in.
+// Anything evaluated through the copy other than via evaluateResult goes
+// back to the original context and out of tail position
+func (e *evalCtx) inTail() *evalCtx {
+	tailCtx := *e
+	tailCtx.tailOf = e
+	return &tailCtx
+}
+
+func (e *evalCtx) makeTailCall(frame object.Frame, functionObj object.Obj, args object.List) (object.Obj, error) {
+	evaledArgs, errObj, err := e.evaluateCallArgs(frame, functionObj.D.(object.Function), args)
+	if err != nil {
+		return object.Obj{}, err
+	}
+	if errObj.Type == object.OBJ_TYPE_ERROR {
+		return errObj, nil
+	}
+	return e.tailCallTo(frame, functionObj, evaledArgs), nil
+}
+
+// tailCallTo hands an already-evaluated call back to the enclosing function
+func (e *evalCtx) tailCallTo(frame object.Frame, functionObj object.Obj, args object.List) object.Obj {
+	return object.Obj{
+		Type: objTypeTailCall,
+		D: tailCall{
+			frame:    frame,
+			function: functionObj,
+			args:     args,
+		},
+		Pos: frame.Position,
+	}
+}
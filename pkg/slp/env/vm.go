@@ -0,0 +1,425 @@
+package env
+
+import (
+	"fmt"
+
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+// Engine selects how an evaluation context runs code
+type Engine int
+
+const (
+	// EngineTree walks the object tree directly
+	EngineTree Engine = iota
+
+	// EngineVM compiles the bodies of functions that are called more than
+	// once to bytecode and runs that instead (see compile.go)
+	EngineVM
+)
+
+func (e Engine) String() string {
+	switch e {
+	case EngineTree:
+		return "tree"
+	case EngineVM:
+		return "vm"
+	default:
+		return fmt.Sprintf("engine(%d)", int(e))
+	}
+}
+
+// ParseEngine is the inverse of Engine.String
+func ParseEngine(name string) (Engine, error) {
+	switch name {
+	case "tree":
+		return EngineTree, nil
+	case "vm":
+		return EngineVM, nil
+	default:
+		return EngineTree, fmt.Errorf("unknown engine %q (expected tree or vm)", name)
+	}
+}
+
+/*
+The VM runs one chunk per Go call: a user function call still goes through
+callFunction, which runs the callee's body as a chunk of its own, so the call
+stack, limits, and tail calls are shared with the tree walker. The chunks
+running at once share one operand stack and one stack of marks, each working
+above where the stacks stood when it started.
+
+Inside a chunk, errors travel the way they do between tree walker calls.
+Wherever the tree walker hands an error straight back (an argument, a head, an
+item of a `do`), opCheck raises it instead: the marks the chunk has open are
+unwound, innermost first, until a guard is found. Core forms left on the way
+run the checks their env function would have made on the way out, and a
+guard (the value of a `set`, the expression of a `try`) takes the error as the
+value it was waiting for.
+*/
+
+type markKind uint8
+
+const (
+	markForm markKind = iota
+	markGuard
+	markHandler
+)
+
+type mark struct {
+	kind markKind
+
+	// markForm
+	site  int
+	frame object.Frame
+
+	// markGuard
+	depth  int
+	resume int
+}
+
+type machine struct {
+	e     *evalCtx
+	chunk *chunk
+	pc    int
+
+	// the shared stacks, and where they stood when the chunk started
+	stack     *[]object.Obj
+	marks     *[]mark
+	stackBase int
+	markBase  int
+}
+
+// run runs a function body compiled to c in e, the scope of the call
+func (e *evalCtx) run(c *chunk) (object.Obj, error) {
+	m := machine{
+		e:     e,
+		chunk: c,
+		stack: &e.shared.operands,
+		marks: &e.shared.marks,
+	}
+	m.stackBase, m.markBase = len(*m.stack), len(*m.marks)
+	defer m.release()
+
+	result, err := m.run()
+	if err != nil {
+		m.leave()
+		return object.Obj{}, err
+	}
+	return result, nil
+}
+
+// release gives the shared stacks back as the chunk found them, letting go
+// of the values it left there
+func (m *machine) release() {
+	clear((*m.stack)[m.stackBase:])
+	*m.stack = (*m.stack)[:m.stackBase]
+	*m.marks = (*m.marks)[:m.markBase]
+}
+
+func (m *machine) push(obj object.Obj) {
+	*m.stack = append(*m.stack, obj)
+}
+
+func (m *machine) pop() object.Obj {
+	stack := *m.stack
+	obj := stack[len(stack)-1]
+	*m.stack = stack[:len(stack)-1]
+	return obj
+}
+
+func (m *machine) top() *object.Obj {
+	stack := *m.stack
+	return &stack[len(stack)-1]
+}
+
+// popArgs takes the top n values off the stack as a new list
+func (m *machine) popArgs(n int) object.List {
+	stack := *m.stack
+	args := make(object.List, n)
+	copy(args, stack[len(stack)-n:])
+	*m.stack = stack[:len(stack)-n]
+	return args
+}
+
+func (m *machine) pushMark(mk mark) {
+	*m.marks = append(*m.marks, mk)
+}
+
+func (m *machine) hasMarks() bool {
+	return len(*m.marks) > m.markBase
+}
+
+func (m *machine) popMark() mark {
+	marks := *m.marks
+	mk := marks[len(marks)-1]
+	*m.marks = marks[:len(marks)-1]
+	return mk
+}
+
+// raise unwinds to the innermost guard and resumes there with errObj. If the
+// chunk has no guard open, raise reports false and errObj is its result
+func (m *machine) raise(errObj object.Obj) (object.Obj, bool) {
+	for m.hasMarks() {
+		mk := m.popMark()
+		switch mk.kind {
+		case markForm:
+			errObj = m.e.envResult(mk.frame, *m.chunk.sites[mk.site].env, errObj)
+			m.e.popFrame()
+		case markHandler:
+			m.e.mem.Delete("$error", false)
+		case markGuard:
+			*m.stack = (*m.stack)[:mk.depth]
+			m.push(errObj)
+			m.pc = mk.resume
+			return object.Obj{}, true
+		}
+	}
+	return errObj, false
+}
+
+// leave closes every open mark without looking at results, for tail calls
+// and Go errors leaving the chunk
+func (m *machine) leave() {
+	for m.hasMarks() {
+		switch mk := m.popMark(); mk.kind {
+		case markForm:
+			m.e.popFrame()
+		case markHandler:
+			m.e.mem.Delete("$error", false)
+		}
+	}
+}
+
+func (m *machine) run() (object.Obj, error) {
+	e := m.e
+	code := m.chunk.code
+
+	for m.pc < len(code) {
+		in := code[m.pc]
+		m.pc++
+
+		switch in.op {
+		case opConst:
+			m.push(m.chunk.consts[in.a])
+
+		case opLoad:
+			identObj := m.chunk.consts[in.a]
+			value, err := e.lookupIdentifier(identObj, identObj.D.(object.Identifier))
+			if err != nil {
+				return object.Obj{}, err
+			}
+			m.push(value)
+
+		case opLoadLocal:
+			if scope, ok := e.mem.(*scopeMem); ok && int(in.b) < len(scope.slots) {
+				if value := scope.slots[in.b]; value.Type != "" {
+					m.push(value)
+					continue
+				}
+			}
+			identObj := m.chunk.consts[in.a]
+			value, err := e.lookupIdentifier(identObj, identObj.D.(object.Identifier))
+			if err != nil {
+				return object.Obj{}, err
+			}
+			m.push(value)
+
+		case opEval:
+			value, err := e.Evaluate(m.chunk.consts[in.a])
+			if err != nil {
+				return object.Obj{}, err
+			}
+			m.push(value)
+
+		case opPop:
+			m.pop()
+
+		case opCheck:
+			if m.top().Type != object.OBJ_TYPE_ERROR {
+				continue
+			}
+			if result, resumed := m.raise(m.pop()); !resumed {
+				return result, nil
+			}
+
+		case opArgPos:
+			m.top().Pos = m.chunk.spans[in.a]
+
+		case opCheckCancel:
+			if err := e.checkCancelled(); err != nil {
+				return object.Obj{}, err
+			}
+
+		case opJump:
+			m.pc = int(in.a)
+
+		case opEnter, opEnterEnv:
+			s := &m.chunk.sites[in.a]
+			if err := e.checkCancelled(); err != nil {
+				return object.Obj{}, err
+			}
+			if errObj, ok := e.step(s.list[0].Pos); !ok {
+				m.push(errObj)
+				m.pc = s.end
+				continue
+			}
+			if in.op == opEnter {
+				continue
+			}
+			shadow, err := e.mem.Get(s.name, true)
+			if err != nil {
+				continue
+			}
+			result, err := e.dispatch(s.list, shadow, s.tail)
+			if err != nil {
+				return object.Obj{}, err
+			}
+			if result.Type == objTypeTailCall {
+				m.leave()
+				return result, nil
+			}
+			m.push(result)
+			m.pc = s.end
+
+		case opDispatch:
+			s := &m.chunk.sites[in.a]
+			head := *m.top()
+			if head.Type == object.OBJ_TYPE_FUNCTION {
+				if errObj, ok := e.checkArity(e.frameFor(s.list[0]), head.D.(object.Function), s.list[1:]); !ok {
+					*m.top() = errObj
+					m.pc = s.end
+				}
+				continue
+			}
+			m.pop()
+			result, err := e.dispatch(s.list, head, s.tail)
+			if err != nil {
+				return object.Obj{}, err
+			}
+			if result.Type == objTypeTailCall {
+				m.leave()
+				return result, nil
+			}
+			m.push(result)
+			m.pc = s.end
+
+		case opCall:
+			s := &m.chunk.sites[in.a]
+			frame := e.frameFor(s.list[0])
+			stack := *m.stack
+			depth := len(stack) - s.argc - 1
+			function := stack[depth]
+			if s.tail || function.D.(object.Function).Variadic {
+				args := m.popArgs(s.argc)
+				m.pop()
+				if s.tail {
+					m.leave()
+					return e.tailCallTo(frame, function, args), nil
+				}
+				result, err := e.callFunction(frame, function, args)
+				if err != nil {
+					return object.Obj{}, err
+				}
+				m.push(result)
+				continue
+			}
+
+			// the callee copies its arguments into its scope before it runs
+			// anything, so they can be handed over where they lie
+			result, err := e.callFunction(frame, function, stack[depth+1:])
+			if err != nil {
+				return object.Obj{}, err
+			}
+			*m.stack = (*m.stack)[:depth]
+			m.push(result)
+
+		case opCallEnv:
+			s := &m.chunk.sites[in.a]
+			args := s.list[1:]
+			if s.env.EvaluateArgs {
+				args = m.popArgs(s.argc)
+			}
+			callCtx := e
+			if s.tail && s.env.tailPosition {
+				callCtx = e.inTail()
+			}
+			result, err := callCtx.callEnvFunction(e.frameFor(s.list[0]), *s.env, args)
+			if err != nil {
+				return object.Obj{}, err
+			}
+			if result.Type == objTypeTailCall {
+				m.leave()
+				return result, nil
+			}
+			m.push(result)
+
+		case opPushForm:
+			s := &m.chunk.sites[in.a]
+			frame := e.frameFor(s.list[0])
+			if errObj, ok := e.pushFrame(frame); !ok {
+				m.push(errObj)
+				m.pc = s.end
+				continue
+			}
+			m.pushMark(mark{kind: markForm, site: int(in.a), frame: frame})
+
+		case opPopForm:
+			mk := m.popMark()
+			*m.top() = e.envResult(mk.frame, *m.chunk.sites[in.a].env, *m.top())
+			e.popFrame()
+
+		case opBranch:
+			s := &m.chunk.sites[in.a]
+			condition := m.pop()
+			if condition.Type != object.OBJ_TYPE_INTEGER {
+				m.push(e.makeErrorFromObj(s.list[1], fmt.Sprintf("if: condition must evaluate to integer, got %s", condition.Type)))
+				m.pc = s.exit
+				continue
+			}
+			if condition.D.(object.Integer) <= 0 {
+				m.pc = s.alt
+			}
+
+		case opSet:
+			target := m.chunk.sites[in.a].list[1]
+			name := target.D.(object.Identifier)
+			if _, err := e.mem.Get(name, true); err != nil {
+				if errObj, ok := e.bind(target.Pos, 1); !ok {
+					*m.top() = errObj
+					continue
+				}
+			}
+			e.mem.Set(name, *m.top(), true)
+
+		case opMakeFn:
+			m.push(object.Obj{
+				Type: object.OBJ_TYPE_FUNCTION,
+				D:    *m.chunk.sites[in.a].proto,
+				C:    e.mem,
+			})
+
+		case opGuard:
+			m.pushMark(mark{kind: markGuard, depth: len(*m.stack), resume: int(in.a)})
+
+		case opUnguard:
+			m.popMark()
+
+		case opCatch:
+			if m.top().Type != object.OBJ_TYPE_ERROR {
+				m.pc = int(in.a)
+				continue
+			}
+			e.mem.Set("$error", m.pop(), false)
+			m.pushMark(mark{kind: markHandler})
+
+		case opEndHandler:
+			m.popMark()
+			e.mem.Delete("$error", false)
+
+		default:
+			panic(fmt.Sprintf("vm: unknown opcode %d", in.op))
+		}
+	}
+
+	return m.pop(), nil
+}
@@ -0,0 +1,48 @@
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+/*
+Integers come in two representations. An integer object holds an Integer
+(int64), and a bigint object holds a *big.Int for values that don't fit in one.
+Arithmetic moves between the two with IntegerFromBig, so a value only ever has
+one of them: a bigint is always outside the int64 range, and a bigint result
+that comes back into range is an integer again. That keeps Encode round
+tripping, since a literal too large for an int64 parses as a bigint.
+
+A *big.Int in a bigint object is never changed once the object is made.
+*/
+
+var (
+	minInteger = big.NewInt(math.MinInt64)
+	maxInteger = big.NewInt(math.MaxInt64)
+)
+
+// IntegerFromBig returns n as an integer object when it fits in an int64, and
+// as a bigint object when it doesn't. n must not be changed afterwards
+func IntegerFromBig(n *big.Int) Obj {
+	if n.Cmp(minInteger) >= 0 && n.Cmp(maxInteger) <= 0 {
+		return Obj{Type: OBJ_TYPE_INTEGER, D: Integer(n.Int64())}
+	}
+	return Obj{Type: OBJ_TYPE_BIGINT, D: n}
+}
+
+// BigOf returns the value of an integer or bigint object as a new big.Int the
+// caller may change, or false for any other object
+func BigOf(obj Obj) (*big.Int, bool) {
+	switch obj.Type {
+	case OBJ_TYPE_INTEGER:
+		return big.NewInt(int64(obj.D.(Integer))), true
+	case OBJ_TYPE_BIGINT:
+		return new(big.Int).Set(obj.D.(*big.Int)), true
+	}
+	return nil, false
+}
+
+// IsInteger reports whether obj is an integer in either representation
+func IsInteger(obj Obj) bool {
+	return obj.Type == OBJ_TYPE_INTEGER || obj.Type == OBJ_TYPE_BIGINT
+}
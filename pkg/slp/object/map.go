@@ -0,0 +1,120 @@
+package object
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+/*
+Map is a dictionary keyed by strings, integers, reals, and identifiers. Keys
+of different types never collide (1 and 1.0 are different keys), and a map
+remembers the order its keys were first set in: keys, values, iteration, and
+Encode all follow it, so the same program always prints the same map.
+
+Like a list, a map is changed in place by the functions that set and delete,
+and it is the same map wherever it has been bound.
+*/
+type Map struct {
+	index   map[string]int
+	entries []MapEntry
+}
+
+type MapEntry struct {
+	Key   Obj
+	Value Obj
+}
+
+func NewMap() *Map {
+	return &Map{index: make(map[string]int)}
+}
+
+// IsMapKey reports whether obj can key a map
+func IsMapKey(obj Obj) bool {
+	switch obj.Type {
+	case OBJ_TYPE_STRING, OBJ_TYPE_INTEGER, OBJ_TYPE_BIGINT, OBJ_TYPE_REAL, OBJ_TYPE_IDENTIFIER:
+		return true
+	}
+	return false
+}
+
+func hashKey(key Obj) string {
+	return string(key.Type) + ":" + key.Encode()
+}
+
+func (m *Map) Len() int {
+	return len(m.entries)
+}
+
+func (m *Map) Get(key Obj) (Obj, bool) {
+	i, found := m.index[hashKey(key)]
+	if !found {
+		return Obj{}, false
+	}
+	return m.entries[i].Value, true
+}
+
+func (m *Map) Has(key Obj) bool {
+	_, found := m.index[hashKey(key)]
+	return found
+}
+
+// Set binds key to value, keeping the key's place if it is already there
+func (m *Map) Set(key Obj, value Obj) error {
+	if !IsMapKey(key) {
+		return fmt.Errorf("invalid map key type: %s", key.Type)
+	}
+	hash := hashKey(key)
+	if i, found := m.index[hash]; found {
+		m.entries[i].Value = value
+		return nil
+	}
+	m.index[hash] = len(m.entries)
+	m.entries = append(m.entries, MapEntry{Key: key, Value: value})
+	return nil
+}
+
+// Delete removes key, reporting whether it was there
+func (m *Map) Delete(key Obj) bool {
+	hash := hashKey(key)
+	i, found := m.index[hash]
+	if !found {
+		return false
+	}
+	delete(m.index, hash)
+	m.entries = append(m.entries[:i], m.entries[i+1:]...)
+	for j := i; j < len(m.entries); j++ {
+		m.index[hashKey(m.entries[j].Key)] = j
+	}
+	return true
+}
+
+// Entries are the map's pairs in order. The slice belongs to the map and must
+// not be changed
+func (m *Map) Entries() []MapEntry {
+	return m.entries
+}
+
+func (m *Map) Keys() List {
+	keys := make(List, len(m.entries))
+	for i, entry := range m.entries {
+		keys[i] = entry.Key
+	}
+	return keys
+}
+
+func (m *Map) Values() List {
+	values := make(List, len(m.entries))
+	for i, entry := range m.entries {
+		values[i] = entry.Value
+	}
+	return values
+}
+
+// Copy is a new map with the same entries; the values themselves are shared
+func (m *Map) Copy() *Map {
+	return &Map{
+		index:   maps.Clone(m.index),
+		entries: slices.Clone(m.entries),
+	}
+}
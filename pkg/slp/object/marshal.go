@@ -0,0 +1,538 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+/*
+Marshal and Unmarshal convert between Go values and objects:
+
+	Go                      object
+	bool                    integer (1 or 0)
+	int*, uint*             integer, or bigint for a uint past an int64
+	big.Int                 integer, or bigint when it doesn't fit in an int64
+	float32, float64        real
+	string                  string
+	Identifier              identifier
+	Function                function
+	Obj                     itself
+	[]byte                  bytes (Unmarshal also takes a list)
+	slice, array            list
+	map, struct             map (Unmarshal also takes a list of
+	                        (key value) pairs)
+	pointer                 what it points to, or none when nil
+	any                     (Unmarshal only) int64, *big.Int, float64,
+	                        string, Identifier, []byte, []any, map[any]any,
+	                        nil, or the Obj itself
+
+A struct field is keyed by its `slpx` tag, or by its name when it has none,
+and a tag of "-" leaves it out. Options follow the name after a comma:
+"omitempty" keeps a zero value out of Marshal, and "required" makes Unmarshal
+fail when the pair is missing. An embedded struct without a tag lends its
+fields to the struct it is in.
+
+	type Server struct {
+		Host  string   `slpx:"host,required"`
+		Port  uint16   `slpx:"port"`
+		Tags  []string `slpx:"tags,omitempty"`
+	}
+
+	{host "localhost" port 8080}
+
+Struct keys marshal as identifiers, in field order, and Unmarshal takes either
+an identifier or a string for them. Map keys are converted like any other
+value, must be something a map can be keyed by, and are sorted so that the
+same Go map always marshals the same. Integers and
+reals convert into each other on Unmarshal as long as nothing is lost, so 8080.0
+fills a uint16 but 8080.5 does not.
+*/
+
+// MarshalError is a value that could not be converted. Path says where it is
+// inside the value given, as in servers[2].port
+type MarshalError struct {
+	Path    string
+	Message string
+}
+
+func (e *MarshalError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+func marshalError(path string, format string, args ...any) error {
+	return &MarshalError{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	objGoType        = reflect.TypeFor[Obj]()
+	identifierGoType = reflect.TypeFor[Identifier]()
+	functionGoType   = reflect.TypeFor[Function]()
+	bigIntGoType     = reflect.TypeFor[big.Int]()
+)
+
+// Marshal converts v to the object it stands for
+func Marshal(v any) (Obj, error) {
+	return marshal(reflect.ValueOf(v), "")
+}
+
+func marshal(value reflect.Value, path string) (Obj, error) {
+	if !value.IsValid() {
+		return Obj{Type: OBJ_TYPE_NONE, D: None{}}, nil
+	}
+
+	switch value.Type() {
+	case objGoType:
+		return value.Interface().(Obj), nil
+	case identifierGoType:
+		return Obj{Type: OBJ_TYPE_IDENTIFIER, D: Identifier(value.String())}, nil
+	case functionGoType:
+		return Obj{Type: OBJ_TYPE_FUNCTION, D: value.Interface().(Function)}, nil
+	case bigIntGoType:
+		n := value.Interface().(big.Int)
+		return IntegerFromBig(new(big.Int).Set(&n)), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return Obj{Type: OBJ_TYPE_NONE, D: None{}}, nil
+		}
+		return marshal(value.Elem(), path)
+
+	case reflect.Bool:
+		n := Integer(0)
+		if value.Bool() {
+			n = 1
+		}
+		return Obj{Type: OBJ_TYPE_INTEGER, D: n}, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Obj{Type: OBJ_TYPE_INTEGER, D: Integer(value.Int())}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() > math.MaxInt64 {
+			return IntegerFromBig(new(big.Int).SetUint64(value.Uint())), nil
+		}
+		return Obj{Type: OBJ_TYPE_INTEGER, D: Integer(value.Uint())}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return Obj{Type: OBJ_TYPE_REAL, D: Real(value.Float())}, nil
+
+	case reflect.String:
+		return Obj{Type: OBJ_TYPE_STRING, D: value.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			if value.IsNil() {
+				return Obj{Type: OBJ_TYPE_BYTES, D: Bytes{}}, nil
+			}
+			return Obj{Type: OBJ_TYPE_BYTES, D: Bytes(slices.Clone(value.Bytes()))}, nil
+		}
+		items := make(List, value.Len())
+		for i := range items {
+			item, err := marshal(value.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return Obj{}, err
+			}
+			items[i] = item
+		}
+		return Obj{Type: OBJ_TYPE_LIST, D: items}, nil
+
+	case reflect.Map:
+		entries := make([]MapEntry, 0, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			key, err := marshal(iter.Key(), path)
+			if err != nil {
+				return Obj{}, err
+			}
+			if !IsMapKey(key) {
+				return Obj{}, marshalError(path, "%s cannot key a map", key.Type)
+			}
+			item, err := marshal(iter.Value(), fmt.Sprintf("%s[%s]", path, key.Encode()))
+			if err != nil {
+				return Obj{}, err
+			}
+			entries = append(entries, MapEntry{Key: key, Value: item})
+		}
+		// map order is random; sorting keeps the same map marshalling the same
+		slices.SortFunc(entries, func(a, b MapEntry) int {
+			return strings.Compare(a.Key.Encode(), b.Key.Encode())
+		})
+		m := NewMap()
+		for _, entry := range entries {
+			m.Set(entry.Key, entry.Value)
+		}
+		return Obj{Type: OBJ_TYPE_MAP, D: m}, nil
+
+	case reflect.Struct:
+		m := NewMap()
+		for _, field := range structFields(value.Type()) {
+			fieldValue := value.FieldByIndex(field.index)
+			if field.omitEmpty && fieldValue.IsZero() {
+				continue
+			}
+			item, err := marshal(fieldValue, fieldPath(path, field.name))
+			if err != nil {
+				return Obj{}, err
+			}
+			m.Set(Obj{Type: OBJ_TYPE_IDENTIFIER, D: Identifier(field.name)}, item)
+		}
+		return Obj{Type: OBJ_TYPE_MAP, D: m}, nil
+	}
+
+	return Obj{}, marshalError(path, "unsupported type %s", value.Type())
+}
+
+// Unmarshal stores obj in the value target points to
+func Unmarshal(obj Obj, target any) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return marshalError("", "unmarshal needs a non-nil pointer, got %T", target)
+	}
+	return unmarshal(obj, value.Elem(), "")
+}
+
+func unmarshal(obj Obj, value reflect.Value, path string) error {
+	t := value.Type()
+
+	expect := func(objType ObjType) error {
+		if obj.Type != objType {
+			return marshalError(path, "expected %s, got %s", objType, obj.Type)
+		}
+		return nil
+	}
+
+	switch t {
+	case objGoType:
+		value.Set(reflect.ValueOf(obj))
+		return nil
+	case identifierGoType:
+		if err := expect(OBJ_TYPE_IDENTIFIER); err != nil {
+			return err
+		}
+		value.SetString(string(obj.D.(Identifier)))
+		return nil
+	case functionGoType:
+		if err := expect(OBJ_TYPE_FUNCTION); err != nil {
+			return err
+		}
+		value.Set(reflect.ValueOf(obj.D.(Function)))
+		return nil
+	case bigIntGoType:
+		n, ok := BigOf(obj)
+		if !ok {
+			return marshalError(path, "expected integer, got %s", obj.Type)
+		}
+		value.Set(reflect.ValueOf(n).Elem())
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if obj.Type == OBJ_TYPE_NONE {
+			value.SetZero()
+			return nil
+		}
+		if value.IsNil() {
+			value.Set(reflect.New(t.Elem()))
+		}
+		return unmarshal(obj, value.Elem(), path)
+
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return marshalError(path, "unsupported type %s", t)
+		}
+		if natural := naturalValue(obj); natural != nil {
+			value.Set(reflect.ValueOf(natural))
+		} else {
+			value.SetZero()
+		}
+		return nil
+
+	case reflect.Bool:
+		if err := expect(OBJ_TYPE_INTEGER); err != nil {
+			return err
+		}
+		value.SetBool(obj.D.(Integer) != 0)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := integerOf(obj, path)
+		if err != nil {
+			return err
+		}
+		if value.OverflowInt(n) {
+			return marshalError(path, "%d does not fit in %s", n, t)
+		}
+		value.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if obj.Type == OBJ_TYPE_BIGINT {
+			// past the int64 range, but may still fit a uint64
+			n := obj.D.(*big.Int)
+			if !n.IsUint64() || value.OverflowUint(n.Uint64()) {
+				return marshalError(path, "%s does not fit in %s", n, t)
+			}
+			value.SetUint(n.Uint64())
+			return nil
+		}
+		n, err := integerOf(obj, path)
+		if err != nil {
+			return err
+		}
+		if n < 0 || value.OverflowUint(uint64(n)) {
+			return marshalError(path, "%d does not fit in %s", n, t)
+		}
+		value.SetUint(uint64(n))
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch obj.Type {
+		case OBJ_TYPE_REAL:
+			f = float64(obj.D.(Real))
+		case OBJ_TYPE_INTEGER:
+			f = float64(obj.D.(Integer))
+		default:
+			return marshalError(path, "expected real, got %s", obj.Type)
+		}
+		if value.OverflowFloat(f) {
+			return marshalError(path, "%g does not fit in %s", f, t)
+		}
+		value.SetFloat(f)
+		return nil
+
+	case reflect.String:
+		if err := expect(OBJ_TYPE_STRING); err != nil {
+			return err
+		}
+		value.SetString(obj.D.(string))
+		return nil
+
+	case reflect.Slice:
+		if obj.Type == OBJ_TYPE_BYTES && t.Elem().Kind() == reflect.Uint8 {
+			data := reflect.ValueOf(slices.Clone(obj.D.(Bytes)))
+			value.Set(data.Convert(t))
+			return nil
+		}
+		if err := expect(OBJ_TYPE_LIST); err != nil {
+			return err
+		}
+		items := obj.D.(List)
+		slice := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			if err := unmarshal(item, slice.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+
+	case reflect.Array:
+		if err := expect(OBJ_TYPE_LIST); err != nil {
+			return err
+		}
+		items := obj.D.(List)
+		if len(items) > t.Len() {
+			return marshalError(path, "expected at most %d elements, got %d", t.Len(), len(items))
+		}
+		value.SetZero()
+		for i, item := range items {
+			if err := unmarshal(item, value.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		pairs, err := pairsOf(obj, path)
+		if err != nil {
+			return err
+		}
+		if value.IsNil() {
+			value.Set(reflect.MakeMapWithSize(t, len(pairs)))
+		}
+		for i, p := range pairs {
+			key := reflect.New(t.Key()).Elem()
+			if err := unmarshal(p[0], key, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+			item := reflect.New(t.Elem()).Elem()
+			if err := unmarshal(p[1], item, fmt.Sprintf("%s[%s]", path, p[0].Encode())); err != nil {
+				return err
+			}
+			value.SetMapIndex(key, item)
+		}
+		return nil
+
+	case reflect.Struct:
+		pairs, err := pairsOf(obj, path)
+		if err != nil {
+			return err
+		}
+		byName := make(map[string]Obj, len(pairs))
+		for i, p := range pairs {
+			switch p[0].Type {
+			case OBJ_TYPE_IDENTIFIER:
+				byName[string(p[0].D.(Identifier))] = p[1]
+			case OBJ_TYPE_STRING:
+				byName[p[0].D.(string)] = p[1]
+			default:
+				return marshalError(fmt.Sprintf("%s[%d]", path, i), "expected an identifier or string key, got %s", p[0].Type)
+			}
+		}
+		for _, field := range structFields(t) {
+			item, found := byName[field.name]
+			if !found {
+				if field.required {
+					return marshalError(fieldPath(path, field.name), "required but missing")
+				}
+				continue
+			}
+			if err := unmarshal(item, value.FieldByIndex(field.index), fieldPath(path, field.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return marshalError(path, "unsupported type %s", t)
+}
+
+// integerOf takes an integer, or a real with nothing after the point
+func integerOf(obj Obj, path string) (int64, error) {
+	switch obj.Type {
+	case OBJ_TYPE_INTEGER:
+		return int64(obj.D.(Integer)), nil
+	case OBJ_TYPE_BIGINT:
+		return 0, marshalError(path, "%s does not fit in an int64", obj.Encode())
+	case OBJ_TYPE_REAL:
+		f := float64(obj.D.(Real))
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, marshalError(path, "%g is not a whole number", f)
+		}
+		return int64(f), nil
+	}
+	return 0, marshalError(path, "expected integer, got %s", obj.Type)
+}
+
+// naturalValue is what an object is when nothing says what Go type it should be
+func naturalValue(obj Obj) any {
+	switch obj.Type {
+	case OBJ_TYPE_NONE:
+		return nil
+	case OBJ_TYPE_INTEGER:
+		return int64(obj.D.(Integer))
+	case OBJ_TYPE_BIGINT:
+		return new(big.Int).Set(obj.D.(*big.Int))
+	case OBJ_TYPE_REAL:
+		return float64(obj.D.(Real))
+	case OBJ_TYPE_STRING:
+		return obj.D.(string)
+	case OBJ_TYPE_IDENTIFIER:
+		return obj.D.(Identifier)
+	case OBJ_TYPE_BYTES:
+		return []byte(slices.Clone(obj.D.(Bytes)))
+	case OBJ_TYPE_LIST:
+		items := obj.D.(List)
+		natural := make([]any, len(items))
+		for i, item := range items {
+			natural[i] = naturalValue(item)
+		}
+		return natural
+	case OBJ_TYPE_MAP:
+		entries := obj.D.(*Map).Entries()
+		natural := make(map[any]any, len(entries))
+		for _, entry := range entries {
+			natural[naturalValue(entry.Key)] = naturalValue(entry.Value)
+		}
+		return natural
+	}
+	return obj
+}
+
+// pairsOf reads a map, or a list of (key value) pairs
+func pairsOf(obj Obj, path string) ([][2]Obj, error) {
+	if obj.Type == OBJ_TYPE_MAP {
+		entries := obj.D.(*Map).Entries()
+		pairs := make([][2]Obj, len(entries))
+		for i, entry := range entries {
+			pairs[i] = [2]Obj{entry.Key, entry.Value}
+		}
+		return pairs, nil
+	}
+	if obj.Type != OBJ_TYPE_LIST {
+		return nil, marshalError(path, "expected list or map, got %s", obj.Type)
+	}
+	items := obj.D.(List)
+	pairs := make([][2]Obj, len(items))
+	for i, item := range items {
+		if item.Type != OBJ_TYPE_LIST || len(item.D.(List)) != 2 {
+			return nil, marshalError(fmt.Sprintf("%s[%d]", path, i), "expected a (key value) pair, got %s", item.Encode())
+		}
+		pairs[i] = [2]Obj{item.D.(List)[0], item.D.(List)[1]}
+	}
+	return pairs, nil
+}
+
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	required  bool
+}
+
+// structFields lists the fields of t that are marshalled, in order
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag, hasTag := field.Tag.Lookup("slpx")
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous && !hasTag && field.Type.Kind() == reflect.Struct {
+			for _, inner := range structFields(field.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		structField := structField{name: name, index: []int{i}}
+		for option := range strings.SplitSeq(options, ",") {
+			switch option {
+			case "omitempty":
+				structField.omitEmpty = true
+			case "required":
+				structField.required = true
+			}
+		}
+		fields = append(fields, structField)
+	}
+	return fields
+}
@@ -0,0 +1,86 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+type testEndpoint struct {
+	Host string   `slpx:"host,required"`
+	Port uint16   `slpx:"port"`
+	Tags []string `slpx:"tags,omitempty"`
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		objType  ObjType
+		expected string
+	}{
+		{"int", int8(-3), OBJ_TYPE_INTEGER, "-3"},
+		{"uint_in_range", uint64(math.MaxInt64), OBJ_TYPE_INTEGER, "9223372036854775807"},
+		{"uint_past_int64", uint64(math.MaxUint64), OBJ_TYPE_BIGINT, "18446744073709551615"},
+		{"uint_just_past_int64", uint(math.MaxInt64) + 1, OBJ_TYPE_BIGINT, "9223372036854775808"},
+		{"bool", true, OBJ_TYPE_INTEGER, "1"},
+		{"slice", []string{"a", "b"}, OBJ_TYPE_LIST, `("a" "b")`},
+		{"map_keys_sorted", map[string]int{"b": 2, "a": 1}, OBJ_TYPE_MAP, `{"a" 1 "b" 2}`},
+		{"struct_in_field_order", testEndpoint{Host: "h", Port: 80}, OBJ_TYPE_MAP, `{host "h" port 80}`},
+		{"nested", map[string]testEndpoint{"x": {Host: "h", Tags: []string{"t"}}}, OBJ_TYPE_MAP, `{"x" {host "h" port 0 tags ("t")}}`},
+		{"nil_pointer", (*testEndpoint)(nil), OBJ_TYPE_NONE, "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.Type != tt.objType {
+				t.Errorf("expected %s, got %s", tt.objType, obj.Type)
+			}
+			if obj.Encode() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, obj.Encode())
+			}
+		})
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	if _, err := Marshal(map[[2]int]int{{1, 2}: 3}); err == nil {
+		t.Error("expected a key no map can hold to be refused")
+	}
+	if _, err := Marshal(map[string]chan int{"c": nil}); err == nil {
+		t.Error("expected a channel to be refused")
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	in := map[string]testEndpoint{
+		"primary": {Host: "p", Port: 8080, Tags: []string{"a"}},
+		"backup":  {Host: "b"},
+	}
+	obj, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]testEndpoint
+	if err := Unmarshal(obj, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out["primary"].Port != 8080 || out["primary"].Tags[0] != "a" || out["backup"].Host != "b" {
+		t.Errorf("round trip changed the value: %+v", out)
+	}
+
+	big, err := Marshal(uint64(math.MaxUint64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n uint64
+	if err := Unmarshal(big, &n); err != nil || n != math.MaxUint64 {
+		t.Errorf("expected the bigint back as a uint64, got %d %v", n, err)
+	}
+	var small int64
+	if err := Unmarshal(big, &small); err == nil {
+		t.Error("expected the bigint not to fit an int64")
+	}
+}
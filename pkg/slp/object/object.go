@@ -1,7 +1,12 @@
 package object
 
 import (
+	"encoding/hex"
 	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync/atomic"
 )
 
 type ObjType string
@@ -17,20 +22,56 @@ const (
 	OBJ_TYPE_REAL       ObjType = "real"
 	OBJ_TYPE_IDENTIFIER ObjType = "identifier"
 	OBJ_TYPE_FUNCTION   ObjType = "function"
+	OBJ_TYPE_MAP        ObjType = "map"
+	OBJ_TYPE_BYTES      ObjType = "bytes"
+	OBJ_TYPE_BIGINT     ObjType = "bigint"
+
+	// a quasiquote template and the unquoted parts inside it. These are only
+	// ever parsed; evaluating the template fills the unquoted parts in
+	OBJ_TYPE_QUASI   ObjType = "quasi"
+	OBJ_TYPE_UNQUOTE ObjType = "unquote"
+	OBJ_TYPE_SPLICE  ObjType = "splice"
 )
 
 type List []Obj
 type Some = Obj
+type Quasi = Obj
+type Unquote = Obj
+type Splice = Obj
 type None struct{}
 type Error struct {
 	File     string
-	Position int
+	Position Span
 	Message  string
+
+	// Code names the kind of error, so that handlers can tell errors apart
+	// without reading their messages. Empty when the error has none
+	Code string
+
+	// Data is an object the error carries, and Cause the error it wraps.
+	// Either may be nil
+	Data  *Obj
+	Cause *Error
+
+	// Trace is the call stack at the point the error left its first function
+	// call, innermost frame first
+	Trace []Frame
+}
+
+// Frame is a single function call in an error backtrace
+type Frame struct {
+	Name     string
+	File     string
+	Position Span
 }
 type Integer int64
 type Real float64
 type Identifier string
 
+// Bytes is binary data. Unlike a list it is a value: nothing changes one in
+// place, and the functions that "modify" bytes return new ones
+type Bytes []byte
+
 type Parameter struct {
 	Name Identifier
 	Type ObjType
@@ -42,12 +83,31 @@ type Function struct {
 	Variadic   bool
 	Body       List
 	Self       Obj
+
+	// Code is where an engine keeps what it compiled Body to. `fn` gives
+	// every function it makes one of its own, and copies of the function
+	// share it
+	Code *Code
+}
+
+// Code holds the compiled form of a function body for the engine that
+// compiled it. Nothing else looks inside
+type Code struct {
+	compiled atomic.Value
+}
+
+func (c *Code) Load() any {
+	return c.compiled.Load()
+}
+
+func (c *Code) Store(compiled any) {
+	c.compiled.Store(compiled)
 }
 
 type Obj struct {
 	Type ObjType
 	D    any
-	Pos  uint16
+	Pos  Span
 
 	C any
 }
@@ -59,6 +119,12 @@ func (o Obj) Encode() string {
 	case OBJ_TYPE_SOME:
 		quoted := o.D.(Some)
 		return "'" + quoted.Encode()
+	case OBJ_TYPE_QUASI:
+		return "`" + o.D.(Quasi).Encode()
+	case OBJ_TYPE_UNQUOTE:
+		return "," + o.D.(Unquote).Encode()
+	case OBJ_TYPE_SPLICE:
+		return ",@" + o.D.(Splice).Encode()
 	case OBJ_TYPE_LIST:
 		list := o.D.(List)
 		if len(list) == 0 {
@@ -73,11 +139,25 @@ func (o Obj) Encode() string {
 		}
 		result += ")"
 		return result
+	case OBJ_TYPE_MAP:
+		result := "{"
+		for i, entry := range o.D.(*Map).Entries() {
+			if i > 0 {
+				result += " "
+			}
+			result += entry.Key.Encode() + " " + entry.Value.Encode()
+		}
+		result += "}"
+		return result
 	case OBJ_TYPE_STRING:
 		str := o.D.(string)
 		return escapeString(str)
+	case OBJ_TYPE_BYTES:
+		return "#x" + hex.EncodeToString(o.D.(Bytes))
 	case OBJ_TYPE_INTEGER:
 		return fmt.Sprintf("%d", o.D.(Integer))
+	case OBJ_TYPE_BIGINT:
+		return o.D.(*big.Int).String()
 	case OBJ_TYPE_REAL:
 		return fmt.Sprintf("%g", float64(o.D.(Real)))
 	case OBJ_TYPE_IDENTIFIER:
@@ -85,9 +165,9 @@ func (o Obj) Encode() string {
 	case OBJ_TYPE_ERROR:
 		err := o.D.(Error)
 		if err.File != "" {
-			return fmt.Sprintf("ERROR:%s:%d:%s", err.File, err.Position, err.Message)
+			return fmt.Sprintf("ERROR:%s:%d:%d:%s", err.File, err.Position.Line, err.Position.Column, err.Message)
 		}
-		return fmt.Sprintf("ERROR:%d:%s", err.Position, err.Message)
+		return fmt.Sprintf("ERROR:%d:%d:%s", err.Position.Line, err.Position.Column, err.Message)
 	case OBJ_TYPE_FUNCTION:
 		function := o.D.(Function)
 		return fmt.Sprintf("FUNCTION:LEN:%d", len(function.Body))
@@ -105,18 +185,35 @@ func (o Obj) DeepCopy() Obj {
 			newList[i] = item.DeepCopy()
 		}
 		return Obj{Type: OBJ_TYPE_LIST, D: newList, Pos: o.Pos}
+	case OBJ_TYPE_MAP:
+		newMap := o.D.(*Map).Copy()
+		for i := range newMap.entries {
+			newMap.entries[i].Value = newMap.entries[i].Value.DeepCopy()
+		}
+		return Obj{Type: OBJ_TYPE_MAP, D: newMap, Pos: o.Pos}
 	case OBJ_TYPE_SOME:
 		originalSome := o.D.(Some)
 		return Obj{Type: OBJ_TYPE_SOME, D: originalSome.DeepCopy(), Pos: o.Pos}
+	case OBJ_TYPE_QUASI, OBJ_TYPE_UNQUOTE, OBJ_TYPE_SPLICE:
+		return Obj{Type: o.Type, D: o.D.(Obj).DeepCopy(), Pos: o.Pos}
 	case OBJ_TYPE_NONE:
 		return Obj{Type: OBJ_TYPE_NONE, D: None{}, Pos: o.Pos}
 	case OBJ_TYPE_ERROR:
 		originalErr := o.D.(Error)
-		return Obj{Type: OBJ_TYPE_ERROR, D: Error{File: originalErr.File, Position: originalErr.Position, Message: originalErr.Message}, Pos: o.Pos}
+		var trace []Frame
+		if originalErr.Trace != nil {
+			trace = make([]Frame, len(originalErr.Trace))
+			copy(trace, originalErr.Trace)
+		}
+		return Obj{Type: OBJ_TYPE_ERROR, D: originalErr.deepCopy(trace), Pos: o.Pos}
 	case OBJ_TYPE_STRING:
 		return Obj{Type: OBJ_TYPE_STRING, D: o.D.(string), Pos: o.Pos}
+	case OBJ_TYPE_BYTES:
+		return Obj{Type: OBJ_TYPE_BYTES, D: Bytes(slices.Clone(o.D.(Bytes))), Pos: o.Pos}
 	case OBJ_TYPE_INTEGER:
 		return Obj{Type: OBJ_TYPE_INTEGER, D: o.D.(Integer), Pos: o.Pos}
+	case OBJ_TYPE_BIGINT:
+		return Obj{Type: OBJ_TYPE_BIGINT, D: new(big.Int).Set(o.D.(*big.Int)), Pos: o.Pos}
 	case OBJ_TYPE_REAL:
 		return Obj{Type: OBJ_TYPE_REAL, D: o.D.(Real), Pos: o.Pos}
 	case OBJ_TYPE_IDENTIFIER:
@@ -137,6 +234,7 @@ func (o Obj) DeepCopy() Obj {
 			Variadic:   originalFunction.Variadic,
 			Body:       newBody,
 			Self:       originalFunction.Self,
+			Code:       originalFunction.Code,
 		}, C: o.C, Pos: o.Pos}
 	default:
 		copy := o
@@ -145,6 +243,35 @@ func (o Obj) DeepCopy() Obj {
 	}
 }
 
+// Summary is the message, led by the code when there is one, and followed by a
+// "caused by" line for each error in the cause chain
+func (e Error) Summary() string {
+	var summary strings.Builder
+	for current, first := &e, true; current != nil; current, first = current.Cause, false {
+		if !first {
+			summary.WriteString("\ncaused by: ")
+		}
+		if current.Code != "" {
+			summary.WriteString("[" + current.Code + "] ")
+		}
+		summary.WriteString(current.Message)
+	}
+	return summary.String()
+}
+
+func (e Error) deepCopy(trace []Frame) Error {
+	copied := Error{File: e.File, Position: e.Position, Message: e.Message, Code: e.Code, Trace: trace}
+	if e.Data != nil {
+		data := e.Data.DeepCopy()
+		copied.Data = &data
+	}
+	if e.Cause != nil {
+		cause := e.Cause.deepCopy(slices.Clone(e.Cause.Trace))
+		copied.Cause = &cause
+	}
+	return copied
+}
+
 func escapeString(s string) string {
 	result := "\""
 	for _, r := range s {
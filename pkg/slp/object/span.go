@@ -0,0 +1,138 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+/*
+A SourceID names the text an object was parsed from (typically a file path.)
+Objects carry the small ID rather than the path itself so that spans stay cheap
+to copy around the evaluator, while still letting any diagnostic find its way
+back to the file that produced it - even when that file was pulled in by `use`
+long after the original parse.
+
+The zero ID is reserved for "unknown source."
+*/
+type SourceID uint32
+
+type Span struct {
+	Source SourceID
+	Start  int
+	End    int
+	Line   int
+	Column int
+}
+
+var sourceRegistry = struct {
+	sync.RWMutex
+	names []string
+	ids   map[string]SourceID
+}{
+	names: []string{""},
+	ids:   map[string]SourceID{"": 0},
+}
+
+// RegisterSource returns the ID for the given source name, registering it if
+// it has not been seen yet. Registering the same name twice yields the same ID
+func RegisterSource(name string) SourceID {
+	sourceRegistry.RLock()
+	id, exists := sourceRegistry.ids[name]
+	sourceRegistry.RUnlock()
+	if exists {
+		return id
+	}
+
+	sourceRegistry.Lock()
+	defer sourceRegistry.Unlock()
+	if id, exists := sourceRegistry.ids[name]; exists {
+		return id
+	}
+	id = SourceID(len(sourceRegistry.names))
+	sourceRegistry.names = append(sourceRegistry.names, name)
+	sourceRegistry.ids[name] = id
+	return id
+}
+
+// SourceName returns the name a source was registered with, or "" if unknown
+func SourceName(id SourceID) string {
+	sourceRegistry.RLock()
+	defer sourceRegistry.RUnlock()
+	if int(id) >= len(sourceRegistry.names) {
+		return ""
+	}
+	return sourceRegistry.names[id]
+}
+
+// IsZero reports whether the span points at nothing. Parsed objects always
+// have a line of at least 1, so a zero line means "no location known"
+func (s Span) IsZero() bool {
+	return s.Line == 0
+}
+
+func (s Span) File() string {
+	return SourceName(s.Source)
+}
+
+func (s Span) String() string {
+	if s.IsZero() {
+		return "?"
+	}
+	if file := s.File(); file != "" {
+		return fmt.Sprintf("%s:%d:%d", file, s.Line, s.Column)
+	}
+	return fmt.Sprintf("%d:%d", s.Line, s.Column)
+}
+
+func (f Frame) String() string {
+	location := f.File
+	if !f.Position.IsZero() {
+		location = fmt.Sprintf("%s:%d:%d", f.File, f.Position.Line, f.Position.Column)
+	}
+	if location == "" {
+		return f.Name
+	}
+	return fmt.Sprintf("%s (%s)", f.Name, location)
+}
+
+// SourceLine is line n of content, counting from 1, for showing beneath a
+// diagnostic. It is false when content has no such line
+func SourceLine(content string, n int) (string, bool) {
+	for ; n > 1; n-- {
+		newline := strings.IndexByte(content, '\n')
+		if newline < 0 {
+			return "", false
+		}
+		content = content[newline+1:]
+	}
+	if n < 1 || content == "" {
+		return "", false
+	}
+	line, _, _ := strings.Cut(content, "\n")
+	return line, true
+}
+
+// FormatBacktrace renders the frames innermost first, eliding the middle of
+// very deep stacks (runaway recursion) so the useful ends stay visible
+func FormatBacktrace(trace []Frame) string {
+	if len(trace) == 0 {
+		return ""
+	}
+
+	const head, tail = 15, 5
+
+	var output strings.Builder
+	output.WriteString("\nBacktrace (most recent call first):")
+	for i, frame := range trace {
+		if len(trace) > head+tail && i == head {
+			output.WriteString(fmt.Sprintf("\n  ... %d more frames ...", len(trace)-head-tail))
+		}
+		if len(trace) > head+tail && i >= head && i < len(trace)-tail {
+			continue
+		}
+		output.WriteString(fmt.Sprintf("\n  at %s", frame))
+	}
+
+	return output.String()
+}
@@ -0,0 +1,54 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSourceLine(t *testing.T) {
+	content := "first\nsecond\n\nfourth"
+	tests := []struct {
+		n    int
+		line string
+		ok   bool
+	}{
+		{1, "first", true},
+		{2, "second", true},
+		{3, "", true},
+		{4, "fourth", true},
+		{5, "", false},
+		{0, "", false},
+	}
+	for _, tt := range tests {
+		if line, ok := SourceLine(content, tt.n); line != tt.line || ok != tt.ok {
+			t.Errorf("line %d: expected %q %v, got %q %v", tt.n, tt.line, tt.ok, line, ok)
+		}
+	}
+	if _, ok := SourceLine("only\n", 2); ok {
+		t.Error("expected no line after a trailing newline")
+	}
+}
+
+func TestFormatBacktrace(t *testing.T) {
+	if FormatBacktrace(nil) != "" {
+		t.Error("expected nothing for an empty trace")
+	}
+
+	short := FormatBacktrace([]Frame{{Name: "f", File: "main.slpx", Position: Span{Line: 2, Column: 3}}, {Name: "<top>"}})
+	if short != "\nBacktrace (most recent call first):\n  at f (main.slpx:2:3)\n  at <top>" {
+		t.Errorf("unexpected backtrace %q", short)
+	}
+
+	deep := make([]Frame, 100)
+	for i := range deep {
+		deep[i] = Frame{Name: fmt.Sprintf("f%d", i)}
+	}
+	lines := strings.Split(FormatBacktrace(deep), "\n")[1:]
+	if len(lines) != 1+15+1+5 {
+		t.Fatalf("expected the middle of a deep trace to be elided, got %d lines", len(lines))
+	}
+	if lines[15] != "  at f14" || lines[16] != "  ... 80 more frames ..." || lines[17] != "  at f95" {
+		t.Errorf("expected the first 15 and last 5 frames around the elision, got %q", lines[15:18])
+	}
+}
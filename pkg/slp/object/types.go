@@ -27,6 +27,9 @@ var (
 	SYMBOL_ObjType_Real       = ":R"
 	SYMBOL_ObjType_Identifier = ":X"
 	SYMBOL_ObjType_Function   = ":F"
+	SYMBOL_ObjType_Map        = ":M"
+	SYMBOL_ObjType_Bytes      = ":B"
+	SYMBOL_ObjType_BigInt     = ":Z"
 )
 
 func GetTypeFromIdentifier(target Identifier) (ObjType, error) {
@@ -51,6 +54,12 @@ func GetTypeFromIdentifier(target Identifier) (ObjType, error) {
 		return OBJ_TYPE_IDENTIFIER, nil
 	case SYMBOL_ObjType_Function:
 		return OBJ_TYPE_FUNCTION, nil
+	case SYMBOL_ObjType_Map:
+		return OBJ_TYPE_MAP, nil
+	case SYMBOL_ObjType_Bytes:
+		return OBJ_TYPE_BYTES, nil
+	case SYMBOL_ObjType_BigInt:
+		return OBJ_TYPE_BIGINT, nil
 	default:
 		return "", fmt.Errorf("invalid type identifier: %s", target)
 	}
@@ -78,6 +87,12 @@ func GetIdentifierFromType(target ObjType) Identifier {
 		return Identifier(SYMBOL_ObjType_Identifier)
 	case OBJ_TYPE_FUNCTION:
 		return Identifier(SYMBOL_ObjType_Function)
+	case OBJ_TYPE_MAP:
+		return Identifier(SYMBOL_ObjType_Map)
+	case OBJ_TYPE_BYTES:
+		return Identifier(SYMBOL_ObjType_Bytes)
+	case OBJ_TYPE_BIGINT:
+		return Identifier(SYMBOL_ObjType_BigInt)
 	default:
 		return Identifier(SYMBOL_ObjType_None)
 	}
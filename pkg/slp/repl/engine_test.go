@@ -0,0 +1,273 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bosley/slpx/pkg/slp/env"
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+var engines = []env.Engine{env.EngineTree, env.EngineVM}
+
+func newEngineSession(engine env.Engine, limits env.Limits) *Session {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewSessionBuilder(logger).WithEngine(engine).WithLimits(limits).Build("test.slpx")
+}
+
+// outcome is everything about an evaluation that the engines must agree on
+type outcome struct {
+	result string
+	err    string
+	trace  []string
+	usage  env.Usage
+}
+
+func evaluateWith(engine env.Engine, limits env.Limits, source string) outcome {
+	session := newEngineSession(engine, limits)
+	result, err := session.Evaluate(source)
+
+	var out outcome
+	out.result = result.Encode()
+	if err != nil {
+		out.err = err.Error()
+	}
+	if result.Type == object.OBJ_TYPE_ERROR {
+		for _, frame := range result.D.(object.Error).Trace {
+			out.trace = append(out.trace, frame.String())
+		}
+	}
+	out.usage = session.Usage()
+	return out
+}
+
+func TestEnginesAgree(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits env.Limits
+		source string
+	}{
+		{"arithmetic", env.Limits{}, `(int/add 1 (int/mul 2 3))`},
+		{"closures", env.Limits{}, `
+(set make_adder (fn (n :I) :F (fn (x :I) :I (int/add x n))))
+(set add2 (make_adder 2))
+(add2 40)`},
+		{"variadic", env.Limits{}, `
+(set count (fn (..) :I (list/len $args)))
+(count 1 "two" 3.0)`},
+		{"do_and_set", env.Limits{}, `
+(set x 1)
+(do (set x (int/add x 1)) (set y (int/mul x 10)) (int/add x y))`},
+		{"bound_errors_propagate", env.Limits{}, `
+(try (set e (int/add "a" 1)) (reflect/error? e))`},
+		{"set_outer_from_function", env.Limits{}, `
+(set total 0)
+(set bump (fn (n :I) :I (set total (int/add total n))))
+(bump 5)
+(bump 7)
+total`},
+		{"drop_parameter", env.Limits{}, `
+(set n 100)
+(set f (fn (n :I) :I (do (drop n) n)))
+(f 1)`},
+		{"try_catches", env.Limits{}, `(try (int/add (undefined_thing) 1) (error/message $error))`},
+		{"try_rethrows", env.Limits{}, `(try @oops(first) $error)`},
+		{"try_passes_values", env.Limits{}, `(try 42 "handler")`},
+		{"try_cleans_up", env.Limits{}, `
+(try (int/add "x" 1) (putln (error/message $error)))
+(reflect/type? $error)`},
+		{"nested_try", env.Limits{}, `
+(try (try (int/add "x" 1) (int/add $error 1)) (str/concat "outer: " (error/message $error)))`},
+		{"structured_errors", env.Limits{}, `
+(set caught (try (error/wrap @io(disk gone) "config" "could not load" {"path" "/etc/app"}) $error))`},
+		{"error_accessors", env.Limits{}, `
+(try (error/wrap @io(disk gone) "config" "could not load" {"path" "/etc/app"})
+  {code (error/code $error) data (error/data $error) cause (error/code (error/cause $error))})`},
+		{"catch_clauses", env.Limits{}, `
+(set cleaned 0)
+(set caught (try (throw "io" "disk gone" {"path" "/tmp"})
+  (catch "not_found" "missing")
+  (catch "io" (error/data $error))
+  (finally (set cleaned 1))))
+{caught caught cleaned cleaned}`},
+		{"uncaught_with_finally", env.Limits{}, `
+(set f (fn () :I (try (throw "io" "disk gone") (catch "other" 1) (finally 2))))
+(f)`},
+		{"if_condition_type", env.Limits{}, `(if "yes" 1 0)`},
+		{"if_error_in_condition", env.Limits{}, `
+(set f (fn () :I (if (int/add "x" 1) 1 0)))
+(f)`},
+		{"return_type_mismatch", env.Limits{}, `
+(set f (fn (n :I) :S (if n 1 "no")))
+(f 1)`},
+		{"parameter_type_mismatch", env.Limits{}, `
+(set f (fn (n :I) :I n))
+(f "x")`},
+		{"wrong_arity", env.Limits{}, `
+(set f (fn (a :I b :I) :I (int/add a b)))
+(f 1)`},
+		{"not_callable", env.Limits{}, `(1 2 3)`},
+		{"function_not_found", env.Limits{}, `
+(set g (uq (qu not_a_function)))
+(g 1)`},
+		{"shadowed_env_function", env.Limits{}, `
+(set f (fn (int/add :I) :I (int/add 1 2)))
+(f 5)`},
+		{"identifier_values_call", env.Limits{}, `
+(set plus int/add)
+(plus 20 22)`},
+		{"immediate_lambda", env.Limits{}, `((fn (x :I) :I (int/mul x x)) 7)`},
+		{"match", env.Limits{}, `
+(set classify (fn (n :I) :S
+    (match n
+        '(0 (fn (x :I) :S "zero"))
+        '(1 (fn (x :I) :S "one")))))
+(str/concat (classify 0) (classify 1))`},
+		{"list_callbacks", env.Limits{}, `
+(list/reduce (list/map (uq (qu (1 2 3))) (fn (x :I) :I (int/mul x 2))) 0 (fn (acc :I x :I) :I (int/add acc x)))`},
+		{"map_literals", env.Limits{}, `
+(set make (fn (n :I) :M {"n" n "double" (int/mul n 2)}))
+(set a (make 1))
+(map/set a "n" 10)
+(set b (make 2))
+(str/concat (str/from (map/get a "n")) " " (str/from (map/get b "double")))`},
+		{"map_callbacks", env.Limits{}, `
+(set total 0)
+(map/iter {"a" '(1 2) "b" '(3)} (fn (k :S v :L) :I (do (set total (int/add total (list/len v))) 1)))
+total`},
+		{"map_match", env.Limits{}, `
+(match {"kind" "point" "x" 1}
+    '({"kind" "line"} (fn (m :M) :S "line"))
+    '({"kind" "point"} (fn (m :M) :S "point")))`},
+		{"big_integers", env.Limits{}, `
+(set big (int/pow 2 70))
+{"big" big "one" (int/sub big (int/sub big 1)) "negated" (int/mul big -1) "greater" (int/gt big 5)}`},
+		{"bytes", env.Limits{}, `
+(set header (bytes/write_int (bytes/new 4 0) 0 2 "big" 513))
+(bytes/concat header (bytes/from_str "ok" "utf8") #xff)`},
+		{"map_size_limit", env.Limits{MaxListSize: 2}, `{"a" 1 "b" 2 "c" 3}`},
+		{"malformed_core_forms", env.Limits{}, `(try (if 1 2) (error/message $error))`},
+		{"reserved_names", env.Limits{}, `(set $nope 1)`},
+		{"quoting", env.Limits{}, `(uq (qu (int/add 1 2)))`},
+		{"quasiquoting", env.Limits{}, "(set wrap (fn (x :I rest :L) :L `(x ,x ,@rest {\"next\" ,(int/add x 1)})))\n(wrap 1 '(2 3))"},
+		{"quasiquote_errors", env.Limits{}, "(set f (fn (x :I) :L `(,x ,@x)))\n(f 1)"},
+		{"tail_calls", env.Limits{}, `
+(set loop (fn (n :I acc :I) :I (if (int/eq n 0) acc (do (set m (int/sub n 1)) (loop m (int/add acc 1))))))
+(loop 12000 0)`},
+		{"recursion_limit", env.Limits{MaxRecursionDepth: 50}, `
+(set down (fn (n :I) :I (if (int/eq n 0) 0 (int/add 1 (down (int/sub n 1))))))
+(down 100)`},
+		{"step_limit", env.Limits{MaxSteps: 40}, `
+(set count (fn (n :I) :I (if (int/eq n 0) 0 (count (int/sub n 1)))))
+(count 100)`},
+		{"binding_limit", env.Limits{MaxBindings: 3}, `
+(set a 1)
+(set b 2)
+(set c 3)
+(set d 4)`},
+		{"string_limit", env.Limits{MaxStringSize: 4}, `(if 1 "too long" 0)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := evaluateWith(env.EngineTree, tt.limits, tt.source)
+			vm := evaluateWith(env.EngineVM, tt.limits, tt.source)
+
+			if tree.result != vm.result || tree.err != vm.err {
+				t.Fatalf("engines disagree:\n tree: %s %s\n   vm: %s %s", tree.result, tree.err, vm.result, vm.err)
+			}
+			if !slices.Equal(tree.trace, vm.trace) {
+				t.Errorf("backtraces differ:\n tree: %v\n   vm: %v", tree.trace, vm.trace)
+			}
+			if tree.usage != vm.usage {
+				t.Errorf("usage differs:\n tree: %+v\n   vm: %+v", tree.usage, vm.usage)
+			}
+		})
+	}
+}
+
+func TestEngineCancellation(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.String(), func(t *testing.T) {
+			session := newEngineSession(engine, env.Limits{})
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := session.EvaluateContext(ctx, `
+(set spin (fn (n :I) :I (spin (int/add n 1))))
+(spin 0)`)
+			if !errors.Is(err, env.ErrCancelled) {
+				t.Fatalf("expected ErrCancelled, got %v", err)
+			}
+			if usage := session.Usage(); usage.PeakDepth > 10 {
+				t.Errorf("expected frames to be released, peak depth was %d", usage.PeakDepth)
+			}
+		})
+	}
+}
+
+const benchmarkSource = `
+(set fib (fn (n :I) :I
+    (if (int/lt n 2)
+        n
+        (int/add (fib (int/sub n 1)) (fib (int/sub n 2))))))
+(fib 18)`
+
+func BenchmarkEngines(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine.String(), func(b *testing.B) {
+			session := newEngineSession(engine, env.Limits{})
+			for b.Loop() {
+				if _, err := session.Evaluate(benchmarkSource); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// the primitive suite, minus fs.slpx (it writes to the working directory) and
+// main.slpx (it exits)
+const primitiveSuite = `
+(use "bootstrap.slpx")
+(use "numbers.slpx")
+(use "reflection.slpx")
+(use "str.slpx")
+(use "list.slpx")
+(use "bits.slpx")
+(use "match.slpx")`
+
+func BenchmarkPrimitiveSuite(b *testing.B) {
+	suitePath, err := filepath.Abs("../../../tests/primitive/main.slpx")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, engine := range engines {
+		b.Run(engine.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				sessionIO := env.DefaultIO()
+				sessionIO.SetStdout(io.Discard)
+				session := NewSessionBuilder(slog.New(slog.NewTextHandler(io.Discard, nil))).
+					WithIO(sessionIO).
+					WithEngine(engine).
+					Build(suitePath)
+
+				result, err := session.Evaluate(primitiveSuite)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if result.Type == object.OBJ_TYPE_ERROR {
+					b.Fatal(result.Encode())
+				}
+			}
+		})
+	}
+}
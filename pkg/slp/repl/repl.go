@@ -1,14 +1,19 @@
 package repl
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"path/filepath"
 
 	"github.com/bosley/slpx/pkg/slp/cgs/bits"
+	"github.com/bosley/slpx/pkg/slp/cgs/bytes"
+	"github.com/bosley/slpx/pkg/slp/cgs/errors"
 	"github.com/bosley/slpx/pkg/slp/cgs/fs"
 	"github.com/bosley/slpx/pkg/slp/cgs/host"
 	"github.com/bosley/slpx/pkg/slp/cgs/io"
 	"github.com/bosley/slpx/pkg/slp/cgs/list"
+	"github.com/bosley/slpx/pkg/slp/cgs/maps"
 	"github.com/bosley/slpx/pkg/slp/cgs/numbers"
 	"github.com/bosley/slpx/pkg/slp/cgs/reflection"
 	"github.com/bosley/slpx/pkg/slp/cgs/str"
@@ -29,13 +34,29 @@ type Session struct {
 	env    sessionEnv
 
 	pathOnFS string
+
+	// the macros defined (or imported with $import) by everything the session
+	// has evaluated so far
+	macros map[string]*slp.MacroDef
+
+	// set while watch mode is on
+	onReload ReloadFunc
 }
 
+// ReloadFunc is told what became of each file watch mode reloads. result is an
+// error object when the file failed, and err a Go error (cancellation, exit)
+type ReloadFunc func(path string, result object.Obj, err error)
+
 type SessionBuilder struct {
 	logger *slog.Logger
 	env    sessionEnv
 
 	fgs []env.FunctionGroup
+
+	limits     env.Limits
+	engine     env.Engine
+	policy     env.Policy
+	modulePath []string
 }
 
 func NewSessionBuilder(logger *slog.Logger) *SessionBuilder {
@@ -61,6 +82,39 @@ func (b *SessionBuilder) WithMEM(mem env.MEM) *SessionBuilder {
 	return b
 }
 
+func (b *SessionBuilder) WithMaxRecursionDepth(depth int) *SessionBuilder {
+	b.limits.MaxRecursionDepth = depth
+	return b
+}
+
+// WithLimits bounds what the session's evaluations may consume (see env.Limits)
+func (b *SessionBuilder) WithLimits(limits env.Limits) *SessionBuilder {
+	b.limits = limits
+	return b
+}
+
+// WithEngine picks how the session runs code (see env.Engine)
+func (b *SessionBuilder) WithEngine(engine env.Engine) *SessionBuilder {
+	b.engine = engine
+	return b
+}
+
+// WithPolicy restricts what the session's scripts may call, the built-in
+// groups included (see env.Policy)
+func (b *SessionBuilder) WithPolicy(policy env.Policy) *SessionBuilder {
+	b.policy = policy
+	return b
+}
+
+// WithModulePath sets where `use` and `import` look for files that are not
+// next to the current one (see env.DefaultModulePath)
+func (b *SessionBuilder) WithModulePath(dirs ...string) *SessionBuilder {
+	b.modulePath = dirs
+	return b
+}
+
+// WithFunctionGroup adds a group after the built-in ones, so it takes
+// precedence over them (see env.Overrides)
 func (b *SessionBuilder) WithFunctionGroup(group env.FunctionGroup) *SessionBuilder {
 	b.fgs = append(b.fgs, group)
 	return b
@@ -100,14 +154,21 @@ func (b *SessionBuilder) Build(forPathOnFS string) *Session {
 		WithIO(b.env.io).
 		WithFS(b.env.fs).
 		WithMEM(b.env.mem).
+		WithLimits(b.limits).
+		WithEngine(b.engine).
+		WithPolicy(b.policy).
+		WithModulePath(b.modulePath).
 		WithFunctionGroup(env.NewCoreFunctions()).
 		WithFunctionGroup(numbers.NewArithFunctions()).
 		WithFunctionGroup(str.NewStrFunctions()).
 		WithFunctionGroup(list.NewListFunctions()).
+		WithFunctionGroup(maps.NewMapFunctions()).
 		WithFunctionGroup(reflection.NewReflectionFunctions()).
+		WithFunctionGroup(errors.NewErrorFunctions()).
 		WithFunctionGroup(fsFunctions).
 		WithFunctionGroup(ioFunctions).
 		WithFunctionGroup(bitsFunctions).
+		WithFunctionGroup(bytes.NewBytesFunctions()).
 		WithFunctionGroup(hostFunctions).
 		Build()
 
@@ -127,15 +188,26 @@ func (b *SessionBuilder) Build(forPathOnFS string) *Session {
 }
 
 func (x *Session) Evaluate(source string) (object.Obj, error) {
-	parser := slp.NewParser(source)
+	return x.EvaluateContext(context.Background(), source)
+}
+
+// EvaluateContext is Evaluate, but stops with an env.ErrCancelled error once
+// ctx is done (deadline, Ctrl+C, etc.). A script that runs `exit` stops with an
+// *env.ExitError, leaving the caller to decide whether to end the process
+func (x *Session) EvaluateContext(ctx context.Context, source string) (object.Obj, error) {
+	x.watch(ctx)
+
+	parser := x.NewParser(source)
 	items, err := parser.ParseAll()
 	if err != nil {
 		return object.Obj{}, err
 	}
+	x.macros = parser.Macros
+	x.env.evalCtx.SetMacros(parser.Macros)
 
 	var result object.Obj = object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}
 	for _, item := range items {
-		res, err := x.env.evalCtx.Evaluate(item)
+		res, err := x.env.evalCtx.EvaluateContext(ctx, item)
 		if err != nil {
 			return object.Obj{}, err
 		}
@@ -148,6 +220,86 @@ func (x *Session) Evaluate(source string) (object.Obj, error) {
 	return result, nil
 }
 
+// NewParser makes a parser for source as Evaluate does: it has the macros
+// the session has defined so far, and $import finds files as use does
+func (x *Session) NewParser(source string) *slp.Parser {
+	parser := x.env.evalCtx.NewParser(source, x.pathOnFS)
+	for name, macroDef := range x.macros {
+		parser.Macros[name] = macroDef
+	}
+	return parser
+}
+
+// EvaluateObjectContext is EvaluateContext for an expression that is already
+// an object (a quoted list taken from a config, etc.) rather than source
+func (x *Session) EvaluateObjectContext(ctx context.Context, obj object.Obj) (object.Obj, error) {
+	x.watch(ctx)
+	return x.env.evalCtx.EvaluateContext(ctx, obj)
+}
+
+// Watch turns watch mode on, or off when onReload is nil. In watch mode every
+// evaluation first reloads the files `use` and `import` ran that have changed
+// on the session's FS since (see env.EvaluationContext.ChangedFiles), telling
+// onReload how each went. A file that fails to reload is only reported: the
+// evaluation goes ahead with what the session already had
+func (x *Session) Watch(onReload ReloadFunc) {
+	x.onReload = onReload
+}
+
+func (x *Session) watch(ctx context.Context) {
+	if x.onReload == nil {
+		return
+	}
+	for _, path := range x.env.evalCtx.ChangedFiles() {
+		result, err := x.env.evalCtx.ReloadContext(ctx, path)
+		x.onReload(path, result, err)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Lookup finds the function name refers to in the session: a `fn` value in its
+// MEM or, failing that, an env function. What it returns is ready for Call
+func (x *Session) Lookup(name object.Identifier) (object.Obj, error) {
+	function, err := x.env.evalCtx.Evaluate(object.Obj{Type: object.OBJ_TYPE_IDENTIFIER, D: name})
+	if err != nil {
+		return object.Obj{}, err
+	}
+
+	switch function.Type {
+	case object.OBJ_TYPE_FUNCTION, object.OBJ_TYPE_IDENTIFIER:
+		return function, nil
+	case object.OBJ_TYPE_ERROR:
+		return object.Obj{}, fmt.Errorf("%w: %s", env.ErrUndefinedIdentifier, name)
+	default:
+		return object.Obj{}, fmt.Errorf("%s is not a function: %s", name, function.Type)
+	}
+}
+
+// Call calls a function from Lookup with args as its arguments. They are
+// handed over as they are rather than evaluated, so Go values need no quoting
+// and cannot be mistaken for code
+func (x *Session) Call(function object.Obj, args object.List) (object.Obj, error) {
+	return x.CallContext(context.Background(), function, args)
+}
+
+// CallContext is Call, but stops with an env.ErrCancelled error once ctx is
+// done. Like EvaluateContext, an SLP error is the result, not the error
+func (x *Session) CallContext(ctx context.Context, function object.Obj, args object.List) (object.Obj, error) {
+	return x.env.evalCtx.CallContext(ctx, function, args)
+}
+
+// Usage reports the steps, allocations, and peak depth of everything the
+// session has evaluated since it was built (or since ResetUsage)
+func (x *Session) Usage() env.Usage {
+	return x.env.evalCtx.Usage()
+}
+
+func (x *Session) ResetUsage() {
+	x.env.evalCtx.ResetUsage()
+}
+
 func (x *Session) GetIO() env.IO {
 	return x.env.io
 }
@@ -0,0 +1,1803 @@
+package repl
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bosley/slpx/pkg/slp/cgs/fs"
+	"github.com/bosley/slpx/pkg/slp/cgs/host"
+	"github.com/bosley/slpx/pkg/slp/env"
+	"github.com/bosley/slpx/pkg/slp/object"
+)
+
+func newTestSession(limits env.Limits) *Session {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewSessionBuilder(logger).WithLimits(limits).Build("test.slpx")
+}
+
+func expectLimitError(t *testing.T, result object.Obj, err error, limit string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("expected an SLP error, got Go error: %v", err)
+	}
+	if result.Type != object.OBJ_TYPE_ERROR {
+		t.Fatalf("expected error object, got %s: %s", result.Type, result.Encode())
+	}
+	message := result.D.(object.Error).Message
+	if !strings.HasPrefix(message, "limit exceeded: "+limit) {
+		t.Fatalf("expected %q limit error, got %q", limit, message)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("steps", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxSteps: 50})
+		result, err := session.Evaluate(`
+(set count (fn (n :I) :I (if (int/eq n 0) 0 (count (int/sub n 1)))))
+(count 100)`)
+		expectLimitError(t, result, err, "steps")
+	})
+
+	t.Run("bindings", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxBindings: 3})
+		result, err := session.Evaluate(`
+(set a 1)
+(set b 2)
+(set a 10)
+(set c 3)
+(set d 4)`)
+		expectLimitError(t, result, err, "bindings")
+
+		// dropping a binding frees room for another
+		result, err = session.Evaluate(`(drop a) (set d 4)`)
+		if err != nil || result.Type == object.OBJ_TYPE_ERROR {
+			t.Fatalf("expected set after drop to succeed, got %s (%v)", result.Encode(), err)
+		}
+	})
+
+	t.Run("function_scopes_are_released", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxBindings: 4})
+		result, err := session.Evaluate(`
+(set add (fn (a :I b :I) :I (do (set tmp (int/add a b)) tmp)))
+(add 1 2)
+(add 3 4)
+(add 5 6)`)
+		if err != nil || result.Type == object.OBJ_TYPE_ERROR {
+			t.Fatalf("expected calls to fit within the quota, got %s (%v)", result.Encode(), err)
+		}
+		if usage := session.Usage(); usage.Bindings != 1 {
+			t.Fatalf("expected only the top-level binding to remain live, got %d", usage.Bindings)
+		}
+	})
+
+	t.Run("string_size", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxStringSize: 8})
+		result, err := session.Evaluate(`(str/concat "hello" " world")`)
+		expectLimitError(t, result, err, "string size")
+	})
+
+	t.Run("list_size", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxListSize: 4})
+		result, err := session.Evaluate(`(list/new 10 0)`)
+		expectLimitError(t, result, err, "list size")
+	})
+
+	t.Run("catchable", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxListSize: 4})
+		result, err := session.Evaluate(`(try (list/new 10 0) "caught")`)
+		if err != nil {
+			t.Fatalf("unexpected Go error: %v", err)
+		}
+		if result.Type != object.OBJ_TYPE_STRING || result.D.(string) != "caught" {
+			t.Fatalf("expected try to catch the limit error, got %s", result.Encode())
+		}
+	})
+}
+
+func TestUsage(t *testing.T) {
+	session := newTestSession(env.Limits{})
+	_, err := session.Evaluate(`
+(set down (fn (n :I) :I (if (int/eq n 0) 0 (int/add 1 (down (int/sub n 1))))))
+(down 10)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	usage := session.Usage()
+	if usage.Steps == 0 {
+		t.Errorf("expected steps to be counted")
+	}
+	if usage.Allocations < 11 {
+		t.Errorf("expected at least 11 allocations (down + 10 parameters), got %d", usage.Allocations)
+	}
+	if usage.PeakDepth < 11 {
+		t.Errorf("expected peak depth of at least 11, got %d", usage.PeakDepth)
+	}
+
+	session.ResetUsage()
+	if usage := session.Usage(); usage.Steps != 0 || usage.PeakDepth != 0 || usage.Bindings != 1 {
+		t.Errorf("expected counters to reset with live bindings kept, got %+v", usage)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// each of these recurses far past DefaultMaxRecursionDepth, which only
+	// works if the recursive call reuses the caller's frame
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"body", `
+(set loop (fn (n :I acc :I) :I (if (int/eq n 0) acc (loop (int/sub n 1) (int/add acc 1)))))
+(loop 20000 0)`},
+		{"do", `
+(set loop (fn (n :I) :I (if (int/eq n 0) 20000 (do (set m (int/sub n 1)) (loop m)))))
+(loop 20000)`},
+		{"match", `
+(set loop (fn (n :I) :I
+    (match (int/eq n 0)
+        '(1 (fn (x :I) :I 20000))
+        '(0 (fn (x :I) :I (loop (int/sub n 1)))))))
+(loop 20000)`},
+		{"mutual", `
+(set is_even (fn (n :I) :I (if (int/eq n 0) 1 (is_odd (int/sub n 1)))))
+(set is_odd (fn (n :I) :I (if (int/eq n 0) 0 (is_even (int/sub n 1)))))
+(if (is_even 20000) 20000 0)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newTestSession(env.Limits{})
+			result, err := session.Evaluate(tt.source)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Type != object.OBJ_TYPE_INTEGER || result.D.(object.Integer) != 20000 {
+				t.Fatalf("expected 20000, got %s", result.Encode())
+			}
+			if usage := session.Usage(); usage.PeakDepth > 10 {
+				t.Errorf("expected tail calls to keep the stack shallow, peak depth was %d", usage.PeakDepth)
+			}
+		})
+	}
+
+	t.Run("return_types_still_checked", func(t *testing.T) {
+		session := newTestSession(env.Limits{})
+		result, err := session.Evaluate(`
+(set inner (fn (n :I) :* "not an int"))
+(set outer (fn (n :I) :I (inner n)))
+(outer 1)`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Type != object.OBJ_TYPE_ERROR || !strings.Contains(result.D.(object.Error).Message, "return type mismatch") {
+			t.Fatalf("expected return type mismatch, got %s", result.Encode())
+		}
+	})
+
+	t.Run("non_tail_recursion_is_limited", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxRecursionDepth: 100})
+		result, err := session.Evaluate(`
+(set down (fn (n :I) :I (if (int/eq n 0) 0 (int/add 1 (down (int/sub n 1))))))
+(down 1000)`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Type != object.OBJ_TYPE_ERROR || !strings.Contains(result.D.(object.Error).Message, "maximum recursion depth") {
+			t.Fatalf("expected recursion depth error, got %s", result.Encode())
+		}
+	})
+}
+
+type constantGroup struct {
+	name  string
+	value object.Integer
+}
+
+func (g *constantGroup) Name() string {
+	return g.name
+}
+
+func (g *constantGroup) Functions() map[object.Identifier]env.EnvFunction {
+	return map[object.Identifier]env.EnvFunction{
+		"test/value": {
+			ReturnType: object.OBJ_TYPE_INTEGER,
+			Body: func(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+				return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: g.value}, nil
+			},
+		},
+	}
+}
+
+func TestFunctionGroups(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.String(), func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			session := NewSessionBuilder(logger).
+				WithEngine(engine).
+				WithFunctionGroup(&constantGroup{name: "first", value: 1}).
+				WithFunctionGroup(&constantGroup{name: "second", value: 2}).
+				Build("test.slpx")
+
+			expectValue := func(want object.Integer) {
+				t.Helper()
+				result, err := session.Evaluate(`(test/value)`)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if result.Type != object.OBJ_TYPE_INTEGER || result.D.(object.Integer) != want {
+					t.Fatalf("expected %d, got %s", want, result.Encode())
+				}
+			}
+
+			// the group added last wins
+			expectValue(2)
+
+			session.env.evalCtx.RemoveFunctionGroup("second")
+			expectValue(1)
+
+			session.env.evalCtx.AddFunctionGroup(&constantGroup{name: "first", value: 3})
+			expectValue(3)
+
+			session.env.evalCtx.RemoveFunctionGroup("first")
+			result, err := session.Evaluate(`(test/value)`)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Type != object.OBJ_TYPE_ERROR {
+				t.Fatalf("expected an error once every group is removed, got %s", result.Encode())
+			}
+		})
+	}
+}
+
+// sandboxGroup replaces putln, keeping the original as core/putln, and takes
+// exit away
+type sandboxGroup struct {
+	lines []string
+}
+
+func (g *sandboxGroup) Name() string {
+	return "sandbox"
+}
+
+func (g *sandboxGroup) Functions() map[object.Identifier]env.EnvFunction {
+	return map[object.Identifier]env.EnvFunction{
+		"putln": {
+			EvaluateArgs: true,
+			Parameters:   []env.EnvParameter{{Name: "args", Type: object.OBJ_TYPE_ANY}},
+			ReturnType:   object.OBJ_TYPE_NONE,
+			Variadic:     true,
+			Body: func(ctx env.EvaluationContext, args object.List) (object.Obj, error) {
+				for _, arg := range args {
+					g.lines = append(g.lines, arg.Encode())
+				}
+				return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}}, nil
+			},
+		},
+	}
+}
+
+func (g *sandboxGroup) Overrides() env.Overrides {
+	return env.Overrides{
+		Shadow: []object.Identifier{"putln"},
+		Alias:  map[object.Identifier]object.Identifier{"core/putln": "putln"},
+		Remove: []object.Identifier{"exit"},
+	}
+}
+
+func TestFunctionOverrides(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.String(), func(t *testing.T) {
+			var logs strings.Builder
+			logger := slog.New(slog.NewTextHandler(&logs, nil))
+			var stdout strings.Builder
+			sessionIO := env.DefaultIO()
+			sessionIO.SetStdout(&stdout)
+
+			sandbox := &sandboxGroup{}
+			session := NewSessionBuilder(logger).
+				WithIO(sessionIO).
+				WithEngine(engine).
+				WithFunctionGroup(sandbox).
+				Build("test.slpx")
+
+			if strings.Contains(logs.String(), "conflict") {
+				t.Fatalf("expected no conflicts, got:\n%s", logs.String())
+			}
+
+			if _, err := session.Evaluate(`(putln "captured") (core/putln "printed")`); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(sandbox.lines, []string{`"captured"`}) {
+				t.Errorf("expected the override to capture putln, got %v", sandbox.lines)
+			}
+			if !strings.Contains(stdout.String(), "printed") || strings.Contains(stdout.String(), "captured") {
+				t.Errorf("expected only the alias to reach stdout, got %q", stdout.String())
+			}
+
+			result, err := session.Evaluate(`(exit 0)`)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Type != object.OBJ_TYPE_ERROR {
+				t.Fatalf("expected exit to be undefined, got %s", result.Encode())
+			}
+		})
+	}
+}
+
+func TestFunctionConflicts(t *testing.T) {
+	conflicts := env.FunctionConflicts(
+		&constantGroup{name: "first", value: 1},
+		&constantGroup{name: "second", value: 2},
+	)
+	if len(conflicts) != 1 {
+		t.Fatalf("expected one conflict, got %v", conflicts)
+	}
+	if got := conflicts[0]; got.Name != "test/value" || got.Group != "second" || got.Existing != "first" {
+		t.Errorf("unexpected conflict: %+v", got)
+	}
+
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	NewSessionBuilder(logger).
+		WithFunctionGroup(&constantGroup{name: "first", value: 1}).
+		WithFunctionGroup(&constantGroup{name: "second", value: 2}).
+		Build("test.slpx")
+	if !strings.Contains(logs.String(), "function group conflict") || !strings.Contains(logs.String(), "name=test/value") {
+		t.Errorf("expected the conflict to be logged, got:\n%s", logs.String())
+	}
+}
+
+func TestExit(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "quit.slpx"), []byte(`(set code 7) (exit code) (set after 1)`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		code   int
+	}{
+		{"literal", `(exit 4)`, 4},
+		{"from_a_function", `(set quit (fn (n :I) :I (do (exit n) 0))) (quit 5)`, 5},
+		{"through_try", `(try (exit 6) 0)`, 6},
+		{"from_a_used_file", `(use "quit.slpx")`, 7},
+		{"non_integer_identifier", `(set code "x") (exit code)`, 1},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+				session := NewSessionBuilder(logger).WithEngine(engine).Build(filepath.Join(dir, "main.slpx"))
+
+				_, err := session.Evaluate(tt.source + ` (set after 1)`)
+				code, exited := env.ExitCode(err)
+				if !exited {
+					t.Fatalf("expected an exit, got %v", err)
+				}
+				if code != tt.code {
+					t.Errorf("expected exit code %d, got %d", tt.code, code)
+				}
+				if _, err := session.GetMEM().Get("after", true); err == nil {
+					t.Error("evaluation continued after exit")
+				}
+
+				// the session is still usable afterwards
+				result, err := session.Evaluate(`(int/add 1 2)`)
+				if err != nil || result.Encode() != "3" {
+					t.Errorf("expected the session to keep working, got %s %v", result.Encode(), err)
+				}
+			})
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	definitions := `
+		(set echo (fn (s :S) :S s))
+		(set same (fn (x :*) :* x))
+		(set adder (fn (n :I) :F (fn (m :I) :I (int/add n m))))
+		(set add5 (adder 5))
+		(set count 1)`
+
+	for _, engine := range engines {
+		t.Run(engine.String(), func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			session := NewSessionBuilder(logger).WithEngine(engine).Build("/tmp/test.slpx")
+			if result, err := session.Evaluate(definitions); err != nil || result.Type == object.OBJ_TYPE_ERROR {
+				t.Fatalf("definitions failed: %s %v", result.Encode(), err)
+			}
+
+			call := func(name object.Identifier, args ...object.Obj) object.Obj {
+				t.Helper()
+				function, err := session.Lookup(name)
+				if err != nil {
+					t.Fatalf("lookup of %s failed: %v", name, err)
+				}
+				result, err := session.Call(function, object.List(args))
+				if err != nil {
+					t.Fatalf("call of %s failed: %v", name, err)
+				}
+				return result
+			}
+			str := func(s string) object.Obj {
+				return object.Obj{Type: object.OBJ_TYPE_STRING, D: s}
+			}
+
+			// strings reach the function untouched, however they would have to be
+			// escaped in source
+			for _, input := range []string{`plain`, `say "hi"`, `back\slash`, "new\nline", `\"`, `(exit 1)`} {
+				result := call("echo", str(input))
+				if result.Type != object.OBJ_TYPE_STRING || result.D.(string) != input {
+					t.Errorf("expected %q back, got %s", input, result.Encode())
+				}
+			}
+
+			// arguments are values, never code
+			list := object.Obj{Type: object.OBJ_TYPE_LIST, D: object.List{
+				{Type: object.OBJ_TYPE_IDENTIFIER, D: object.Identifier("exit")},
+				{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)},
+			}}
+			if result := call("same", list); result.Type != object.OBJ_TYPE_LIST {
+				t.Errorf("expected the list back, got %s", result.Encode())
+			}
+
+			if result := call("add5", object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(2)}); result.Encode() != "7" {
+				t.Errorf("expected the closure to give 7, got %s", result.Encode())
+			}
+
+			if result := call("str/concat", str("a"), str("b")); result.Type != object.OBJ_TYPE_STRING || result.D.(string) != "ab" {
+				t.Errorf("expected the env function to give ab, got %s", result.Encode())
+			}
+
+			if result := call("echo", object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}); result.Type != object.OBJ_TYPE_ERROR {
+				t.Errorf("expected a type mismatch error, got %s", result.Encode())
+			}
+			if result := call("echo"); result.Type != object.OBJ_TYPE_ERROR {
+				t.Errorf("expected an arity error, got %s", result.Encode())
+			}
+
+			if _, err := session.Lookup("missing"); !errors.Is(err, env.ErrUndefinedIdentifier) {
+				t.Errorf("expected ErrUndefinedIdentifier, got %v", err)
+			}
+			if _, err := session.Lookup("count"); err == nil {
+				t.Error("expected an error looking up a value that is not a function")
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			function, _ := session.Lookup("echo")
+			if _, err := session.CallContext(ctx, function, object.List{str("x")}); !errors.Is(err, env.ErrCancelled) {
+				t.Errorf("expected ErrCancelled, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGoFunctions(t *testing.T) {
+	group, err := env.NewGoFunctions("go", map[object.Identifier]any{
+		"go/scale": func(n int64, by float64) float64 { return float64(n) * by },
+		"go/repeat": func(s string, times uint8) (string, error) {
+			if times == 0 {
+				return "", errors.New("nothing to repeat")
+			}
+			return strings.Repeat(s, int(times)), nil
+		},
+		"go/even": func(n int) bool { return n%2 == 0 },
+		"go/sum": func(ns ...int32) int64 {
+			var sum int64
+			for _, n := range ns {
+				sum += int64(n)
+			}
+			return sum
+		},
+		"go/words": func(s string) []string { return strings.Fields(s) },
+		"go/join":  func(words []string, sep string) string { return strings.Join(words, sep) },
+		"go/type":  func(obj object.Obj) string { return string(obj.Type) },
+		"go/done":  func(ctx context.Context) bool { return ctx.Err() != nil },
+		"go/noop":  func() {},
+		"go/reverse": func(data []byte) []byte {
+			slices.Reverse(data)
+			return data
+		},
+		"go/double": func(n *big.Int) *big.Int { return n.Lsh(n, 1) },
+		"go/point": func(p struct {
+			X int `slpx:"x,required"`
+			Y int `slpx:"y"`
+		}) map[string]int {
+			return map[string]int{"sum": p.X + p.Y}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"mixed_types", `(go/scale 3 1.5)`, "4.5"},
+		{"value_and_error", `(go/repeat "ab" 2)`, `"abab"`},
+		{"bool", `(go/even 4)`, "1"},
+		{"variadic", `(go/sum 1 2 3)`, "6"},
+		{"slice_result", `(go/words "a b  c")`, `("a" "b" "c")`},
+		{"slice_argument", `(go/join '("a" "b") "-")`, `"a-b"`},
+		{"obj_passes_through", `(go/type 'x)`, `"identifier"`},
+		{"context_is_not_an_argument", `(go/done)`, "0"},
+		{"no_results", `(go/noop)`, "_"},
+		{"struct_argument", `(go/point '((x 1) (y 2)))`, `{"sum" 3}`},
+		{"struct_from_map", `(go/point {x 1 y 2})`, `{"sum" 3}`},
+		{"byte_slices", `(go/reverse #x010203)`, "#x030201"},
+		{"big_ints", `(go/double 4611686018427387904)`, "9223372036854775808"},
+		{"big_ints_shrink", `(go/double -4611686018427387904)`, "-9223372036854775808"},
+		{"errors_can_be_caught", `(try (go/repeat "ab" 0) "caught")`, `"caught"`},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"returned_error", `(go/repeat "ab" 0)`, "nothing to repeat"},
+		{"overflow", `(go/repeat "ab" 300)`, "does not fit in uint8"},
+		{"element_type", `(go/join '("a" 1) "-")`, "argument 1[1]: expected string, got integer"},
+		{"parameter_type", `(go/scale 1.5 2.0)`, "type mismatch"},
+		{"arity", `(go/noop 1)`, "wrong number of arguments"},
+		{"missing_field", `(go/point '((y 2)))`, "argument 1.x: required but missing"},
+	}
+
+	for _, engine := range engines {
+		newSession := func() *Session {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			return NewSessionBuilder(logger).WithEngine(engine).WithFunctionGroup(group).Build("/tmp/test.slpx")
+		}
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if message := result.D.(object.Error).Message; !strings.Contains(message, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, message)
+				}
+			})
+		}
+	}
+
+	unsupported := map[string]any{
+		"not_a_func":     42,
+		"chan_parameter": func(c chan int) {},
+		"too_many":       func() (int, int, error) { return 0, 0, nil },
+		"error_not_last": func() (error, int) { return nil, 0 },
+	}
+	for name, fn := range unsupported {
+		if _, err := env.GoFunction(fn); err == nil {
+			t.Errorf("%s: expected GoFunction to refuse it", name)
+		}
+	}
+}
+
+func TestMaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"empty_literal", `{}`, "{}"},
+		{"literal_values_evaluate", `{"sum" (int/add 1 2) k 'x}`, `{"sum" 3 k x}`},
+		{"keys_keep_their_type", `(map/len {1 "i" 1.5 "r" "1" "s" one "id"})`, "4"},
+		{"fresh_map_per_evaluation", `
+(set make (fn () :M {"n" 0}))
+(set a (make))
+(map/set a "n" 1)
+(map/get (make) "n")`, "0"},
+		{"set_in_place", `(set m (map/new)) (map/set m "a" 1) (map/set m "b" 2) (map/set m "a" 3) m`, `{"a" 3 "b" 2}`},
+		{"delete", `(set m {"a" 1 "b" 2 "c" 3}) (map/delete m "b") (map/delete m "missing") m`, `{"a" 1 "c" 3}`},
+		{"has", `(map/has? {"a" 1} "a")`, "1"},
+		{"has_not", `(map/has? {"a" 1} "b")`, "0"},
+		{"keys", `(map/keys {b 2 a 1})`, "(b a)"},
+		{"values", `(map/values {b 2 a 1})`, "(2 1)"},
+		{"merge_later_wins", `(set a {"x" 1 "y" 2}) (map/merge a {"y" 20 "z" 30}) `, `{"x" 1 "y" 20 "z" 30}`},
+		{"merge_is_a_new_map", `(set a {"x" 1}) (map/merge a {"x" 2}) a`, `{"x" 1}`},
+		{"from_pairs", `(map/from '(("a" 1) ("b" 2)))`, `{"a" 1 "b" 2}`},
+		{"iter", `
+(set seen (uq (qu ())))
+(map/iter {"a" 1 "b" 2 "c" 3} (fn (k :S v :I) :I (do (set seen (list/push seen k)) (if (int/eq v 2) 0 1))))
+seen`, `("a" "b")`},
+		{"iter_values_not_reevaluated", `
+(set out "")
+(map/iter {"k" '(int/add 1 2)} (fn (k :S v :*) :I (do (set out (reflect/type? v)) 1)))
+out`, `"list"`},
+		{"map_parameter_type", `(set count (fn (m :M) :I (map/len m))) (count {"a" 1})`, "1"},
+		{"reflect_type", `(reflect/type? {"a" 1})`, `"map"`},
+		{"reflect_map", `(reflect/map? {})`, "1"},
+		{"reflect_not_map", `(reflect/map? '(1))`, "0"},
+		{"match_map_pattern", `
+(match {"kind" "point" "x" 1}
+    '({"kind" "line"} (fn (m :M) :S "line"))
+    '({"kind" "point" "x" 1} (fn (m :M) :S "point")))`, `"point"`},
+		{"match_nested_map_pattern", `
+(match {"a" {"b" 1 "c" 2}}
+    '({"a" {"b" 2}} (fn (m :M) :S "two"))
+    '({"a" {"b" 1}} (fn (m :M) :S "one")))`, `"one"`},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"missing_key", `(map/get {"a" 1} "b")`, `map/get: key not found: "b"`},
+		{"invalid_key", `(map/set (map/new) '(1) 1)`, "map/set: key must be"},
+		{"not_a_pair", `(map/from '(("a" 1) ("b")))`, "map/from: expected (key value) pairs"},
+		{"iter_callback_type", `(map/iter {"a" 1} (fn (k :S v :I) :S "x"))`, "callback must return integer"},
+		{"parameter_type", `(map/len '(1 2))`, "type mismatch"},
+		{"no_pattern_matched", `(match {"a" 1} '({"a" 2} (fn (m :M) :I 0)))`, "no pattern matched"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newEngineSession(engine, env.Limits{}).Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newEngineSession(engine, env.Limits{}).Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if message := result.D.(object.Error).Message; !strings.Contains(message, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, message)
+				}
+			})
+		}
+	}
+
+	t.Run("size_limit", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxListSize: 2})
+		result, err := session.Evaluate(`{"a" 1 "b" 2 "c" 3}`)
+		expectLimitError(t, result, err, "map size")
+	})
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"literal", `#xDEADbeef`, "#xdeadbeef"},
+		{"empty_literal", `#x`, "#x"},
+		{"parameter_type", `(set first (fn (b :B) :I (bytes/get b 0))) (first #xff00)`, "255"},
+		{"new", `(bytes/new 3 7)`, "#x070707"},
+		{"len", `(bytes/len #x000102)`, "3"},
+		{"set_is_a_copy", `(set b #x0000) (bytes/set b 1 255) b`, "#x0000"},
+		{"set", `(bytes/set #x0000 1 255)`, "#x00ff"},
+		{"slice_clamps", `(bytes/slice #x00010203 1 100)`, "#x010203"},
+		{"concat", `(bytes/concat #x01 #x #x0203)`, "#x010203"},
+		{"from_utf8", `(bytes/from_str "hé" "utf8")`, "#x68c3a9"},
+		{"to_utf8", `(bytes/to_str #x68c3a9 "utf8")`, `"hé"`},
+		{"hex_round_trip", `(bytes/from_str (bytes/to_str #xcafe "hex") "hex")`, "#xcafe"},
+		{"base64_round_trip", `(bytes/to_str (bytes/from_str "aGVsbG8=" "base64") "base64")`, `"aGVsbG8="`},
+		{"to_list", `(bytes/to_list #x00ff)`, "(0 255)"},
+		{"from_list", `(bytes/from_list '(0 128 255))`, "#x0080ff"},
+		{"read_int_big", `(bytes/read_int #x0102 0 2 "big")`, "258"},
+		{"read_int_little", `(bytes/read_int #x0102 0 2 "little")`, "513"},
+		{"read_int_signed", `(bytes/read_int #x00ffff 1 2 "big")`, "-1"},
+		{"read_uint", `(bytes/read_uint #xffff 0 2 "big")`, "65535"},
+		{"read_int_64", `(bytes/read_int #xffffffffffffffff 0 8 "big")`, "-1"},
+		{"write_int", `(bytes/write_int (bytes/new 4 0) 0 4 "little" 258)`, "#x02010000"},
+		{"write_int_negative", `(bytes/write_int (bytes/new 2 0) 0 2 "big" -2)`, "#xfffe"},
+		{"write_int_unsigned", `(bytes/write_int (bytes/new 1 0) 0 1 "big" 200)`, "#xc8"},
+		{"files", `
+(fs/write_bytes "/data.bin" #x00ff)
+(fs/append_bytes "/data.bin" #x0a00)
+(fs/read_bytes "/data.bin")`, "#x00ff0a00"},
+		{"reflect", `(reflect/type? #x00)`, `"bytes"`},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"get_out_of_bounds", `(bytes/get #x00 1)`, "bytes/get: index out of bounds: 1"},
+		{"set_value_range", `(bytes/set #x00 0 256)`, "bytes/set: value must be 0 to 255"},
+		{"invalid_utf8", `(bytes/to_str #xff "utf8")`, "not valid utf8"},
+		{"unknown_encoding", `(bytes/from_str "x" "latin1")`, "unknown encoding"},
+		{"from_list_element", `(bytes/from_list '(1 "2"))`, "element 1 is not an integer"},
+		{"read_past_end", `(bytes/read_int #x0001 1 2 "big")`, "out of bounds"},
+		{"bad_size", `(bytes/read_int #x0001 0 3 "big")`, "size must be 1, 2, 4, or 8"},
+		{"bad_endian", `(bytes/read_int #x0001 0 2 "middle")`, "endian must be"},
+		{"read_uint_overflow", `(bytes/read_uint #xffffffffffffffff 0 8 "big")`, "does not fit in an integer"},
+		{"write_int_overflow", `(bytes/write_int #x00 0 1 "big" 256)`, "256 does not fit in 1 bytes"},
+		{"type_mismatch", `(bytes/len "abc")`, "type mismatch"},
+	}
+
+	for _, engine := range engines {
+		newSession := func() *Session {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			return NewSessionBuilder(logger).WithEngine(engine).WithFS(env.NewMemoryFS()).Build("/main.slpx")
+		}
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if message := result.D.(object.Error).Message; !strings.Contains(message, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, message)
+				}
+			})
+		}
+	}
+
+	t.Run("stdio", func(t *testing.T) {
+		var stdout bytes.Buffer
+		stdio := env.DefaultIO()
+		stdio.SetStdin(bytes.NewReader([]byte{0, 1, 2, 0xff}))
+		stdio.SetStdout(&stdout)
+
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		session := NewSessionBuilder(logger).WithIO(stdio).Build("/tmp/test.slpx")
+		result, err := session.Evaluate(`(set data (io/in/bytes)) (io/out/bytes (bytes/slice data 1 4)) data`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Encode() != "#x000102ff" {
+			t.Errorf("expected #x000102ff from stdin, got %s", result.Encode())
+		}
+		if !bytes.Equal(stdout.Bytes(), []byte{1, 2, 0xff}) {
+			t.Errorf("expected the raw bytes on stdout, got %q", stdout.Bytes())
+		}
+	})
+
+	t.Run("size_limit", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxStringSize: 4})
+		result, err := session.Evaluate(`(bytes/new 5 0)`)
+		expectLimitError(t, result, err, "bytes size")
+	})
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"literal", `123456789012345678901234567890`, "123456789012345678901234567890"},
+		{"add_promotes", `(int/add 9223372036854775807 1)`, "9223372036854775808"},
+		{"sub_promotes", `(int/sub -9223372036854775808 1)`, "-9223372036854775809"},
+		{"mul_promotes", `(int/mul 4294967296 4294967296)`, "18446744073709551616"},
+		{"pow_promotes", `(int/pow 2 100)`, "1267650600228229401496703205376"},
+		{"div_promotes", `(int/div -9223372036854775808 -1)`, "9223372036854775808"},
+		{"abs_promotes", `(int/abs -9223372036854775808)`, "9223372036854775808"},
+		{"sum_promotes", `(int/sum 9223372036854775807 9223372036854775807 -9223372036854775807)`, "9223372036854775807"},
+		{"shrinks_back", `(set big (int/add 9223372036854775807 1)) (reflect/int? (int/sub big 1))`, "1"},
+		{"stays_big", `(set big (int/add 9223372036854775807 1)) (reflect/bigint? big)`, "1"},
+		{"div", `(int/div 123456789012345678901234567890 -10)`, "-12345678901234567890123456789"},
+		{"mod", `(int/mod -123456789012345678901234567891 10)`, "-1"},
+		{"compare", `(int/gt 123456789012345678901234567890 9223372036854775807)`, "1"},
+		{"equal", `(int/eq 123456789012345678901234567890 123456789012345678901234567890)`, "1"},
+		{"to_real", `(real/gt (int/real 123456789012345678901234567890) 1.0)`, "1"},
+		{"from_real", `(real/int (real/mul 10000000000.0 10000000000.0))`, "100000000000000000000"},
+		{"rand", `(int/rand 123456789012345678901234567890 123456789012345678901234567890)`, "123456789012345678901234567890"},
+		{"rand_wide", `(int/lte (int/rand -9223372036854775808 9223372036854775807) 9223372036854775807)`, "1"},
+		{"parameter_type", `(set twice (fn (n :Z) :* (int/mul n 2))) (twice 9223372036854775808)`, "18446744073709551616"},
+		{"match", `(match 99999999999999999999 '(99999999999999999999 (fn (n :Z) :S "big")))`, `"big"`},
+		{"map_key", `(map/get {99999999999999999999 "big"} 99999999999999999999)`, `"big"`},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"pow_too_large", `(int/pow 3 100000000)`, "int/pow: result too large"},
+		{"pow_negative", `(int/pow 99999999999999999999 -1)`, "negative exponent"},
+		{"div_by_zero", `(int/div 99999999999999999999 0)`, "int/div: division by zero"},
+		{"not_an_integer", `(int/add 1 "2")`, "int/add: all arguments must be integers, got string at position 1"},
+		{"needs_int64", `(list/get '(1 2) 99999999999999999999)`, "expected integer, got bigint"},
+		{"to_real_overflow", `(int/real (int/pow 2 2000))`, "int/real: integer too large for a real"},
+		{"mod_by_zero", `(int/mod 99999999999999999999 0)`, "int/mod: modulo by zero"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newEngineSession(engine, env.Limits{}).Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newEngineSession(engine, env.Limits{}).Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if message := result.D.(object.Error).Message; !strings.Contains(message, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, message)
+				}
+			})
+		}
+	}
+
+	t.Run("size_limit", func(t *testing.T) {
+		session := newTestSession(env.Limits{MaxStringSize: 8})
+		result, err := session.Evaluate(`(int/pow 2 100)`)
+		expectLimitError(t, result, err, "integer size")
+	})
+}
+
+func TestStructuredErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"try_binds_the_error", `(try @not_found(no such user) (error/code $error))`, `"not_found"`},
+		{"message", `(try @not_found(no such user) (error/message $error))`, `"no such user"`},
+		{"literal_data", `(try @not_found(no such user {"id" 42}) (error/data $error))`, `{"id" 42}`},
+		{"no_code", `(try @(plain) (error/code $error))`, `""`},
+		{"no_data", `(try @(plain) (error/data $error))`, "_"},
+		{"no_cause", `(try @(plain) (error/cause $error))`, "_"},
+		{"literal_cause", `(try @config(could not load @io(disk gone)) (error/code (error/cause $error)))`, `"io"`},
+		{"builtin_errors", `(try (int/div 1 0) (error/message $error))`, `"int/div: division by zero"`},
+		{"without_try", `(error/code @timeout(too slow))`, `"timeout"`},
+		{"new", `(try (error/new "bad_input" "wanted a number" (int/add 1 2)) (error/data $error))`, "3"},
+		{"wrap", `
+(try (try @io(disk gone) (error/wrap $error "config" "could not load" _))
+  (str/concat (error/code $error) " <- " (error/code (error/cause $error))))`, `"config <- io"`},
+		{"branch_on_code", `
+(set lookup (fn (id :I) :* (if (int/eq id 1) "ada" (error/new "not_found" "no such user" id))))
+(match (try (lookup 2) (error/code $error))
+  '("not_found" (fn (code :S) :S "missing"))
+  '("*" (fn (code :S) :S "other")))`, `"missing"`},
+		{"use_keeps_the_cause", `
+(fs/write_file "/lib.slpx" "(set x 1) @io(disk gone {\"retry\" 1})")
+(try (use "/lib.slpx") {code (error/code (error/cause $error)) data (error/data (error/cause $error))})`, `{code "io" data {"retry" 1}}`},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"rethrow", `(try @oops(first) $error)`, "first"},
+		{"not_an_error", `(error/code 5)`, "error/code: expected an error, got integer"},
+		{"wrap_code_type", `(error/wrap @(x) 1 "m" _)`, "error/wrap: code must be a string, got integer"},
+		{"wrap_not_an_error", `(error/wrap "x" "c" "m" _)`, "error/wrap: expected an error, got string"},
+	}
+
+	for _, engine := range engines {
+		newSession := func() *Session {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			return NewSessionBuilder(logger).WithEngine(engine).WithFS(env.NewMemoryFS()).Build("/main.slpx")
+		}
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if message := result.D.(object.Error).Message; !strings.Contains(message, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, message)
+				}
+			})
+		}
+	}
+}
+
+func TestThrowAndFinally(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"throw", `(try (throw "not_found" "no such user") (error/message $error))`, `"no such user"`},
+		{"throw_data", `(try (throw "not_found" "no such user" {"id" 42}) (error/data $error))`, `{"id" 42}`},
+		{"catch_by_code", `
+(try (throw "io" "disk gone")
+  (catch "not_found" "missing")
+  (catch "io" "timeout" (error/message $error)))`, `"disk gone"`},
+		{"first_match_wins", `
+(try (throw "io" "disk gone")
+  (catch "io" "first")
+  (catch "second"))`, `"first"`},
+		{"catch_all", `(try (throw "io" "disk gone") (catch "not_found" 1) (catch (error/code $error)))`, `"io"`},
+		{"catch_arith", `(try (int/div 1 0) (catch "type" 1) (catch "arith" (error/message $error)))`, `"int/div: division by zero"`},
+		{"catch_real_arith", `(try (real/sqrt -1.0) (catch "arith" "nan"))`, `"nan"`},
+		{"catch_number_type", `(try (int/sum 1 2.5) (catch "type" (error/code $error)))`, `"type"`},
+		{"finally_on_success", `
+(set cleaned 0)
+(set value (try 42 (finally (set cleaned 1))))
+(int/add value cleaned)`, "43"},
+		{"finally_on_failure", `
+(set cleaned 0)
+(try (try (throw "io" "disk gone") (finally (set cleaned 1))) (catch 0))
+cleaned`, "1"},
+		{"finally_after_handler", `
+(set order "")
+(try (throw "io" "disk gone")
+  (catch (set order (str/concat order "catch ")))
+  (finally (set order (str/concat order "finally"))))
+order`, `"catch finally"`},
+		{"finally_value_dropped", `(try 1 (catch 2) (finally 3))`, "1"},
+		{"finally_in_function", `
+(set cleaned 0)
+(set load (fn (path :S) :S (try (fs/read_file path) (finally (set cleaned 1)))))
+(try (load "/missing.txt") (catch cleaned))`, "1"},
+		{"error_cleaned_up", `
+(try (throw "io" "disk gone") (catch "io" 1))
+(try $error (catch "undefined"))`, `"undefined"`},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"uncaught", `(try (throw "io" "disk gone") (catch "not_found" 1))`, "disk gone"},
+		{"finally_error_wins", `(try (throw "io" "first") (catch "io" 1) (finally (throw "io" "second")))`, "second"},
+		{"handler_rethrows", `(try (throw "io" "first") (catch "io" $error) (finally 1))`, "first"},
+		{"throw_message_type", `(throw "io" 5)`, "throw: message must be a string, got integer"},
+		{"throw_too_many", `(throw "io" "m" _ 1)`, "throw: takes a code, a message, and optional data, got 4 arguments"},
+		{"not_a_clause", `(try 1 (catch 2) 3)`, "try: expected a (catch ...) or (finally ...) clause, got integer"},
+		{"finally_not_last", `(try 1 (finally 2) (catch 3))`, "try: the finally clause must come last"},
+		{"finally_arity", `(try 1 (finally 2 3))`, "try: finally takes 1 expression, got 2"},
+		{"catch_without_handler", `(try 1 (catch))`, "try: catch requires a handler"},
+		{"catch_code_type", `(try 1 (catch 404 2))`, "try: catch codes must be strings, got integer"},
+	}
+
+	for _, engine := range engines {
+		newSession := func() *Session {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			return NewSessionBuilder(logger).WithEngine(engine).WithFS(env.NewMemoryFS()).Build("/main.slpx")
+		}
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if message := result.D.(object.Error).Message; !strings.Contains(message, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, message)
+				}
+			})
+		}
+	}
+}
+
+func TestQuasiquote(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"no_unquotes", "`(a (b c) 1)", "(a (b c) 1)"},
+		{"unquote", "(set n 2) `(1 ,n ,(int/add n 1))", "(1 2 3)"},
+		{"splice", "(set rest '(3 4)) `(1 ,@rest 5)", "(1 3 4 5)"},
+		{"splice_empty", "`(1 ,@'() 2)", "(1 2)"},
+		{"map_values", "(set n 2) `{\"n\" ,n \"list\" (a ,n)}", `{"n" 2 "list" (a 2)}`},
+		{"quoted_part", "(set n 2) `(a '(b ,n))", "(a '(b 2))"},
+		{"nested", "(set n 2) `(a `(b ,(c ,n)))", "(a `(b ,(c 2)))"},
+		{"error_literal_kept", "(list/len `(@oops(x) 1))", "2"},
+		{"function_parameters", "(set f (fn (x :I) :L `(x ,x))) (f 7)", "(x 7)"},
+		{"new_list_each_time", `
+(set make (fn (x :I) :L ` + "`(,x)" + `))
+(set a (make 1))
+(list/push a 2)
+(make 1)`, "(1)"},
+		{"macro_template", `
+$(point ?x ?y) ` + "`{\"x\" ,?x \"y\" ,?y}" + `
+(set n 3)
+($point n (int/mul n 2))`, `{"x" 3 "y" 6}`},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"unquote_outside", ",1", "quasiquote: , is only allowed inside a quasiquote"},
+		{"splice_outside", ",@'(1)", "quasiquote: ,@ is only allowed inside a list in a quasiquote"},
+		{"splice_not_in_list", "`,@'(1)", "quasiquote: ,@ is only allowed inside a list in a quasiquote"},
+		{"splice_not_a_list", "`(1 ,@2)", "quasiquote: ,@ expects a list, got integer"},
+		{"unquote_fails", "`(1 ,(int/add \"a\" 1))", "int/add"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newEngineSession(engine, env.Limits{}).Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newEngineSession(engine, env.Limits{}).Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if message := result.D.(object.Error).Message; !strings.Contains(message, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, message)
+				}
+			})
+		}
+	}
+
+	result, err := newEngineSession(env.EngineTree, env.Limits{MaxListSize: 3}).Evaluate("(set xs '(1 2 3)) `(0 ,@xs)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Type != object.OBJ_TYPE_ERROR || !strings.Contains(result.D.(object.Error).Message, "list size") {
+		t.Errorf("expected a list size limit error, got %s", result.Encode())
+	}
+}
+
+func TestModules(t *testing.T) {
+	files := map[string]string{
+		"/lib/strs.slpx": `
+(fs/append_file "/runs" "x")
+(set helper (fn (s :S) :S (str/concat "<" s ">")))
+(set wrap (fn (s :S) :S (helper s)))
+(export wrap)`,
+		"/lib/open.slpx": `
+(set a 1)
+(set b 2)`,
+		"/lib/shared.slpx":  `(set shared_value 7)`,
+		"/app/util.slpx":    `(set local_value 3) (export local_value)`,
+		"/cycle/a.slpx":     `(use "b.slpx")`,
+		"/cycle/b.slpx":     `(use "a.slpx")`,
+		"/cycle/x.slpx":     `(import "y.slpx")`,
+		"/cycle/y.slpx":     `(import "x.slpx")`,
+		"/bad/missing.slpx": `(set a 1) (export a b)`,
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"prefix_from_file_name", `(import "/lib/strs.slpx") (strs/wrap "x")`, `"<x>"`},
+		{"search_path", `(import "strs.slpx") (strs/wrap "x")`, `"<x>"`},
+		{"extension_optional", `(import "strs") (strs/wrap "x")`, `"<x>"`},
+		{"alias", `(import "strs" "s") (s/wrap "y")`, `"<y>"`},
+		{"private_bindings_stay_hidden", `(import "strs") (try helper "hidden")`, `"hidden"`},
+		{"nothing_leaks_into_the_module", `
+(set secret 1)
+(fs/write_file "/peek.slpx" "(set seen (try secret 0))")
+(import "/peek.slpx")
+peek/seen`, "0"},
+		{"no_export_exports_everything", `(import "open") (int/add open/a open/b)`, "3"},
+		{"run_once", `
+(import "strs")
+(import "strs" "again")
+(import "strs")
+(fs/read_file "/runs")`, `"x"`},
+		{"next_to_the_current_file", `(import "util") util/local_value`, "3"},
+		{"use_searches_the_path", `(use "shared") shared_value`, "7"},
+		{"use_runs_once", `
+(fs/write_file "/count.slpx" "(fs/append_file \"/uses\" \"x\")")
+(use "/count.slpx")
+(use "/count.slpx")
+(fs/read_file "/uses")`, `"x"`},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"circular_use", `(use "/cycle/a.slpx")`, "use: circular import: /cycle/a.slpx -> /cycle/b.slpx -> /cycle/a.slpx"},
+		{"circular_import", `(import "/cycle/x.slpx")`, "import: circular import: /cycle/x.slpx -> /cycle/y.slpx -> /cycle/x.slpx"},
+		{"export_outside_a_module", `(set a 1) (export a)`, "export: only allowed at the top level of a module run by import"},
+		{"export_never_set", `(import "/bad/missing.slpx")`, "import: /bad/missing.slpx exports b but never sets it"},
+		{"invalid_prefix", `(import "strs" "a/b")`, `import: invalid prefix "a/b"`},
+		{"not_found", `(import "nowhere")`, "import: failed to read file /app/nowhere"},
+		{"too_many_arguments", `(import "strs" "s" "t")`, "import: takes a path and an optional prefix, got 3 arguments"},
+	}
+
+	for _, engine := range engines {
+		newSession := func(t *testing.T) *Session {
+			memFS := env.NewMemoryFS()
+			for path, content := range files {
+				if err := memFS.MkDirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := memFS.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			return NewSessionBuilder(logger).WithEngine(engine).WithFS(memFS).WithModulePath("/lib").Build("/app/main.slpx")
+		}
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession(t).Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession(t).Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if summary := result.D.(object.Error).Summary(); !strings.Contains(summary, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, summary)
+				}
+			})
+		}
+	}
+}
+
+func TestMacroLibraries(t *testing.T) {
+	files := map[string]string{
+		"/lib/control.slpx": `
+$(unless ?cond ?body...) (if ?cond _ (do ?body...))
+$(swap ?a ?b) (do (set tmp# ?a) (set ?a ?b) (set ?b tmp#))
+$(helper) 1
+($export unless swap)
+(fs/append_file "/runs" "x")`,
+		"/lib/more.slpx":    `($import "control") $(twice ?x) (int/mul ?x 2)`,
+		"/app/local.slpx":   `$(local) "local"`,
+		"/app/user.slpx":    `($import "local") (set from_use ($local))`,
+		"/cycle/a.slpx":     `($import "b.slpx")`,
+		"/cycle/b.slpx":     `($import "a.slpx")`,
+		"/bad/missing.slpx": `($export nope)`,
+	}
+
+	newSession := func(t *testing.T) *Session {
+		memFS := env.NewMemoryFS()
+		for path, content := range files {
+			if err := memFS.MkDirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := memFS.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		return NewSessionBuilder(logger).WithFS(memFS).WithModulePath("/lib").Build("/app/main.slpx")
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"rest_parameters", `
+($import "control")
+(set log "")
+($unless 0 (set log (str/concat log "a")) (set log (str/concat log "b")))
+log`, `"ab"`},
+		{"gensyms_do_not_capture", `
+($import "control")
+(set tmp 1)
+(set x 2)
+($swap tmp x)
+(int/add (int/mul tmp 10) x)`, "21"},
+		{"defined_macros_are_exported", `($import "more") ($twice 21)`, "42"},
+		{"not_run", `($import "control") (fs/exists? "/runs")`, "0"},
+		{"next_to_the_current_file", `($import "local") ($local)`, `"local"`},
+		{"files_run_by_use", `(use "user") from_use`, `"local"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := newSession(t).Evaluate(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Encode() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+			}
+		})
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"circular", `($import "/cycle/a.slpx")`, "$import: circular import: /cycle/a.slpx -> /cycle/b.slpx -> /cycle/a.slpx"},
+		{"not_found", `($import "nowhere")`, "$import: failed to read file /app/nowhere"},
+		{"export_never_defined", `($import "/bad/missing.slpx")`, "$import: macro $nope is exported but never defined"},
+		{"only_exports", `($import "control") ($helper)`, "undefined macro $helper"},
+		{"not_imported_transitively", `($import "more") ($swap a b)`, "undefined macro $swap"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSession(t).Evaluate(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected a parse error mentioning %q, got %v", tt.message, err)
+			}
+		})
+	}
+
+	t.Run("session_keeps_macros", func(t *testing.T) {
+		session := newSession(t)
+		for _, source := range []string{`$(answer) 42`, `($import "more")`} {
+			if _, err := session.Evaluate(source); err != nil {
+				t.Fatal(err)
+			}
+		}
+		result, err := session.Evaluate(`(int/add ($answer) ($twice 1))`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Encode() != "44" {
+			t.Errorf("expected 44, got %s", result.Encode())
+		}
+	})
+}
+
+func TestMacroexpand(t *testing.T) {
+	memFS := env.NewMemoryFS()
+	if err := memFS.WriteFile("/control.slpx", []byte(`$(unless ?cond ?body...) (if ?cond _ (do ?body...))`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newSession := func() *Session {
+		return NewSessionBuilder(logger).WithFS(memFS).Build("/main.slpx")
+	}
+	prelude := `
+$(inner ?x) (if ?x ?x 0)
+$(outer ?x) ($inner ?x)
+$(apply ?m ?x) (?m ?x)
+`
+
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"one_step", `(macroexpand1 "($apply $inner 25)")`, "($inner 25)"},
+		{"fully", `(macroexpand "($apply $inner 25)")`, "(if 25 25 0)"},
+		{"expanded_when_defined", `(macroexpand1 "($outer 25)")`, "(if 25 25 0)"},
+		{"nested_calls", `(macroexpand "(putln ($outer 1))")`, "(putln (if 1 1 0))"},
+		{"not_a_call", `(macroexpand1 "(putln 1)")`, "(putln 1)"},
+		{"imported_macros", `($import "control") (macroexpand "($unless x 1)")`, "(if x _ (do 1))"},
+		{"trace_order", `(map/get (list/get (macrotrace "($apply $inner 25)") 1) "macro")`, `"inner"`},
+		{"trace_depth", `(map/get (list/get (macrotrace "($apply $inner 25)") 1) "depth")`, "1"},
+		{"trace_result", `(map/get (list/get (macrotrace "($apply $inner 25)") 0) "result")`, "($inner 25)"},
+		{"trace_defined", `(map/get (list/get (macrotrace "($apply $inner 25)") 0) "defined")`, `"/main.slpx:4:1"`},
+		{"trace_without_macros", `(list/len (macrotrace "(putln 1)"))`, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := newSession().Evaluate(prelude + tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Encode() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+			}
+		})
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"undefined", `(macroexpand "($nope)")`, "macroexpand: undefined macro $nope"},
+		{"several_forms", `(macroexpand1 "1 2")`, "macroexpand1: expected 1 form, got 2"},
+		{"parse_error", `(macrotrace "(putln")`, "macrotrace: "},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := newSession().Evaluate(prelude + "(try " + tt.source + " (error/message $error))")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Type != object.OBJ_TYPE_STRING || !strings.Contains(result.D.(string), tt.message) {
+				t.Errorf("expected an error mentioning %q, got %s", tt.message, result.Encode())
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"used_file", `
+(fs/write_file "/lib.slpx" "(set x 1)")
+(use "/lib.slpx")
+(fs/write_file "/lib.slpx" "(set x 2)")
+(reload "/lib.slpx")
+x`, "2"},
+		{"module_rebinds_exports", `
+(fs/write_file "/m.slpx" "(set a 1) (set old 1) (export a old)")
+(import "/m.slpx")
+(import "/m.slpx" "alias")
+(fs/write_file "/m.slpx" "(set a 2) (export a)")
+(reload "/m.slpx")
+{a m/a alias alias/a old (try m/old "gone")}`, `{a 2 alias 2 old "gone"}`},
+		{"importing_modules_see_the_change", `
+(fs/write_file "/b.slpx" "(set value 1)")
+(fs/write_file "/a.slpx" "(import \"/b.slpx\") (set get (fn () :I b/value))")
+(import "/a.slpx")
+(fs/write_file "/b.slpx" "(set value 2)")
+(reload "/b.slpx")
+(a/get)`, "2"},
+		{"failed_reload_keeps_the_module", `
+(fs/write_file "/m.slpx" "(set a 1)")
+(import "/m.slpx")
+(fs/write_file "/m.slpx" "(set a 2) @broken(on purpose)")
+(try (reload "/m.slpx") m/a)`, "1"},
+		{"relative_to_the_current_file", `
+(fs/write_file "/lib.slpx" "(set x 1)")
+(use "lib.slpx")
+(fs/write_file "/lib.slpx" "(set x 3)")
+(reload "lib")
+x`, "3"},
+	}
+
+	failures := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"never_loaded", `(reload "/nothing.slpx")`, "reload: /nothing.slpx has not been run by use or import"},
+		{"reload_errors", `
+(fs/write_file "/m.slpx" "(set a 1)")
+(import "/m.slpx")
+(fs/write_file "/m.slpx" "(int/add 1 \"x\")")
+(reload "/m.slpx")`, "reload: file /m.slpx item 0 produced an error"},
+		{"reloading_itself", `
+(fs/write_file "/self.slpx" "(set n 1)")
+(use "/self.slpx")
+(fs/write_file "/self.slpx" "(reload \"/self.slpx\")")
+(reload "/self.slpx")`, "reload: circular import: /self.slpx -> /self.slpx"},
+	}
+
+	for _, engine := range engines {
+		newSession := func() *Session {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			return NewSessionBuilder(logger).WithEngine(engine).WithFS(env.NewMemoryFS()).Build("/main.slpx")
+		}
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Encode() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Encode())
+				}
+			})
+		}
+		for _, tt := range failures {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				result, err := newSession().Evaluate(tt.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected an error, got %s", result.Encode())
+				}
+				if summary := result.D.(object.Error).Summary(); !strings.Contains(summary, tt.message) {
+					t.Errorf("expected the error to mention %q, got %q", tt.message, summary)
+				}
+			})
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	memFS := env.NewMemoryFS()
+	write := func(content string) {
+		t.Helper()
+		if err := memFS.WriteFile("/lib.slpx", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	session := NewSessionBuilder(logger).WithFS(memFS).Build("/main.slpx")
+
+	var reloaded []string
+	session.Watch(func(path string, result object.Obj, err error) {
+		if err != nil {
+			t.Errorf("unexpected Go error reloading %s: %v", path, err)
+		}
+		reloaded = append(reloaded, path+" "+string(result.Type))
+	})
+
+	expect := func(source string, want string) {
+		t.Helper()
+		result, err := session.Evaluate(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Encode() != want {
+			t.Fatalf("expected %s, got %s", want, result.Encode())
+		}
+	}
+
+	write("(set x 1)")
+	expect(`(use "/lib.slpx") x`, "1")
+	expect(`x`, "1")
+	if len(reloaded) != 0 {
+		t.Fatalf("expected nothing to reload before an edit, got %v", reloaded)
+	}
+
+	write("(set x 2)")
+	expect(`x`, "2")
+	if !slices.Equal(reloaded, []string{"/lib.slpx none"}) {
+		t.Fatalf("expected one reload, got %v", reloaded)
+	}
+
+	// a broken edit is reported and the session keeps going with what it had
+	write("(set x 3) (int/add 1 \"x\")")
+	expect(`(int/mul x 10)`, "30")
+	if !slices.Equal(reloaded, []string{"/lib.slpx none", "/lib.slpx error"}) {
+		t.Fatalf("expected the failed reload to be reported, got %v", reloaded)
+	}
+
+	// each edit is reloaded once
+	expect(`x`, "3")
+	if len(reloaded) != 2 {
+		t.Fatalf("expected no more reloads, got %v", reloaded)
+	}
+
+	session.Watch(nil)
+	write("(set x 4)")
+	expect(`x`, "3")
+}
+
+func TestPolicy(t *testing.T) {
+	dir := t.TempDir()
+	sandbox := filepath.Join(dir, "sandbox")
+	if err := os.Mkdir(sandbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		policy env.Policy
+		source string
+
+		// denied is the message expected, or empty when the call must succeed
+		denied string
+	}{
+		{"read_only_reads", env.Policy{}.With(fs.ReadOnly()...), `(fs/read_file "notes.txt")`, ""},
+		{"read_only_writes", env.Policy{}.With(fs.ReadOnly()...), `(fs/write_file "out.txt" "x")`, "fs/write_file: denied by policy"},
+		{"read_only_byte_writes", env.Policy{}.With(fs.ReadOnly()...), `(fs/append_bytes "out.txt" #x00)`, "fs/append_bytes: denied by policy"},
+		{"writes_under_root", env.Policy{}.With(fs.WritesUnder(sandbox)...), `(fs/write_file "sandbox/out.txt" "x")`, ""},
+		{"writes_outside_root", env.Policy{}.With(fs.WritesUnder(sandbox)...), `(fs/write_file "sandbox/../out.txt" "x")`, "fs/write_file: " + filepath.Join(dir, "sandbox/../out.txt") + " is outside of " + sandbox},
+		{"no_env_mutation", env.Policy{}.With(host.NoEnvMutation()...), `(host/env/set "SLPX_POLICY_TEST" "1")`, "host/env/set: denied by policy"},
+		{"env_reads_allowed", env.Policy{}.With(host.NoEnvMutation()...), `(host/env/get "HOME")`, ""},
+		{"no_hardware", env.Policy{}.With(host.NoHardware()...), `(host/hw/cpu/count)`, "host/hw/cpu/count: denied by policy"},
+		{"no_exit", env.Policy{}.With(env.NoExit()...), `(exit 0)`, "exit: denied by policy"},
+		{"deny_group", env.Policy{}.With(env.DenyGroup("host")), `(host/os)`, "host/os: denied by policy"},
+		{"allow_after_deny", env.Policy{}.With(env.DenyGroup("host"), env.AllowFunction("host/os")), `(host/os)`, ""},
+		{"deny_core_form", env.Policy{}.With(env.DenyFunction("if")), `(set f (fn () :I (if 1 2 3))) (f)`, "if: denied by policy"},
+		{"caught_by_try", env.Policy{}.With(env.NoExit()...), `(try (exit 0) (error/message $error))`, ""},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			t.Run(engine.String()+"/"+tt.name, func(t *testing.T) {
+				logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+				session := NewSessionBuilder(logger).
+					WithEngine(engine).
+					WithFS(env.DefaultFS()).
+					WithPolicy(tt.policy).
+					Build(filepath.Join(dir, "main.slpx"))
+				if err := session.GetFS().SetWorkingDir(dir); err != nil {
+					t.Fatal(err)
+				}
+
+				result, err := session.Evaluate(tt.source)
+				if err != nil {
+					t.Fatalf("unexpected Go error: %v", err)
+				}
+				if tt.denied == "" {
+					if result.Type == object.OBJ_TYPE_ERROR {
+						t.Fatalf("expected the call to be allowed, got %s", result.D.(object.Error).Message)
+					}
+					return
+				}
+				if result.Type != object.OBJ_TYPE_ERROR {
+					t.Fatalf("expected the call to be denied, got %s", result.Encode())
+				}
+				if message := result.D.(object.Error).Message; message != tt.denied {
+					t.Errorf("expected %q, got %q", tt.denied, message)
+				}
+			})
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "out.txt")); err == nil {
+		t.Error("a denied write reached the filesystem")
+	}
+	if os.Getenv("SLPX_POLICY_TEST") != "" {
+		t.Error("a denied env/set reached the environment")
+	}
+}
+
+// fsScript runs through the fs group and `use`, yielding "ok" or the step
+// that went wrong
+const fsScript = `
+(set check (fn (label :S ok :I) :S (if ok "ok" (str/concat "failed: " label))))
+(fs/mk_dir_all "work/nested")
+(fs/write_file "work/a.txt" "one")
+(fs/append_file "work/a.txt" "two")
+(fs/write_file "work/lib.slpx" "(set from_lib 42)")
+(use "work/lib.slpx")
+(do
+  (set r (check "read" (str/eq (fs/read_file "work/a.txt") "onetwo")))
+  (if (str/eq r "ok") 0 (exit 1))
+  (set r (check "use" (int/eq from_lib 42)))
+  (if (str/eq r "ok") 0 (exit 2))
+  (set r (check "list" (int/eq (list/len (fs/list_dir "work")) 3)))
+  (if (str/eq r "ok") 0 (exit 3))
+  (fs/rm_file "work/a.txt")
+  (set r (check "rm" (int/eq (fs/file? "work/a.txt") 0)))
+  (if (str/eq r "ok") 0 (exit 4))
+  (fs/rm_dir_all "work")
+  (set r (check "rm_dir_all" (int/eq (fs/exists? "work") 0)))
+  (if (str/eq r "ok") 0 (exit 5))
+  "ok")`
+
+func runFsScript(t *testing.T, filesystem env.FS, mainPath string) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	session := NewSessionBuilder(logger).WithFS(filesystem).Build(mainPath)
+
+	result, err := session.Evaluate(fsScript)
+	if code, exited := env.ExitCode(err); exited {
+		t.Fatalf("fs script failed at step %d", code)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Encode() != `"ok"` {
+		t.Fatalf("unexpected result: %s", result.Encode())
+	}
+}
+
+func TestFileSystems(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		runFsScript(t, env.NewMemoryFS(), "/main.slpx")
+	})
+
+	t.Run("overlay", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "base.txt"), []byte("base"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		base := env.DefaultFS()
+		if err := base.SetWorkingDir(dir); err != nil {
+			t.Fatal(err)
+		}
+		overlay := env.NewOverlayFS(base)
+		runFsScript(t, overlay, filepath.Join(dir, "main.slpx"))
+	})
+
+	t.Run("jailed", func(t *testing.T) {
+		root := t.TempDir()
+		jail, err := env.NewJailedFS(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runFsScript(t, jail, filepath.Join(jail.WorkingDir(), "main.slpx"))
+	})
+}
+
+var bundleFiles = map[string]string{
+	"main.slpx":        `(use "lib/util.slpx") (set greeting (util/greet (fs/read_file "data/name.txt")))`,
+	"lib/util.slpx":    `(use "strings.slpx") (set util/greet (fn (name :S) :S (str/concat prefix name)))`,
+	"lib/strings.slpx": `(set prefix "hello, ")`,
+	"data/name.txt":    "bundle",
+}
+
+func zipBundle(t *testing.T) env.FS {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, body := range bundleFiles {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := env.NewZipFS(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func tarGzBundle(t *testing.T) env.FS {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for name, body := range bundleFiles {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := env.NewTarGzFS(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestArchiveFS(t *testing.T) {
+	for name, open := range map[string]func(*testing.T) env.FS{"zip": zipBundle, "tar.gz": tarGzBundle} {
+		t.Run(name, func(t *testing.T) {
+			bundle := open(t)
+			main, err := bundle.ReadFile("/main.slpx")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			session := NewSessionBuilder(logger).WithFS(bundle).Build("/main.slpx")
+			if result, err := session.Evaluate(string(main)); err != nil || result.Type == object.OBJ_TYPE_ERROR {
+				t.Fatalf("running the bundle failed: %s %v", result.Encode(), err)
+			}
+
+			checks := []struct {
+				source string
+				want   string
+			}{
+				{`greeting`, `"hello, bundle"`},
+				{`(fs/exists? "lib/util.slpx")`, `1`},
+				{`(fs/exists? "lib/missing.slpx")`, `0`},
+				{`(fs/dir? "data")`, `1`},
+				{`(fs/list_dir "lib")`, `("strings.slpx" "util.slpx")`},
+				{`(fs/list_dir "/")`, `("data" "lib" "main.slpx")`},
+				{`(try (fs/write_file "data/name.txt" "x") "refused")`, `"refused"`},
+				{`(fs/read_file "data/name.txt")`, `"bundle"`},
+			}
+			for _, check := range checks {
+				result, err := session.Evaluate(check.source)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", check.source, err)
+				}
+				if got := result.Encode(); got != check.want {
+					t.Errorf("%s: expected %s, got %s", check.source, check.want, got)
+				}
+			}
+
+			if err := bundle.MkDir("new", 0755); !errors.Is(err, env.ErrReadOnly) {
+				t.Errorf("expected ErrReadOnly, got %v", err)
+			}
+		})
+	}
+}
@@ -2,6 +2,10 @@ package slp
 
 import (
 	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/bosley/slpx/pkg/slp/object"
@@ -294,6 +298,16 @@ func TestRoundTrip(t *testing.T) {
 		`<=`,
 		`my_var_123`,
 		`((deeply (nested (structure (with (many (levels (of (parentheses)))))))))`,
+		`{}`,
+		`{"a" 1 2 "two" x (list 3.5) 1.5 {"nested" _}}`,
+		`'{"quoted" (int/add 1 2)}`,
+		`#xdeadbeef`,
+		`"héllo wörld ✓"`,
+		`(#x #x00ff)`,
+		`(123456789012345678901234567890 -9223372036854775809 9223372036854775807)`,
+		"`(a ,b ,@c)",
+		"`{\"x\" ,(int/add x 1)}",
+		"``(a ,,b)",
 	}
 
 	for i, input := range testCases {
@@ -358,6 +372,24 @@ func objectsEqual(a, b object.Obj) bool {
 		return true
 	case object.OBJ_TYPE_SOME:
 		return objectsEqual(object.Obj(a.D.(object.Some)), object.Obj(b.D.(object.Some)))
+	case object.OBJ_TYPE_QUASI, object.OBJ_TYPE_UNQUOTE, object.OBJ_TYPE_SPLICE:
+		return objectsEqual(a.D.(object.Obj), b.D.(object.Obj))
+	case object.OBJ_TYPE_BYTES:
+		return string(a.D.(object.Bytes)) == string(b.D.(object.Bytes))
+	case object.OBJ_TYPE_BIGINT:
+		return a.D.(*big.Int).Cmp(b.D.(*big.Int)) == 0
+	case object.OBJ_TYPE_MAP:
+		aEntries := a.D.(*object.Map).Entries()
+		bEntries := b.D.(*object.Map).Entries()
+		if len(aEntries) != len(bEntries) {
+			return false
+		}
+		for i := range aEntries {
+			if !objectsEqual(aEntries[i].Key, bEntries[i].Key) || !objectsEqual(aEntries[i].Value, bEntries[i].Value) {
+				return false
+			}
+		}
+		return true
 
 	default:
 		return false
@@ -381,8 +413,8 @@ func TestErrorLiteral(t *testing.T) {
 				if errData.Message != "Something went wrong" {
 					t.Errorf("expected message 'Something went wrong', got %q", errData.Message)
 				}
-				if errData.Position != 0 {
-					t.Errorf("expected position 0, got %d", errData.Position)
+				if errData.Position.Start != 0 || errData.Position.Line != 1 || errData.Position.Column != 1 {
+					t.Errorf("expected position 0 (1:1), got %d (%d:%d)", errData.Position.Start, errData.Position.Line, errData.Position.Column)
 				}
 			},
 		},
@@ -412,6 +444,53 @@ func TestErrorLiteral(t *testing.T) {
 				}
 			},
 		},
+		{
+			input:       `@not_found(no such user {"id" 42})`,
+			expectError: false,
+			checkResult: func(t *testing.T, obj object.Obj) {
+				errData := obj.D.(object.Error)
+				if errData.Code != "not_found" {
+					t.Errorf("expected code not_found, got %q", errData.Code)
+				}
+				if errData.Message != "no such user" {
+					t.Errorf("expected the map to be left out of the message, got %q", errData.Message)
+				}
+				if errData.Data == nil || errData.Data.Encode() != `{"id" 42}` {
+					t.Errorf("expected the map as data, got %v", errData.Data)
+				}
+			},
+		},
+		{
+			input:       `@config(could not load @io(disk gone))`,
+			expectError: false,
+			checkResult: func(t *testing.T, obj object.Obj) {
+				errData := obj.D.(object.Error)
+				if errData.Message != "could not load" || errData.Data != nil {
+					t.Errorf("expected only a message, got %q and %v", errData.Message, errData.Data)
+				}
+				if errData.Cause == nil || errData.Cause.Code != "io" || errData.Cause.Message != "disk gone" {
+					t.Fatalf("expected the nested literal as the cause, got %v", errData.Cause)
+				}
+				if errData.Summary() != "[config] could not load\ncaused by: [io] disk gone" {
+					t.Errorf("unexpected summary %q", errData.Summary())
+				}
+			},
+		},
+		{
+			input:       `@(a {"b" 1} c)`,
+			expectError: false,
+			checkResult: func(t *testing.T, obj object.Obj) {
+				errData := obj.D.(object.Error)
+				if errData.Message != `a {"b" 1} c` || errData.Data != nil {
+					t.Errorf("expected a map before the end to stay in the message, got %q", errData.Message)
+				}
+			},
+		},
+		{
+			input:       `@not_found (x)`,
+			expectError: true,
+			checkResult: nil,
+		},
 		{
 			input:       `@`,
 			expectError: true,
@@ -452,6 +531,156 @@ func TestErrorLiteral(t *testing.T) {
 	}
 }
 
+func TestMapLiteral(t *testing.T) {
+	parser := &Parser{Target: `{"name" "ada" age (int/add 30 6) 1 1.0 1.0 "real"}`}
+	result, err := parser.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Type != object.OBJ_TYPE_MAP {
+		t.Fatalf("expected MAP type, got %v", result.Type)
+	}
+	m := result.D.(*object.Map)
+	if m.Len() != 4 {
+		t.Fatalf("expected 4 entries, got %d", m.Len())
+	}
+	age, found := m.Get(object.Obj{Type: object.OBJ_TYPE_IDENTIFIER, D: object.Identifier("age")})
+	if !found || age.Type != object.OBJ_TYPE_LIST {
+		t.Errorf("expected the unevaluated list under age, got %v %v", found, age)
+	}
+	if one, _ := m.Get(object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)}); one.Type != object.OBJ_TYPE_REAL {
+		t.Errorf("expected integer key 1 to hold 1.0, got %s", one.Type)
+	}
+	if m.Has(object.Obj{Type: object.OBJ_TYPE_STRING, D: "age"}) {
+		t.Error("string key should not match identifier key")
+	}
+
+	errorCases := []struct {
+		input   string
+		message string
+	}{
+		{`{"a" 1`, "unclosed map"},
+		{`{"a"}`, "has no value"},
+		{`{"a" 1 "a" 2}`, "duplicate map key"},
+		{`{(a) 1}`, "map key"},
+		{`{_ 1}`, "map key"},
+		{`(list "a" })`, ""},
+	}
+	for i, tc := range errorCases {
+		t.Run(fmt.Sprintf("map_error_%d", i), func(t *testing.T) {
+			_, err := (&Parser{Target: tc.input}).Parse()
+			if err == nil {
+				t.Fatalf("expected error for %s", tc.input)
+			}
+			if !strings.Contains(err.Error(), tc.message) {
+				t.Errorf("expected error containing %q, got %v", tc.message, err)
+			}
+		})
+	}
+}
+
+func TestBytesLiteral(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []byte
+	}{
+		{`#x`, []byte{}},
+		{`#x00`, []byte{0}},
+		{`#xDEADbeef`, []byte{0xde, 0xad, 0xbe, 0xef}},
+	}
+	for _, tc := range testCases {
+		result, err := (&Parser{Target: tc.input}).Parse()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.input, err)
+		}
+		if result.Type != object.OBJ_TYPE_BYTES {
+			t.Fatalf("%s: expected BYTES type, got %v", tc.input, result.Type)
+		}
+		if string(result.D.(object.Bytes)) != string(tc.expected) {
+			t.Errorf("%s: expected %x, got %x", tc.input, tc.expected, result.D.(object.Bytes))
+		}
+	}
+
+	for _, input := range []string{`#x0`, `#xzz`, `#y00`, `#`} {
+		if _, err := (&Parser{Target: input}).Parse(); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestQuasiquote(t *testing.T) {
+	result, err := (&Parser{Target: "`(a ,b ,@(c d) 'e,f)"}).Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Type != object.OBJ_TYPE_QUASI {
+		t.Fatalf("expected QUASI type, got %v", result.Type)
+	}
+
+	template := result.D.(object.Quasi)
+	if template.Type != object.OBJ_TYPE_LIST {
+		t.Fatalf("expected a list template, got %v", template.Type)
+	}
+	items := template.D.(object.List)
+	expected := []object.ObjType{
+		object.OBJ_TYPE_IDENTIFIER,
+		object.OBJ_TYPE_UNQUOTE,
+		object.OBJ_TYPE_SPLICE,
+		object.OBJ_TYPE_SOME,
+	}
+	if len(items) != len(expected) {
+		t.Fatalf("expected %d items, got %d", len(expected), len(items))
+	}
+	for i, objType := range expected {
+		if items[i].Type != objType {
+			t.Errorf("item %d: expected %v, got %v", i, objType, items[i].Type)
+		}
+	}
+
+	spliced := items[2].D.(object.Splice)
+	if spliced.Type != object.OBJ_TYPE_LIST || len(spliced.D.(object.List)) != 2 {
+		t.Errorf("expected the splice to hold (c d), got %s", spliced.Encode())
+	}
+
+	// a comma inside an identifier is part of it
+	quoted := items[3].D.(object.Some)
+	if quoted.Type != object.OBJ_TYPE_IDENTIFIER || quoted.D.(object.Identifier) != "e,f" {
+		t.Errorf("expected the identifier e,f, got %s", quoted.Encode())
+	}
+
+	for _, input := range []string{"`(a", ",(", ",@)"} {
+		if _, err := (&Parser{Target: input}).Parse(); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestIntegerLiteralSize(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected object.ObjType
+	}{
+		{`9223372036854775807`, object.OBJ_TYPE_INTEGER},
+		{`-9223372036854775808`, object.OBJ_TYPE_INTEGER},
+		{`9223372036854775808`, object.OBJ_TYPE_BIGINT},
+		{`-9223372036854775809`, object.OBJ_TYPE_BIGINT},
+		{`+123456789012345678901234567890`, object.OBJ_TYPE_BIGINT},
+	}
+	for _, tc := range testCases {
+		result, err := (&Parser{Target: tc.input}).Parse()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.input, err)
+		}
+		if result.Type != tc.expected {
+			t.Fatalf("%s: expected %v type, got %v", tc.input, tc.expected, result.Type)
+		}
+		expected, _ := new(big.Int).SetString(tc.input, 10)
+		if actual, _ := object.BigOf(result); actual.Cmp(expected) != 0 {
+			t.Errorf("%s: expected %s, got %s", tc.input, expected, actual)
+		}
+	}
+}
+
 func TestMacros(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -529,6 +758,28 @@ func TestMacros(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "macro with quasiquoted parameter",
+			input: "$(pair ?key ?value) `(?key ,?value) ($pair name (str/from 1))",
+			expected: []object.Obj{
+				{
+					Type: object.OBJ_TYPE_QUASI,
+					D: object.Quasi(object.Obj{
+						Type: object.OBJ_TYPE_LIST,
+						D: object.List{
+							{Type: object.OBJ_TYPE_IDENTIFIER, D: object.Identifier("name")},
+							{Type: object.OBJ_TYPE_UNQUOTE, D: object.Unquote(object.Obj{
+								Type: object.OBJ_TYPE_LIST,
+								D: object.List{
+									{Type: object.OBJ_TYPE_IDENTIFIER, D: object.Identifier("str/from")},
+									{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)},
+								},
+							})},
+						},
+					}),
+				},
+			},
+		},
 		{
 			name:  "non-macro list unchanged",
 			input: `(regular function call)`,
@@ -593,6 +844,36 @@ func TestMacroErrors(t *testing.T) {
 			input:       `$() (add 1 1)`,
 			expectError: true,
 		},
+		{
+			name:        "rest parameter not last",
+			input:       `$(test ?xs... ?y) (add ?y)`,
+			expectError: true,
+		},
+		{
+			name:        "too few arguments before rest parameter",
+			input:       `$(test ?x ?y ?zs...) (add ?x ?y ?zs...) ($test 1)`,
+			expectError: true,
+		},
+		{
+			name:        "reserved macro name",
+			input:       `$(import ?x) ?x`,
+			expectError: true,
+		},
+		{
+			name:        "import without a loader",
+			input:       `($import "macros.slpx")`,
+			expectError: true,
+		},
+		{
+			name:        "import without a path",
+			input:       `($import macros)`,
+			expectError: true,
+		},
+		{
+			name:        "export of a non-identifier",
+			input:       `($export 1)`,
+			expectError: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -609,6 +890,227 @@ func TestMacroErrors(t *testing.T) {
 	}
 }
 
+func TestMacroRestParameters(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`$(body ?first ?rest...) (do ?first ?rest...) ($body a b c)`, "(do a b c)"},
+		{`$(body ?first ?rest...) (do ?first ?rest...) ($body a)`, "(do a)"},
+		{`$(all ?xs...) '?xs ($all 1 2)`, "'(1 2)"},
+		{`$(all ?xs...) (f '(?xs...) ?xs) ($all 1 2)`, "(f '(1 2) (1 2))"},
+	}
+
+	for _, tc := range testCases {
+		results, err := NewParser(tc.input).ParseAll()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.input, err)
+		}
+		if len(results) != 1 || results[0].Encode() != tc.expected {
+			t.Errorf("%s: expected %s, got %v", tc.input, tc.expected, results)
+		}
+	}
+}
+
+func TestMacroGensyms(t *testing.T) {
+	results, err := NewParser(`
+$(swap ?a ?b) (do (set tmp# ?a) (set ?a ?b) (set ?b tmp#))
+$(swap_twice ?a ?b) (do ($swap ?a ?b) ($swap ?a ?b))
+($swap tmp x)
+($swap tmp x)
+($swap_twice x y)
+($swap_twice x y)`).ParseAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+
+	names := func(obj object.Obj) []string {
+		var found []string
+		var walk func(object.Obj)
+		walk = func(obj object.Obj) {
+			switch obj.Type {
+			case object.OBJ_TYPE_IDENTIFIER:
+				if name := string(obj.D.(object.Identifier)); strings.HasPrefix(name, "tmp#") {
+					found = append(found, name)
+				}
+			case object.OBJ_TYPE_LIST:
+				for _, item := range obj.D.(object.List) {
+					walk(item)
+				}
+			}
+		}
+		walk(obj)
+		return found
+	}
+
+	seen := make(map[string]bool)
+	for i, result := range results {
+		found := names(result)
+		if i < 2 && (len(found) != 2 || found[0] != found[1]) {
+			t.Fatalf("expansion %d: expected one gensym used twice, got %v in %s", i, found, result.Encode())
+		}
+		if i >= 2 && (len(found) != 4 || found[0] != found[1] || found[2] != found[3] || found[0] == found[2]) {
+			t.Fatalf("expansion %d: expected two gensyms used twice each, got %v in %s", i, found, result.Encode())
+		}
+		for j, name := range found {
+			if j%2 == 0 {
+				if seen[name] {
+					t.Errorf("expansion %d reused the gensym %s", i, name)
+				}
+				seen[name] = true
+			}
+		}
+	}
+
+	// an argument that happens to be named like the gensym is left alone
+	if !strings.Contains(results[0].Encode(), "(set tmp x)") {
+		t.Errorf("expected the argument tmp to be kept, got %s", results[0].Encode())
+	}
+}
+
+func TestMacroExports(t *testing.T) {
+	files := map[string]string{
+		"all.slpx":      `$(one) 1 $(two) 2`,
+		"some.slpx":     `$(one) 1 $(two) 2 ($export $two)`,
+		"reexport.slpx": `($import "all.slpx") $(three) 3 ($export one three)`,
+		"missing.slpx":  `($export nope)`,
+	}
+	var loader MacroLoader
+	loader = func(target string) (map[string]*MacroDef, error) {
+		source, ok := files[target]
+		if !ok {
+			return nil, fmt.Errorf("no such file %s", target)
+		}
+		parser := NewParser(source)
+		parser.MacroLoader = loader
+		if _, err := parser.ParseAll(); err != nil {
+			return nil, err
+		}
+		return parser.ExportedMacros()
+	}
+
+	testCases := []struct {
+		target   string
+		expected []string
+	}{
+		{"all.slpx", []string{"one", "two"}},
+		{"some.slpx", []string{"two"}},
+		{"reexport.slpx", []string{"one", "three"}},
+	}
+	for _, tc := range testCases {
+		macros, err := loader(tc.target)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.target, err)
+		}
+		names := slices.Sorted(maps.Keys(macros))
+		slices.Sort(tc.expected)
+		if !slices.Equal(names, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.target, tc.expected, names)
+		}
+	}
+
+	if _, err := loader("missing.slpx"); err == nil {
+		t.Error("expected an error exporting an undefined macro")
+	}
+
+	parser := NewParser(`($import "some.slpx") ($two)`)
+	parser.MacroLoader = loader
+	results, err := parser.ParseAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Encode() != "2" {
+		t.Errorf("expected the imported macro to expand to 2, got %v", results)
+	}
+
+	parser = NewParser(`($import "some.slpx") ($one)`)
+	parser.MacroLoader = loader
+	if _, err := parser.ParseAll(); err == nil {
+		t.Error("expected a macro that is not exported to be undefined")
+	}
+}
+
+func TestMacroExpand(t *testing.T) {
+	parser := NewParser(`$(inner ?x) (if ?x ?x 0)
+$(outer ?x) ($inner ?x)
+$(apply ?m ?x) (?m ?x)
+(putln ($apply $inner 25))
+($outer 25)`)
+	parser.NoExpand = true
+	forms, err := parser.ParseAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(forms) != 2 || forms[1].Encode() != "($outer 25)" {
+		t.Fatalf("expected the calls to be left as written, got %v", forms)
+	}
+
+	// the template of outer was expanded as it was defined
+	result, expanded, err := parser.Expand1(forms[1])
+	if err != nil || !expanded || result.Encode() != "(if 25 25 0)" {
+		t.Errorf("Expand1: expected (if 25 25 0), got %s (%v, %v)", result.Encode(), expanded, err)
+	}
+	result, expanded, err = parser.Expand1(forms[0].D.(object.List)[1])
+	if err != nil || !expanded || result.Encode() != "($inner 25)" {
+		t.Errorf("Expand1: expected ($inner 25), got %s (%v, %v)", result.Encode(), expanded, err)
+	}
+	result, expanded, err = parser.Expand1(forms[0])
+	if err != nil || expanded || result.Encode() != "(putln ($apply $inner 25))" {
+		t.Errorf("Expand1: expected a form that is not a call to be kept, got %s (%v, %v)", result.Encode(), expanded, err)
+	}
+
+	var steps []string
+	parser.Trace = func(step MacroExpansion) {
+		steps = append(steps, fmt.Sprintf("%d %s %d:%d %d:%d %s", step.Depth, step.Macro.Name,
+			step.Call.Pos.Line, step.Call.Pos.Column,
+			step.Macro.Pos.Line, step.Macro.Pos.Column, step.Result.Encode()))
+	}
+	result, err = parser.Expand(forms[0])
+	if err != nil || result.Encode() != "(putln (if 25 25 0))" {
+		t.Errorf("Expand: expected (putln (if 25 25 0)), got %s (%v)", result.Encode(), err)
+	}
+	expected := []string{
+		"0 apply 4:8 3:1 ($inner 25)",
+		"1 inner 3:16 1:1 (if 25 25 0)",
+	}
+	if !slices.Equal(steps, expected) {
+		t.Errorf("expected the trace %q, got %q", expected, steps)
+	}
+
+	parser = NewParser(`$(forever ?m) (?m ?m) ($forever $forever)`)
+	if _, err := parser.ParseAll(); err == nil || !strings.Contains(err.Error(), "expansion nested more than") {
+		t.Errorf("expected a recursive macro to stop with an error, got %v", err)
+	}
+	parser = NewParser(`$(forever ?x) ($forever ?x)`)
+	if _, err := parser.ParseAll(); err == nil || !strings.Contains(err.Error(), "undefined macro $forever") {
+		t.Errorf("expected a macro not to see itself while it is defined, got %v", err)
+	}
+}
+
+func TestMacroRedefinition(t *testing.T) {
+	parser := NewParser(`$(inner ?x) (first ?x)
+$(outer ?x) ($inner ?x)
+$(inner ?x) (second ?x)
+($outer 1)
+($inner 1)`)
+	forms, err := parser.ParseAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(forms) != 2 {
+		t.Fatalf("expected 2 forms, got %v", forms)
+	}
+	if forms[0].Encode() != "(first 1)" {
+		t.Errorf("expected outer to keep the inner it was defined with, got %s", forms[0].Encode())
+	}
+	if forms[1].Encode() != "(second 1)" {
+		t.Errorf("expected later calls to use the new inner, got %s", forms[1].Encode())
+	}
+}
+
 func TestEncode(t *testing.T) {
 	testCases := []struct {
 		obj      object.Obj
@@ -696,3 +1198,65 @@ func TestEncode(t *testing.T) {
 		})
 	}
 }
+
+func TestSpans(t *testing.T) {
+	t.Run("line_and_column", func(t *testing.T) {
+		parser := NewParserForSource("(set x 1)\n\n  (foo \"bar\")", "spans.slpx")
+		items, err := parser.ParseAll()
+		if err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+		if len(items) != 2 {
+			t.Fatalf("expected 2 items, got %d", len(items))
+		}
+
+		second := items[1]
+		if second.Pos.Line != 3 || second.Pos.Column != 3 {
+			t.Errorf("expected list at 3:3, got %d:%d", second.Pos.Line, second.Pos.Column)
+		}
+		if second.Pos.Start != 13 || second.Pos.End != 24 {
+			t.Errorf("expected list to span [13, 24), got [%d, %d)", second.Pos.Start, second.Pos.End)
+		}
+		if second.Pos.File() != "spans.slpx" {
+			t.Errorf("expected source spans.slpx, got %q", second.Pos.File())
+		}
+
+		str := second.D.(object.List)[1]
+		if str.Pos.Line != 3 || str.Pos.Column != 8 || str.Pos.End-str.Pos.Start != 5 {
+			t.Errorf("expected string at 3:8 with width 5, got %d:%d width %d", str.Pos.Line, str.Pos.Column, str.Pos.End-str.Pos.Start)
+		}
+	})
+
+	t.Run("beyond_64k", func(t *testing.T) {
+		padding := strings.Repeat(";; filler comment line\n", 4000)
+		source := padding + "(a b c)"
+		parser := NewParser(source)
+		items, err := parser.ParseAll()
+		if err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+		if len(items) != 1 {
+			t.Fatalf("expected 1 item, got %d", len(items))
+		}
+
+		pos := items[0].Pos
+		if pos.Start != len(padding) {
+			t.Errorf("expected start %d, got %d", len(padding), pos.Start)
+		}
+		if pos.Line != 4001 || pos.Column != 1 {
+			t.Errorf("expected 4001:1, got %d:%d", pos.Line, pos.Column)
+		}
+	})
+
+	t.Run("parse_error", func(t *testing.T) {
+		parser := NewParser("(ok)\n  (broken")
+		_, err := parser.ParseAll()
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("expected *ParseError, got %v", err)
+		}
+		if parseErr.Position.Line != 2 || parseErr.Position.Column != 3 {
+			t.Errorf("expected error at 2:3, got %d:%d", parseErr.Position.Line, parseErr.Position.Column)
+		}
+	})
+}
@@ -1,18 +1,27 @@
 package slp
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
 
 	"github.com/bosley/slpx/pkg/slp/object"
 )
 
 type ParseError struct {
-	Position int
+	Position object.Span
 	Message  string
 }
 
 func (e *ParseError) Error() string {
-	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+	return fmt.Sprintf("%s at %s", e.Message, e.Position)
 }
 
 func findActualUnclosedParen(source string, startPos int) int {
@@ -73,6 +82,9 @@ type ATOM string
 const (
 	ATOM_LIST_START = "("
 	ATOM_LIST_END   = ")"
+	ATOM_MAP_START  = "{"
+	ATOM_MAP_END    = "}"
+	ATOM_BYTES      = "#x"
 	ATOM_NONE       = "_"
 	ATOM_SOME       = "*"
 )
@@ -80,13 +92,77 @@ const (
 type MacroDef struct {
 	Name       string
 	Parameters []string
-	Template   object.Obj
+
+	// Rest is set when the last parameter was written ?name... and takes
+	// every argument left over, as a list
+	Rest     bool
+	Template object.Obj
+
+	// Pos is where the macro was defined
+	Pos object.Span
 }
 
+// MacroExpansion is a macro applied once, as told to a parser's Trace
+type MacroExpansion struct {
+	Macro *MacroDef
+
+	// Call is the call that was expanded, after its arguments were, and
+	// Result what it expanded to before the macro calls in that were
+	Call   object.Obj
+	Result object.Obj
+
+	// Depth is 0 for a call in the source, 1 for a call the expansion of
+	// that produced, and so on
+	Depth int
+}
+
+func (x MacroExpansion) String() string {
+	return fmt.Sprintf("$%s at %s (defined at %s)", x.Macro.Name, x.Call.Pos, x.Macro.Pos)
+}
+
+// maxExpansionDepth stops a macro that (directly or not) expands to a call of
+// itself
+const maxExpansionDepth = 1000
+
+// the parse-time directives ($import "path") and ($export name ...), and the
+// suffix that marks a rest parameter
+const (
+	macroImport = "import"
+	macroExport = "export"
+	restSuffix  = "..."
+)
+
+// MacroLoader returns the macros the file target exports, for ($import
+// target). It is up to the loader where target is looked for
+type MacroLoader func(target string) (map[string]*MacroDef, error)
+
 type Parser struct {
 	Target   string
 	Position int
 	Macros   map[string]*MacroDef
+	Source   object.SourceID
+
+	// MacroLoader is used by $import. Without one, $import is a parse error
+	MacroLoader MacroLoader
+
+	// NoExpand leaves macro calls as they are written, for Expand and
+	// Expand1. Macro definitions, $import and $export still take effect, and
+	// the calls in a macro's template are still expanded as it is defined
+	NoExpand bool
+
+	// Trace, when set, is told about every macro applied, in order
+	Trace func(MacroExpansion)
+
+	// depth counts the expansions under way
+	depth int
+
+	// the macros defined in Target, in order, and those named by $export
+	defined        []string
+	exports        []string
+	exportDeclared bool
+
+	// offsets of the first byte of every line in Target, built on first use
+	lineStarts []int
 }
 
 func NewParser(target string) *Parser {
@@ -97,16 +173,53 @@ func NewParser(target string) *Parser {
 	}
 }
 
+// NewParserForSource creates a parser whose objects carry spans that name the
+// given source (typically the path of the file being parsed)
+func NewParserForSource(target string, source string) *Parser {
+	parser := NewParser(target)
+	parser.Source = object.RegisterSource(source)
+	return parser
+}
+
+func (p *Parser) span(start int, end int) object.Span {
+	line, column := p.lineColumn(start)
+	return object.Span{
+		Source: p.Source,
+		Start:  start,
+		End:    end,
+		Line:   line,
+		Column: column,
+	}
+}
+
+func (p *Parser) lineColumn(offset int) (int, int) {
+	if p.lineStarts == nil {
+		p.lineStarts = []int{0}
+		for i := 0; i < len(p.Target); i++ {
+			if p.Target[i] == '\n' {
+				p.lineStarts = append(p.lineStarts, i+1)
+			}
+		}
+	}
+
+	line := sort.Search(len(p.lineStarts), func(i int) bool {
+		return p.lineStarts[i] > offset
+	})
+	return line, offset - p.lineStarts[line-1] + 1
+}
+
 func (p *Parser) Parse() (object.Obj, error) {
 	p.skipWhitespace()
 
 	if p.Position >= len(p.Target) {
-		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: uint16(p.Position)}, nil
+		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: p.span(p.Position, p.Position)}, nil
 	}
 
 	switch p.Target[p.Position] {
 	case '(':
 		return p.parseList()
+	case '{':
+		return p.parseMap()
 	case '\'':
 		quotePos := p.Position
 		p.Position++
@@ -114,9 +227,13 @@ func (p *Parser) Parse() (object.Obj, error) {
 		if err != nil {
 			return object.Obj{}, err
 		}
-		return object.Obj{Type: object.OBJ_TYPE_SOME, D: object.Some(quoted), Pos: uint16(quotePos)}, nil
+		return object.Obj{Type: object.OBJ_TYPE_SOME, D: object.Some(quoted), Pos: p.span(quotePos, p.Position)}, nil
+	case '`', ',':
+		return p.parseQuasi()
 	case '@':
 		return p.parseErrorLiteral()
+	case '#':
+		return p.parseBytes()
 	case '$':
 		if p.Position+1 < len(p.Target) && p.Target[p.Position+1] == '(' {
 			return p.parseMacroDefinition()
@@ -125,7 +242,7 @@ func (p *Parser) Parse() (object.Obj, error) {
 	case '_':
 		nonePos := p.Position
 		p.Position++
-		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: uint16(nonePos)}, nil
+		return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: p.span(nonePos, p.Position)}, nil
 	case ';':
 		for p.Position < len(p.Target) && p.Target[p.Position] != '\n' {
 			p.Position++
@@ -169,11 +286,11 @@ func (p *Parser) parseList() (object.Obj, error) {
 		p.skipWhitespace()
 		if p.Position >= len(p.Target) {
 			actualPos := findActualUnclosedParen(p.Target, listStart)
-			return object.Obj{}, &ParseError{Position: actualPos, Message: "unclosed list"}
+			return object.Obj{}, &ParseError{Position: p.span(actualPos, actualPos+1), Message: "unclosed list"}
 		}
 		if p.Target[p.Position] == ')' {
 			p.Position++
-			listObj := object.Obj{Type: object.OBJ_TYPE_LIST, D: items, Pos: uint16(listStart)}
+			listObj := object.Obj{Type: object.OBJ_TYPE_LIST, D: items, Pos: p.span(listStart, p.Position)}
 			return p.expandMacroIfNeeded(listObj)
 		}
 		item, err := p.Parse()
@@ -184,7 +301,102 @@ func (p *Parser) parseList() (object.Obj, error) {
 	}
 
 	actualPos := findActualUnclosedParen(p.Target, listStart)
-	return object.Obj{}, &ParseError{Position: actualPos, Message: "unclosed list"}
+	return object.Obj{}, &ParseError{Position: p.span(actualPos, actualPos+1), Message: "unclosed list"}
+}
+
+/*
+parseMap reads a map literal, {key value key value ...}. Keys are taken as
+written and must be strings, integers, reals, or identifiers; values are
+parsed like anything else and evaluated when the literal is, so
+
+	{name "slpx" version (str/concat "1." minor)}
+
+has the identifiers name and version as keys
+*/
+func (p *Parser) parseMap() (object.Obj, error) {
+	mapStart := p.Position
+	p.Position++
+	entries := object.NewMap()
+	var key *object.Obj
+
+	for p.Position < len(p.Target) {
+		p.skipWhitespace()
+		if p.Position >= len(p.Target) {
+			break
+		}
+		if p.Target[p.Position] == '}' {
+			if key != nil {
+				return object.Obj{}, &ParseError{Position: key.Pos, Message: fmt.Sprintf("map key %s has no value", key.Encode())}
+			}
+			p.Position++
+			return object.Obj{Type: object.OBJ_TYPE_MAP, D: entries, Pos: p.span(mapStart, p.Position)}, nil
+		}
+		item, err := p.Parse()
+		if err != nil {
+			return object.Obj{}, err
+		}
+		if key == nil {
+			if !object.IsMapKey(item) {
+				return object.Obj{}, &ParseError{Position: item.Pos, Message: fmt.Sprintf("map key must be a string, integer, real, or identifier, got %s", item.Type)}
+			}
+			if entries.Has(item) {
+				return object.Obj{}, &ParseError{Position: item.Pos, Message: fmt.Sprintf("duplicate map key %s", item.Encode())}
+			}
+			key = &item
+			continue
+		}
+		entries.Set(*key, item)
+		key = nil
+	}
+
+	return object.Obj{}, &ParseError{Position: p.span(mapStart, mapStart+1), Message: "unclosed map"}
+}
+
+// parseBytes reads a bytes literal, #x followed by an even number of hex
+// digits: #xdeadbeef. A bare #x is empty bytes
+func (p *Parser) parseBytes() (object.Obj, error) {
+	start := p.Position
+	if !strings.HasPrefix(p.Target[start:], ATOM_BYTES) {
+		return object.Obj{}, &ParseError{Position: p.span(start, start+1), Message: "expected #x to start a bytes literal"}
+	}
+	p.Position += len(ATOM_BYTES)
+
+	digitsStart := p.Position
+	for p.Position < len(p.Target) &&
+		!isWhitespace(p.Target[p.Position]) &&
+		p.Target[p.Position] != ')' &&
+		p.Target[p.Position] != '(' &&
+		p.Target[p.Position] != '}' &&
+		p.Target[p.Position] != '{' {
+		p.Position++
+	}
+
+	data, err := hex.DecodeString(p.Target[digitsStart:p.Position])
+	if err != nil {
+		return object.Obj{}, &ParseError{Position: p.span(start, p.Position), Message: fmt.Sprintf("invalid bytes literal: %s", err)}
+	}
+	return object.Obj{Type: object.OBJ_TYPE_BYTES, D: object.Bytes(data), Pos: p.span(start, p.Position)}, nil
+}
+
+// parseQuasi reads a quasiquote template (`x), or one of the parts inside it
+// that are filled in when it is evaluated: an unquote (,x) or a splice (,@x)
+func (p *Parser) parseQuasi() (object.Obj, error) {
+	start := p.Position
+	objType := object.OBJ_TYPE_QUASI
+	if p.Target[p.Position] == ',' {
+		objType = object.OBJ_TYPE_UNQUOTE
+		if p.Position+1 < len(p.Target) && p.Target[p.Position+1] == '@' {
+			objType = object.OBJ_TYPE_SPLICE
+			p.Position++
+		}
+	}
+	p.Position++
+
+	inner, err := p.Parse()
+	if err != nil {
+		return object.Obj{}, err
+	}
+	return object.Obj{Type: objType, D: inner, Pos: p.span(start, p.Position)}, nil
 }
 
 func (p *Parser) parseSome() (object.Obj, error) {
@@ -196,21 +408,24 @@ func (p *Parser) parseSome() (object.Obj, error) {
 	for p.Position < len(p.Target) &&
 		!isWhitespace(p.Target[p.Position]) &&
 		p.Target[p.Position] != ')' &&
-		p.Target[p.Position] != '(' {
+		p.Target[p.Position] != '(' &&
+		p.Target[p.Position] != '}' &&
+		p.Target[p.Position] != '{' {
 		p.Position++
 	}
 
 	value := p.Target[start:p.Position]
 
 	if value == "" {
-		return object.Obj{}, &ParseError{Position: start, Message: "empty identifier"}
+		return object.Obj{}, &ParseError{Position: p.span(start, start), Message: "empty identifier"}
 	}
 
-	if numObj, ok := parseNumber(value, uint16(start)); ok {
+	pos := p.span(start, p.Position)
+	if numObj, ok := parseNumber(value, pos); ok {
 		return numObj, nil
 	}
 
-	return object.Obj{Type: object.OBJ_TYPE_IDENTIFIER, D: object.Identifier(value), Pos: uint16(start)}, nil
+	return object.Obj{Type: object.OBJ_TYPE_IDENTIFIER, D: object.Identifier(value), Pos: pos}, nil
 }
 
 func (p *Parser) parseQuotedString() (object.Obj, error) {
@@ -228,42 +443,40 @@ func (p *Parser) parseQuotedString() (object.Obj, error) {
 				value := p.Target[start:p.Position]
 				p.Position++
 				unescaped := unescapeString(value)
-				return object.Obj{Type: object.OBJ_TYPE_STRING, D: unescaped, Pos: uint16(stringStart)}, nil
+				return object.Obj{Type: object.OBJ_TYPE_STRING, D: unescaped, Pos: p.span(stringStart, p.Position)}, nil
 			}
 		}
 		p.Position++
 	}
 
-	return object.Obj{}, &ParseError{Position: stringStart, Message: "unclosed quoted string"}
+	return object.Obj{}, &ParseError{Position: p.span(stringStart, stringStart+1), Message: "unclosed quoted string"}
 }
 
 func unescapeString(s string) string {
-	result := ""
+	// built a byte at a time so that text outside ASCII comes through as the
+	// same UTF-8 it was written in
+	var result strings.Builder
 	for i := 0; i < len(s); i++ {
 		if s[i] == '\\' && i+1 < len(s) {
 			switch s[i+1] {
 			case 'n':
-				result += "\n"
+				result.WriteByte('\n')
 			case 't':
-				result += "\t"
+				result.WriteByte('\t')
 			case 'r':
-				result += "\r"
-			case '"':
-				result += "\""
-			case '\\':
-				result += "\\"
+				result.WriteByte('\r')
 			default:
-				result += string(s[i+1])
+				result.WriteByte(s[i+1])
 			}
 			i++
 		} else {
-			result += string(s[i])
+			result.WriteByte(s[i])
 		}
 	}
-	return result
+	return result.String()
 }
 
-func parseNumber(s string, pos uint16) (object.Obj, bool) {
+func parseNumber(s string, pos object.Span) (object.Obj, bool) {
 	if s == "" {
 		return object.Obj{}, false
 	}
@@ -285,12 +498,22 @@ func parseNumber(s string, pos uint16) (object.Obj, bool) {
 	}
 
 	num, err := parseInt(s)
+	if errors.Is(err, errIntegerOverflow) {
+		// too large for an int64, so it's a bigint. parseInt has already
+		// checked the digits
+		n, _ := new(big.Int).SetString(s, 10)
+		obj := object.IntegerFromBig(n)
+		obj.Pos = pos
+		return obj, true
+	}
 	if err != nil {
 		return object.Obj{}, false
 	}
 	return object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(num), Pos: pos}, true
 }
 
+var errIntegerOverflow = errors.New("integer overflows int64")
+
 func parseInt(s string) (int64, error) {
 	if s == "" {
 		return 0, fmt.Errorf("empty string")
@@ -309,11 +532,19 @@ func parseInt(s string) (int64, error) {
 	}
 
 	var result int64
+	overflow := false
 	for i := 0; i < len(s); i++ {
 		if s[i] < '0' || s[i] > '9' {
 			return 0, fmt.Errorf("invalid character at position %d", i)
 		}
-		result = result*10 + int64(s[i]-'0')
+		digit := int64(s[i] - '0')
+		if result > (math.MaxInt64-digit)/10 {
+			overflow = true
+		}
+		result = result*10 + digit
+	}
+	if overflow {
+		return 0, errIntegerOverflow
 	}
 
 	if negative {
@@ -369,17 +600,31 @@ func parseFloat(s string) (float64, error) {
 	return result, nil
 }
 
+// parseErrorLiteral reads @(...), or @code(...) for an error with a code. The
+// items of the list make up the message, except that a trailing error literal
+// is the cause and a map just before it (or last) is the data
 func (p *Parser) parseErrorLiteral() (object.Obj, error) {
 	errorPos := p.Position
 	p.Position++
+
+	codeStart := p.Position
+	for p.Position < len(p.Target) &&
+		!isWhitespace(p.Target[p.Position]) &&
+		!strings.ContainsRune("(){}\"'", rune(p.Target[p.Position])) {
+		p.Position++
+	}
+	code := p.Target[codeStart:p.Position]
+	if code != "" && (p.Position >= len(p.Target) || p.Target[p.Position] != '(') {
+		return object.Obj{}, &ParseError{Position: p.span(errorPos, p.Position), Message: "expected '(' right after @" + code}
+	}
 	p.skipWhitespace()
 
 	if p.Position >= len(p.Target) {
-		return object.Obj{}, &ParseError{Position: errorPos, Message: "expected list after @"}
+		return object.Obj{}, &ParseError{Position: p.span(errorPos, errorPos+1), Message: "expected list after @"}
 	}
 
 	if p.Target[p.Position] != '(' {
-		return object.Obj{}, &ParseError{Position: errorPos, Message: "expected '(' after @"}
+		return object.Obj{}, &ParseError{Position: p.span(errorPos, errorPos+1), Message: "expected '(' after @"}
 	}
 
 	listObj, err := p.parseList()
@@ -388,25 +633,38 @@ func (p *Parser) parseErrorLiteral() (object.Obj, error) {
 	}
 
 	if listObj.Type != object.OBJ_TYPE_LIST {
-		return object.Obj{}, &ParseError{Position: errorPos, Message: "expected list after @"}
+		return object.Obj{}, &ParseError{Position: p.span(errorPos, errorPos+1), Message: "expected list after @"}
+	}
+
+	errData := object.Error{
+		File:     object.SourceName(p.Source),
+		Position: p.span(errorPos, p.Position),
+		Code:     code,
 	}
 
 	list := listObj.D.(object.List)
-	message := ""
+	if n := len(list); n > 0 && list[n-1].Type == object.OBJ_TYPE_ERROR {
+		cause := list[n-1].D.(object.Error)
+		errData.Cause = &cause
+		list = list[:n-1]
+	}
+	if n := len(list); n > 0 && list[n-1].Type == object.OBJ_TYPE_MAP {
+		data := list[n-1]
+		errData.Data = &data
+		list = list[:n-1]
+	}
+
 	for i, item := range list {
 		if i > 0 {
-			message += " "
+			errData.Message += " "
 		}
-		message += item.Encode()
+		errData.Message += item.Encode()
 	}
 
 	return object.Obj{
 		Type: object.OBJ_TYPE_ERROR,
-		D: object.Error{
-			Position: errorPos,
-			Message:  message,
-		},
-		Pos: uint16(errorPos),
+		D:    errData,
+		Pos:  p.span(errorPos, p.Position),
 	}, nil
 }
 
@@ -416,11 +674,11 @@ func (p *Parser) parseMacroDefinition() (object.Obj, error) {
 	p.skipWhitespace()
 
 	if p.Position >= len(p.Target) {
-		return object.Obj{}, &ParseError{Position: macroPos, Message: "expected pattern after $"}
+		return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: "expected pattern after $"}
 	}
 
 	if p.Target[p.Position] != '(' {
-		return object.Obj{}, &ParseError{Position: macroPos, Message: "expected '(' after $"}
+		return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: "expected '(' after $"}
 	}
 
 	patternObj, err := p.parseList()
@@ -429,33 +687,49 @@ func (p *Parser) parseMacroDefinition() (object.Obj, error) {
 	}
 
 	if patternObj.Type != object.OBJ_TYPE_LIST {
-		return object.Obj{}, &ParseError{Position: macroPos, Message: "expected pattern list after $"}
+		return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: "expected pattern list after $"}
 	}
 
 	pattern := patternObj.D.(object.List)
 	if len(pattern) == 0 {
-		return object.Obj{}, &ParseError{Position: macroPos, Message: "macro pattern cannot be empty"}
+		return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: "macro pattern cannot be empty"}
 	}
 
 	if pattern[0].Type != object.OBJ_TYPE_IDENTIFIER {
-		return object.Obj{}, &ParseError{Position: macroPos, Message: "macro name must be identifier"}
+		return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: "macro name must be identifier"}
 	}
 
 	macroName := string(pattern[0].D.(object.Identifier))
+	if macroName == macroImport || macroName == macroExport {
+		return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: fmt.Sprintf("macro name $%s is reserved", macroName)}
+	}
 
 	var params []string
+	rest := false
 	for i := 1; i < len(pattern); i++ {
 		if pattern[i].Type != object.OBJ_TYPE_IDENTIFIER {
-			return object.Obj{}, &ParseError{Position: macroPos, Message: "macro parameter must be identifier"}
+			return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: "macro parameter must be identifier"}
 		}
 		paramName := string(pattern[i].D.(object.Identifier))
 		if len(paramName) == 0 || paramName[0] != '?' {
-			return object.Obj{}, &ParseError{Position: macroPos, Message: "macro parameter must start with ?"}
+			return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: "macro parameter must start with ?"}
+		}
+		if rest {
+			return object.Obj{}, &ParseError{Position: p.span(macroPos, macroPos+1), Message: "macro rest parameter must come last"}
+		}
+		if name, ok := strings.CutSuffix(paramName, restSuffix); ok {
+			rest = true
+			paramName = name
 		}
 		params = append(params, paramName)
 	}
 
+	// the macro calls in the template are expanded now, with the macros
+	// defined so far, so redefining one later does not change this macro
+	noExpand := p.NoExpand
+	p.NoExpand = false
 	template, err := p.Parse()
+	p.NoExpand = noExpand
 	if err != nil {
 		return object.Obj{}, err
 	}
@@ -463,82 +737,308 @@ func (p *Parser) parseMacroDefinition() (object.Obj, error) {
 	p.Macros[macroName] = &MacroDef{
 		Name:       macroName,
 		Parameters: params,
+		Rest:       rest,
 		Template:   template,
+		Pos:        p.span(macroPos, p.Position),
+	}
+	if !slices.Contains(p.defined, macroName) {
+		p.defined = append(p.defined, macroName)
 	}
 
-	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: uint16(macroPos)}, nil
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: p.span(macroPos, p.Position)}, nil
 }
 
 func (p *Parser) expandMacroIfNeeded(listObj object.Obj) (object.Obj, error) {
-	if listObj.Type != object.OBJ_TYPE_LIST {
-		return listObj, nil
+	return p.expandList(listObj, p.NoExpand)
+}
+
+// macroCallName returns the name of the macro obj calls, if it is a call
+func macroCallName(obj object.Obj) (string, bool) {
+	if obj.Type != object.OBJ_TYPE_LIST {
+		return "", false
 	}
+	list := obj.D.(object.List)
+	if len(list) == 0 || list[0].Type != object.OBJ_TYPE_IDENTIFIER {
+		return "", false
+	}
+	name := string(list[0].D.(object.Identifier))
+	if len(name) < 2 || name[0] != '$' {
+		return "", false
+	}
+	return name[1:], true
+}
 
-	list := listObj.D.(object.List)
-	if len(list) == 0 {
+// expandList expands listObj, whose items have been expanded already, when it
+// is a macro call. With directivesOnly, only $import and $export are run
+func (p *Parser) expandList(listObj object.Obj, directivesOnly bool) (object.Obj, error) {
+	macroName, ok := macroCallName(listObj)
+	if !ok {
 		return listObj, nil
 	}
 
-	if list[0].Type != object.OBJ_TYPE_IDENTIFIER {
+	switch macroName {
+	case macroImport:
+		return p.importMacros(listObj)
+	case macroExport:
+		return p.exportMacros(listObj)
+	}
+	if directivesOnly {
 		return listObj, nil
 	}
 
-	macroCallName := string(list[0].D.(object.Identifier))
-	if len(macroCallName) == 0 || macroCallName[0] != '$' {
-		return listObj, nil
+	expanded, err := p.applyMacro(listObj)
+	if err != nil {
+		return object.Obj{}, err
 	}
 
-	macroName := macroCallName[1:]
+	// the template's own calls were expanded when it was defined, so only
+	// the expansion as a whole can have become another call
+	p.depth++
+	defer func() { p.depth-- }()
+	return p.expandList(expanded, false)
+}
+
+// applyMacro substitutes the arguments of the call listObj into the template
+// of the macro it calls, leaving a macro call that results as it is
+func (p *Parser) applyMacro(listObj object.Obj) (object.Obj, error) {
+	list := listObj.D.(object.List)
+	macroName, _ := macroCallName(listObj)
+
 	macroDef, exists := p.Macros[macroName]
 	if !exists {
-		return object.Obj{}, &ParseError{Position: int(list[0].Pos), Message: fmt.Sprintf("undefined macro $%s", macroName)}
+		return object.Obj{}, &ParseError{Position: list[0].Pos, Message: fmt.Sprintf("undefined macro $%s", macroName)}
+	}
+	if p.depth >= maxExpansionDepth {
+		return object.Obj{}, &ParseError{Position: list[0].Pos, Message: fmt.Sprintf("macro $%s: expansion nested more than %d deep", macroName, maxExpansionDepth)}
 	}
 
-	if len(list)-1 != len(macroDef.Parameters) {
-		return object.Obj{}, &ParseError{Position: int(list[0].Pos), Message: fmt.Sprintf("macro $%s expects %d arguments, got %d", macroName, len(macroDef.Parameters), len(list)-1)}
+	args := list[1:]
+	if macroDef.Rest {
+		if len(args) < len(macroDef.Parameters)-1 {
+			return object.Obj{}, &ParseError{Position: list[0].Pos, Message: fmt.Sprintf("macro $%s expects at least %d arguments, got %d", macroName, len(macroDef.Parameters)-1, len(args))}
+		}
+	} else if len(args) != len(macroDef.Parameters) {
+		return object.Obj{}, &ParseError{Position: list[0].Pos, Message: fmt.Sprintf("macro $%s expects %d arguments, got %d", macroName, len(macroDef.Parameters), len(args))}
 	}
 
-	bindings := make(map[string]object.Obj)
+	expansion := &macroExpansion{
+		bindings: make(map[string]object.Obj),
+		gensyms:  make(map[string]object.Identifier),
+	}
 	for i, param := range macroDef.Parameters {
-		bindings[param] = list[i+1]
+		if macroDef.Rest && i == len(macroDef.Parameters)-1 {
+			expansion.rest = param
+			expansion.bindings[param] = object.Obj{Type: object.OBJ_TYPE_LIST, D: slices.Clone(args[i:]), Pos: listObj.Pos}
+			break
+		}
+		expansion.bindings[param] = args[i]
+	}
+
+	expanded := p.substituteInTemplate(macroDef.Template, expansion)
+	if p.Trace != nil {
+		p.Trace(MacroExpansion{Macro: macroDef, Call: listObj, Result: expanded, Depth: p.depth})
 	}
+	return expanded, nil
+}
 
-	expanded := p.substituteInTemplate(macroDef.Template, bindings)
+// expandAll expands every macro call in obj, innermost first, as parsing obj
+// would have
+func (p *Parser) expandAll(obj object.Obj) (object.Obj, error) {
+	switch obj.Type {
+	case object.OBJ_TYPE_LIST:
+		list := obj.D.(object.List)
+		items := make(object.List, len(list))
+		for i, item := range list {
+			expanded, err := p.expandAll(item)
+			if err != nil {
+				return object.Obj{}, err
+			}
+			items[i] = expanded
+		}
+		return p.expandList(object.Obj{Type: object.OBJ_TYPE_LIST, D: items, Pos: obj.Pos}, false)
 
-	if expanded.Type == object.OBJ_TYPE_LIST {
-		return p.expandMacroIfNeeded(expanded)
+	case object.OBJ_TYPE_SOME, object.OBJ_TYPE_QUASI, object.OBJ_TYPE_UNQUOTE, object.OBJ_TYPE_SPLICE:
+		expanded, err := p.expandAll(obj.D.(object.Obj))
+		if err != nil {
+			return object.Obj{}, err
+		}
+		return object.Obj{Type: obj.Type, D: expanded, Pos: obj.Pos}, nil
+
+	case object.OBJ_TYPE_MAP:
+		newMap := object.NewMap()
+		for _, entry := range obj.D.(*object.Map).Entries() {
+			expanded, err := p.expandAll(entry.Value)
+			if err != nil {
+				return object.Obj{}, err
+			}
+			newMap.Set(entry.Key, expanded)
+		}
+		return object.Obj{Type: object.OBJ_TYPE_MAP, D: newMap, Pos: obj.Pos}, nil
+
+	default:
+		return obj, nil
 	}
+}
 
-	return expanded, nil
+// Expand expands every macro call in form (parsed with NoExpand) with the
+// parser's macros, as parsing it without NoExpand would have
+func (p *Parser) Expand(form object.Obj) (object.Obj, error) {
+	return p.expandAll(form)
+}
+
+// Expand1 applies the macro form calls once, leaving a call that it expands to
+// alone. expanded is false when form is not a macro call
+func (p *Parser) Expand1(form object.Obj) (result object.Obj, expanded bool, err error) {
+	macroName, ok := macroCallName(form)
+	if !ok || macroName == macroImport || macroName == macroExport {
+		return form, false, nil
+	}
+	result, err = p.applyMacro(form)
+	if err != nil {
+		return object.Obj{}, false, err
+	}
+	return result, true, nil
+}
+
+// macroExpansion is a single use of a macro: the arguments its parameters are
+// bound to, and the names its gensyms were given this time
+type macroExpansion struct {
+	bindings map[string]object.Obj
+	rest     string
+	gensyms  map[string]object.Identifier
 }
 
-func (p *Parser) substituteInTemplate(template object.Obj, bindings map[string]object.Obj) object.Obj {
+// gensymCounter numbers gensyms across every parser, so that macros imported
+// into one file never reuse a name another expansion has made
+var gensymCounter atomic.Uint64
+
+// gensym returns the name an identifier of the template is given in this
+// expansion, and whether it is a gensym at all. A gensym ends in # (tmp#), or
+// in # and a number when it was made by a macro expanded inside the template
+func (x *macroExpansion) gensym(name string) (object.Identifier, bool) {
+	hash := strings.LastIndexByte(name, '#')
+	if hash <= 0 || name[0] == '?' || strings.Trim(name[hash+1:], "0123456789") != "" {
+		return "", false
+	}
+	if renamed, ok := x.gensyms[name]; ok {
+		return renamed, true
+	}
+	renamed := object.Identifier(fmt.Sprintf("%s#%d", name[:hash], gensymCounter.Add(1)))
+	x.gensyms[name] = renamed
+	return renamed, true
+}
+
+func (p *Parser) substituteInTemplate(template object.Obj, expansion *macroExpansion) object.Obj {
 	switch template.Type {
 	case object.OBJ_TYPE_IDENTIFIER:
 		paramName := string(template.D.(object.Identifier))
-		if replacement, exists := bindings[paramName]; exists {
+		if expansion.rest != "" && paramName == expansion.rest+restSuffix {
+			paramName = expansion.rest
+		}
+		if replacement, exists := expansion.bindings[paramName]; exists {
 			return replacement.DeepCopy()
 		}
+		if renamed, ok := expansion.gensym(paramName); ok {
+			return object.Obj{Type: object.OBJ_TYPE_IDENTIFIER, D: renamed, Pos: template.Pos}
+		}
 		return template
 
 	case object.OBJ_TYPE_LIST:
 		list := template.D.(object.List)
-		newList := make(object.List, len(list))
-		for i, item := range list {
-			newList[i] = p.substituteInTemplate(item, bindings)
+		newList := make(object.List, 0, len(list))
+		for _, item := range list {
+			if expansion.rest != "" && item.Type == object.OBJ_TYPE_IDENTIFIER &&
+				string(item.D.(object.Identifier)) == expansion.rest+restSuffix {
+				for _, arg := range expansion.bindings[expansion.rest].D.(object.List) {
+					newList = append(newList, arg.DeepCopy())
+				}
+				continue
+			}
+			newList = append(newList, p.substituteInTemplate(item, expansion))
 		}
 		return object.Obj{Type: object.OBJ_TYPE_LIST, D: newList, Pos: template.Pos}
 
 	case object.OBJ_TYPE_SOME:
 		inner := template.D.(object.Some)
-		substituted := p.substituteInTemplate(inner, bindings)
+		substituted := p.substituteInTemplate(inner, expansion)
 		return object.Obj{Type: object.OBJ_TYPE_SOME, D: object.Some(substituted), Pos: template.Pos}
 
+	case object.OBJ_TYPE_QUASI, object.OBJ_TYPE_UNQUOTE, object.OBJ_TYPE_SPLICE:
+		substituted := p.substituteInTemplate(template.D.(object.Obj), expansion)
+		return object.Obj{Type: template.Type, D: substituted, Pos: template.Pos}
+
+	case object.OBJ_TYPE_MAP:
+		newMap := object.NewMap()
+		for _, entry := range template.D.(*object.Map).Entries() {
+			key := p.substituteInTemplate(entry.Key, expansion)
+			if !object.IsMapKey(key) {
+				key = entry.Key
+			}
+			newMap.Set(key, p.substituteInTemplate(entry.Value, expansion))
+		}
+		return object.Obj{Type: object.OBJ_TYPE_MAP, D: newMap, Pos: template.Pos}
+
 	default:
 		return template
 	}
 }
 
+// importMacros handles ($import "path"), which adds the macros the file at
+// path exports to this parser's table
+func (p *Parser) importMacros(listObj object.Obj) (object.Obj, error) {
+	list := listObj.D.(object.List)
+	if len(list) != 2 || list[1].Type != object.OBJ_TYPE_STRING {
+		return object.Obj{}, &ParseError{Position: listObj.Pos, Message: "$import takes the path of a file as a string"}
+	}
+	if p.MacroLoader == nil {
+		return object.Obj{}, &ParseError{Position: listObj.Pos, Message: "$import: macros cannot be imported here"}
+	}
+
+	macros, err := p.MacroLoader(list[1].D.(string))
+	if err != nil {
+		return object.Obj{}, &ParseError{Position: listObj.Pos, Message: fmt.Sprintf("$import: %v", err)}
+	}
+	maps.Copy(p.Macros, macros)
+
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: listObj.Pos}, nil
+}
+
+// exportMacros handles ($export name ...), which names the macros a file
+// offers to the files that import it
+func (p *Parser) exportMacros(listObj object.Obj) (object.Obj, error) {
+	p.exportDeclared = true
+	for _, arg := range listObj.D.(object.List)[1:] {
+		if arg.Type != object.OBJ_TYPE_IDENTIFIER {
+			return object.Obj{}, &ParseError{Position: arg.Pos, Message: fmt.Sprintf("$export takes macro names, got %s", arg.Type)}
+		}
+		name := strings.TrimPrefix(string(arg.D.(object.Identifier)), "$")
+		if !slices.Contains(p.exports, name) {
+			p.exports = append(p.exports, name)
+		}
+	}
+	return object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}, Pos: listObj.Pos}, nil
+}
+
+// ExportedMacros is the macro table a file that imports this one gets: the
+// macros named by $export, or, with no $export at all, every macro defined
+// here (not those imported from elsewhere). Call it once parsing is done
+func (p *Parser) ExportedMacros() (map[string]*MacroDef, error) {
+	names := p.defined
+	if p.exportDeclared {
+		names = p.exports
+	}
+
+	exported := make(map[string]*MacroDef, len(names))
+	for _, name := range names {
+		macroDef, ok := p.Macros[name]
+		if !ok {
+			return nil, fmt.Errorf("macro $%s is exported but never defined", name)
+		}
+		exported[name] = macroDef
+	}
+	return exported, nil
+}
+
 func isWhitespace(ch byte) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
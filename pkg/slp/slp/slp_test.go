@@ -1,6 +1,7 @@
 package slp
 
 import (
+	"math/big"
 	"testing"
 
 	"github.com/bosley/slpx/pkg/slp/object"
@@ -80,6 +81,51 @@ func TestDeepCopy(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:     "OBJ_TYPE_BYTES",
+			original: object.Obj{Type: object.OBJ_TYPE_BYTES, D: object.Bytes{1, 2, 3}},
+			modify: func(o *object.Obj) {
+				o.D.(object.Bytes)[0] = 9
+			},
+			check: func(t *testing.T, original, copied object.Obj) {
+				if copied.D.(object.Bytes)[0] != 1 {
+					t.Error("Bytes deep copy failed: original modification affected copy")
+				}
+			},
+		},
+		{
+			name:     "OBJ_TYPE_BIGINT",
+			original: object.Obj{Type: object.OBJ_TYPE_BIGINT, D: new(big.Int).Lsh(big.NewInt(1), 100)},
+			modify: func(o *object.Obj) {
+				o.D.(*big.Int).SetInt64(0)
+			},
+			check: func(t *testing.T, original, copied object.Obj) {
+				if copied.D.(*big.Int).Sign() == 0 {
+					t.Error("BigInt deep copy failed: original modification affected copy")
+				}
+			},
+		},
+		{
+			name: "OBJ_TYPE_MAP",
+			original: func() object.Obj {
+				m := object.NewMap()
+				m.Set(object.Obj{Type: object.OBJ_TYPE_STRING, D: "key"}, object.Obj{Type: object.OBJ_TYPE_LIST, D: object.List{
+					object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(1)},
+				}})
+				return object.Obj{Type: object.OBJ_TYPE_MAP, D: m}
+			}(),
+			modify: func(o *object.Obj) {
+				m := o.D.(*object.Map)
+				value, _ := m.Get(object.Obj{Type: object.OBJ_TYPE_STRING, D: "key"})
+				value.D.(object.List)[0] = object.Obj{Type: object.OBJ_TYPE_INTEGER, D: object.Integer(2)}
+				m.Set(object.Obj{Type: object.OBJ_TYPE_STRING, D: "added"}, object.Obj{Type: object.OBJ_TYPE_NONE, D: object.None{}})
+			},
+			check: func(t *testing.T, original, copied object.Obj) {
+				if copied.Encode() != `{"key" (1)}` {
+					t.Errorf("Map deep copy failed: original modification affected copy: %s", copied.Encode())
+				}
+			},
+		},
 		{
 			name:     "OBJ_TYPE_SOME",
 			original: object.Obj{Type: object.OBJ_TYPE_SOME, D: object.Obj{Type: object.OBJ_TYPE_STRING, D: "nested"}},
@@ -1,6 +1,7 @@
 package slpxcfg
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -55,6 +56,7 @@ Only the specified variables are extracted and returned in the result map.
 
 var (
 	ErrTimeout = errors.New("config evaluation timed out")
+	ErrExited  = errors.New("config called exit")
 )
 
 type Variable struct {
@@ -70,6 +72,7 @@ type evalResult struct {
 
 type Loader interface {
 	Load(file string, variables []Variable) (map[object.Identifier]object.Obj, error)
+	LoadInto(file string, target any) error
 }
 
 type loaderImpl struct {
@@ -92,6 +95,14 @@ func (l *loaderImpl) Load(file string, variables []Variable) (map[object.Identif
 	return loadFile(l.logger, file, l.maxTimeout, variables, l.fs, l.io)
 }
 
+func (l *loaderImpl) LoadInto(file string, target any) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return LoadFromContentInto(l.logger, file, string(content), l.maxTimeout, target, l.fs, l.io)
+}
+
 func Load(logger *slog.Logger, file string, variables []Variable, timeout time.Duration) (map[object.Identifier]object.Obj, error) {
 	fs := env.DefaultFS()
 	io := env.DefaultIO()
@@ -109,14 +120,89 @@ func loadFile(logger *slog.Logger, file string, timeout time.Duration, variables
 }
 
 func LoadFromContent(logger *slog.Logger, file string, content string, timeout time.Duration, variables []Variable, fs env.FS, io env.IO) (map[object.Identifier]object.Obj, error) {
+	mem, err := evaluate(logger, file, content, timeout, fs, io)
+	if err != nil {
+		return nil, err
+	}
+
+	resultMap := make(map[object.Identifier]object.Obj)
+
+	for _, variable := range variables {
+		obj, err := mem.Get(variable.Identifier, true)
+		if err != nil {
+			if variable.Required {
+				return nil, fmt.Errorf("required variable '%s' not found in config", variable.Identifier)
+			}
+			continue
+		}
+
+		if variable.Type != object.OBJ_TYPE_ANY && obj.Type != variable.Type {
+			return nil, fmt.Errorf("type mismatch for variable '%s': expected %s, got %s", variable.Identifier, variable.Type, obj.Type)
+		}
+
+		resultMap[variable.Identifier] = obj
+	}
+
+	return resultMap, nil
+}
+
+/*
+LoadInto is Load for a struct (or anything else object.Unmarshal fills from
+pairs): every variable the config sets is offered to target as a (name value)
+pair, so fields are matched by their `slpx` tags and converted to their Go
+types. Tag a field "required" to have a config that leaves it out refused.
+
+	var cfg struct {
+		AppName string `slpx:"app_name,required"`
+		Port    uint16 `slpx:"port,required"`
+		Debug   bool   `slpx:"debug_mode"`
+	}
+	err := slpxcfg.LoadInto(logger, "config.slpx", &cfg, 10*time.Second)
+*/
+func LoadInto(logger *slog.Logger, file string, target any, timeout time.Duration) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return LoadFromContentInto(logger, file, string(content), timeout, target, env.DefaultFS(), env.DefaultIO())
+}
+
+func LoadFromContentInto(logger *slog.Logger, file string, content string, timeout time.Duration, target any, fs env.FS, io env.IO) error {
+	mem, err := evaluate(logger, file, content, timeout, fs, io)
+	if err != nil {
+		return err
+	}
+
+	bindings := make(object.List, 0, mem.Len())
+	for ident, obj := range mem.GetAll() {
+		bindings = append(bindings, object.Obj{
+			Type: object.OBJ_TYPE_LIST,
+			D:    object.List{{Type: object.OBJ_TYPE_IDENTIFIER, D: ident}, obj},
+		})
+	}
+
+	if err := object.Unmarshal(object.Obj{Type: object.OBJ_TYPE_LIST, D: bindings}, target); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// evaluate runs a config, returning the MEM it leaves behind
+func evaluate(logger *slog.Logger, file string, content string, timeout time.Duration, fs env.FS, io env.IO) (env.MEM, error) {
 	session := repl.NewSessionBuilder(logger).
 		WithFS(fs).
 		WithIO(io).
 		Build(file)
 
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// The evaluation still runs on its own goroutine so that a config blocked
+	// outside of the evaluator (reading stdin, etc.) can't hold us past the
+	// deadline - but the cancelled context is what actually stops it
 	resultChan := make(chan evalResult, 1)
 	go func() {
-		result, err := session.Evaluate(string(content))
+		result, err := session.EvaluateContext(ctx, string(content))
 		resultChan <- evalResult{result, err}
 	}()
 
@@ -127,18 +213,25 @@ func LoadFromContent(logger *slog.Logger, file string, content string, timeout t
 	case res := <-resultChan:
 		result = res.result
 		err = res.err
-	case <-time.After(timeout):
+	case <-ctx.Done():
 		return nil, ErrTimeout
 	}
 
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrTimeout
+	}
+
+	if _, exited := env.ExitCode(err); exited {
+		return nil, fmt.Errorf("%w: %w", ErrExited, err)
+	}
+
 	if err != nil {
 		if parseErr, ok := err.(*slp.ParseError); ok {
-			line, col, lineStart, lineEnd := positionToLineCol(string(content), parseErr.Position)
+			line, col := parseErr.Position.Line, parseErr.Position.Column
 			var errMsg strings.Builder
 			errMsg.WriteString(fmt.Sprintf("Parse error in %s at line %d, column %d:\n", file, line, col))
 
-			if lineStart < len(content) && lineEnd <= len(content) {
-				lineContent := string(content[lineStart:lineEnd])
+			if lineContent, ok := object.SourceLine(string(content), line); ok {
 				errMsg.WriteString(fmt.Sprintf("  %d | %s\n", line, lineContent))
 				errMsg.WriteString("      ")
 				for i := 1; i < col; i++ {
@@ -154,70 +247,36 @@ func LoadFromContent(logger *slog.Logger, file string, content string, timeout t
 
 	if result.Type == object.OBJ_TYPE_ERROR {
 		errObj := result.D.(object.Error)
-		formatted := formatError(errObj, string(content))
+		formatted := formatError(errObj, string(content), session.GetFS())
 		return nil, fmt.Errorf("evaluation error:\n%s", formatted)
 	}
 
-	mem := session.GetMEM()
-
-	resultMap := make(map[object.Identifier]object.Obj)
-
-	for _, variable := range variables {
-		obj, err := mem.Get(variable.Identifier, true)
-		if err != nil {
-			if variable.Required {
-				return nil, fmt.Errorf("required variable '%s' not found in config", variable.Identifier)
-			}
-			continue
-		}
-
-		if variable.Type != object.OBJ_TYPE_ANY && obj.Type != variable.Type {
-			return nil, fmt.Errorf("type mismatch for variable '%s': expected %s, got %s", variable.Identifier, variable.Type, obj.Type)
-		}
-
-		resultMap[variable.Identifier] = obj
-	}
-
-	return resultMap, nil
+	return session.GetMEM(), nil
 }
 
-func positionToLineCol(content string, position int) (line int, col int, lineStart int, lineEnd int) {
-	line = 1
-	col = 1
-	lineStart = 0
-
-	for i := 0; i < len(content) && i < position; i++ {
-		if content[i] == '\n' {
-			line++
-			col = 1
-			lineStart = i + 1
-		} else {
-			col++
-		}
-	}
-
-	lineEnd = lineStart
-	for lineEnd < len(content) && content[lineEnd] != '\n' {
-		lineEnd++
-	}
-
-	return line, col, lineStart, lineEnd
-}
-
-func formatError(err object.Error, sourceContent string) string {
+// formatError shows the line err points at, read through fs so that a file
+// the session found in a bundle or an overlay is shown as it was run
+func formatError(err object.Error, sourceContent string, fs env.FS) string {
 	var output strings.Builder
 
 	if err.File != "" {
-		if err.Position == 0 {
+		if err.Position.IsZero() {
 			output.WriteString(fmt.Sprintf("Error in %s:\n", err.File))
-			output.WriteString(err.Message)
+			output.WriteString(err.Summary())
 		} else {
-			line, col, lineStart, lineEnd := positionToLineCol(sourceContent, err.Position)
+			// errors raised inside a file pulled in with `use` point into that
+			// file, not the one we were handed
+			if file := err.Position.File(); file != "" {
+				if content, readErr := fs.ReadFile(file); readErr == nil {
+					sourceContent = string(content)
+				}
+			}
+
+			line, col := err.Position.Line, err.Position.Column
 
 			output.WriteString(fmt.Sprintf("Error in %s at line %d, column %d:\n", err.File, line, col))
 
-			if lineStart < len(sourceContent) && lineEnd <= len(sourceContent) {
-				lineContent := sourceContent[lineStart:lineEnd]
+			if lineContent, ok := object.SourceLine(sourceContent, line); ok {
 				output.WriteString(fmt.Sprintf("  %d | %s\n", line, lineContent))
 
 				output.WriteString("      ")
@@ -227,11 +286,13 @@ func formatError(err object.Error, sourceContent string) string {
 				output.WriteString("^\n")
 			}
 
-			output.WriteString(err.Message)
+			output.WriteString(err.Summary())
 		}
 	} else {
-		output.WriteString(fmt.Sprintf("Error: %s", err.Message))
+		output.WriteString(fmt.Sprintf("Error: %s", err.Summary()))
 	}
 
+	output.WriteString(object.FormatBacktrace(err.Trace))
+
 	return output.String()
 }
@@ -1,12 +1,16 @@
 package slpxcfg
 
 import (
+	"errors"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bosley/slpx/pkg/slp/env"
 	"github.com/bosley/slpx/pkg/slp/object"
 )
 
@@ -445,3 +449,251 @@ func TestLoad_ComplexListsAndFunctions(t *testing.T) {
 		t.Errorf("mixed_list wrong type: expected %s, got %s", object.OBJ_TYPE_LIST, obj.Type)
 	}
 }
+
+type countingWriter struct {
+	writes atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return len(p), nil
+}
+
+func TestLoad_TimeoutStopsEvaluation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	configContent := `
+(set items (list/new 1000 0))
+(list/iter items (fn (a :I) :I
+    (list/iter items (fn (b :I) :I
+        (list/iter items (fn (c :I) :I
+            (do (io/out ".") 1)))))))
+`
+
+	writer := &countingWriter{}
+	io := env.DefaultIO()
+	io.SetStdout(writer)
+
+	_, err := LoadFromContent(logger, "config.slpx", configContent, 100*time.Millisecond, []Variable{}, env.DefaultFS(), io)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected ErrTimeout, got %v", err)
+	}
+
+	// give the evaluation a moment to observe the cancellation, after which
+	// it must not make any further progress
+	time.Sleep(50 * time.Millisecond)
+	stoppedAt := writer.writes.Load()
+	time.Sleep(100 * time.Millisecond)
+	if after := writer.writes.Load(); after != stoppedAt {
+		t.Fatalf("Evaluation kept running after timeout: %d writes became %d", stoppedAt, after)
+	}
+}
+
+func TestLoad_ExitIsReported(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	configContent := `
+(set port 8080)
+(exit 3)
+(set port 9090)
+`
+
+	_, err := LoadFromContent(logger, "config.slpx", configContent, 5*time.Second, []Variable{}, env.DefaultFS(), env.DefaultIO())
+	if !errors.Is(err, ErrExited) {
+		t.Fatalf("Expected ErrExited, got %v", err)
+	}
+	if code, exited := env.ExitCode(err); !exited || code != 3 {
+		t.Fatalf("Expected exit code 3, got %d (exited: %v)", code, exited)
+	}
+}
+
+func TestLoad_ErrorSnippetReadThroughFS(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// the same path holds something else on disk, which must not be shown
+	configFile := filepath.Join(t.TempDir(), "config.slpx")
+	if err := os.WriteFile(configFile, []byte("\n(set on_disk 1)\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	configContent := `
+(undefined_function "arg")
+`
+	memFS := env.NewMemoryFS()
+	if err := memFS.MkDirAll(filepath.Dir(configFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := memFS.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadFromContent(logger, configFile, configContent, 5*time.Second, []Variable{}, memFS, env.DefaultIO())
+	if err == nil {
+		t.Fatal("Expected evaluation error, got nil")
+	}
+	if !strings.Contains(err.Error(), `2 | (undefined_function "arg")`) || strings.Contains(err.Error(), "on_disk") {
+		t.Errorf("Expected the snippet from the session's FS, got %v", err)
+	}
+}
+
+type testServer struct {
+	Host string   `slpx:"host,required"`
+	Port uint16   `slpx:"port"`
+	TLS  bool     `slpx:"tls,omitempty"`
+	Tags []string `slpx:"tags,omitempty"`
+}
+
+type testAppConfig struct {
+	AppName string          `slpx:"app_name,required"`
+	Ratio   float32         `slpx:"ratio"`
+	Retries int8            `slpx:"retries"`
+	Servers []testServer    `slpx:"servers"`
+	Primary *testServer     `slpx:"primary"`
+	Backup  *testServer     `slpx:"backup"`
+	Limits  map[string]int  `slpx:"limits"`
+	Handler object.Function `slpx:"handler"`
+	Extra   any             `slpx:"extra"`
+	Ignored string          `slpx:"-"`
+	Raw     object.Obj      `slpx:"raw"`
+}
+
+func TestLoadInto_Struct(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	configFile := filepath.Join(t.TempDir(), "config.slpx")
+	configContent := `
+(set app_name "MyApp")
+(set ratio 2)
+(set retries 3.0)
+(set servers '(((host "a") (port 80) (tls 1) (tags ("x" "y"))) (("host" "b"))))
+(set primary '((host "p") (port 8080)))
+(set backup _)
+(set limits '(("steps" 100) ("depth" 10)))
+(set handler (fn () :S "handled"))
+(set extra '(1 2.5 "three"))
+(set raw 'anything)
+(set unrelated "not in the struct")
+`
+	if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg := testAppConfig{Ignored: "kept", Backup: &testServer{Host: "old"}}
+	if err := LoadInto(logger, configFile, &cfg, 5*time.Second); err != nil {
+		t.Fatalf("LoadInto failed: %v", err)
+	}
+
+	if cfg.AppName != "MyApp" || cfg.Ratio != 2 || cfg.Retries != 3 {
+		t.Errorf("scalars not loaded: %+v", cfg)
+	}
+	if len(cfg.Servers) != 2 || cfg.Servers[0].Host != "a" || cfg.Servers[0].Port != 80 || !cfg.Servers[0].TLS ||
+		len(cfg.Servers[0].Tags) != 2 || cfg.Servers[1].Host != "b" || cfg.Servers[1].Port != 0 {
+		t.Errorf("servers not loaded: %+v", cfg.Servers)
+	}
+	if cfg.Primary == nil || cfg.Primary.Port != 8080 {
+		t.Errorf("primary not loaded: %+v", cfg.Primary)
+	}
+	if cfg.Backup != nil {
+		t.Errorf("expected none to clear backup, got %+v", cfg.Backup)
+	}
+	if cfg.Limits["steps"] != 100 || cfg.Limits["depth"] != 10 {
+		t.Errorf("limits not loaded: %v", cfg.Limits)
+	}
+	if cfg.Handler.Body == nil {
+		t.Error("handler not loaded")
+	}
+	if extra, ok := cfg.Extra.([]any); !ok || len(extra) != 3 || extra[0] != int64(1) || extra[1] != 2.5 || extra[2] != "three" {
+		t.Errorf("extra not loaded: %#v", cfg.Extra)
+	}
+	if cfg.Ignored != "kept" {
+		t.Errorf("expected the ignored field to be left alone, got %q", cfg.Ignored)
+	}
+	if cfg.Raw.Type != object.OBJ_TYPE_IDENTIFIER {
+		t.Errorf("raw not loaded: %s", cfg.Raw.Encode())
+	}
+}
+
+func TestLoadInto_Errors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"required", `(set ratio 1.0)`, "app_name: required but missing"},
+		{"type", `(set app_name 1)`, "app_name: expected string, got integer"},
+		{"overflow", `(set app_name "a") (set retries 200)`, "retries: 200 does not fit in int8"},
+		{"fraction", `(set app_name "a") (set retries 1.5)`, "retries: 1.5 is not a whole number"},
+		{"nested", `(set app_name "a") (set servers '(((host "a")) ((port 1))))`, "servers[1].host: required but missing"},
+		{"map_value", `(set app_name "a") (set limits '(("steps" "many")))`, `limits["steps"]: expected integer, got string`},
+		{"not_a_pair", `(set app_name "a") (set primary '((host "p" "q")))`, "primary[0]: expected a (key value) pair"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg testAppConfig
+			err := LoadFromContentInto(logger, "config.slpx", tt.content, 5*time.Second, &cfg, env.DefaultFS(), env.DefaultIO())
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			var marshalErr *object.MarshalError
+			if !errors.As(err, &marshalErr) {
+				t.Fatalf("expected a MarshalError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected the error to mention %q, got %q", tt.message, err.Error())
+			}
+		})
+	}
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	in := testAppConfig{
+		AppName: "MyApp",
+		Ratio:   0.5,
+		Servers: []testServer{{Host: "a", Port: 80, TLS: true, Tags: []string{"x"}}, {Host: "b"}},
+		Primary: &testServer{Host: "p"},
+		Limits:  map[string]int{"steps": 100, "depth": 10},
+	}
+
+	obj, err := object.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	// omitempty leaves the second server's zero tls and tags out
+	servers := `servers ({host "a" port 80 tls 1 tags ("x")} {host "b" port 0})`
+	limits := `limits {"depth" 10 "steps" 100}`
+	for _, part := range []string{`{app_name "MyApp"`, `ratio 0.5`, servers, `backup _`, limits} {
+		if !strings.Contains(obj.Encode(), part) {
+			t.Errorf("expected %s in %s", part, obj.Encode())
+		}
+	}
+
+	var out testAppConfig
+	if err := object.Unmarshal(obj, &out); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if out.AppName != in.AppName || out.Ratio != in.Ratio || len(out.Servers) != 2 || out.Servers[0].Tags[0] != "x" ||
+		out.Primary.Host != "p" || out.Backup != nil || out.Limits["depth"] != 10 {
+		t.Errorf("round trip changed the value: %+v", out)
+	}
+
+	if _, err := object.Marshal(map[string]chan int{"c": nil}); err == nil {
+		t.Error("expected Marshal to refuse a channel")
+	}
+	if err := object.Unmarshal(obj, out); err == nil {
+		t.Error("expected Unmarshal to refuse a non-pointer")
+	}
+}
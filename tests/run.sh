@@ -16,6 +16,12 @@ TEST_DIRS=(
     "errors"
 )
 
+# every suite is run under each evaluator engine
+ENGINES=(
+    "tree"
+    "vm"
+)
+
 echo ""
 echo "${BLUE}${BOLD}╔═══════════════════════════════════════════════════╗${RESET}"
 echo "${BLUE}${BOLD}║           SLPX Test Suite Runner                 ║${RESET}"
@@ -38,34 +44,36 @@ for TEST_DIR in "${TEST_DIRS[@]}"; do
         continue
     fi
 
-    echo "${CYAN}${BOLD}📦 Running ${TEST_DIR} tests...${RESET}"
-    echo ""
-
-    START_TIME=$(gdate +%s.%N 2>/dev/null || date +%s)
-    
-    (cd "$TEST_DIR" && ../../build/slpx main.slpx)
-    EXIT_CODE=$?
-    
-    END_TIME=$(gdate +%s.%N 2>/dev/null || date +%s)
-
-    if command -v gdate &> /dev/null; then
-        DURATION=$(echo "$END_TIME - $START_TIME" | bc)
-        FORMATTED_TIME=$(printf "%.3f" $DURATION)
-    else
-        DURATION=$((END_TIME - START_TIME))
-        FORMATTED_TIME="${DURATION}"
-    fi
-
-    echo ""
-    if [ $EXIT_CODE -eq 0 ]; then
-        echo "${GREEN}✅ ${TEST_DIR} passed (${FORMATTED_TIME}s)${RESET}"
-        ((PASSED++))
-    else
-        echo "${RED}❌ ${TEST_DIR} failed with exit code ${EXIT_CODE} (${FORMATTED_TIME}s)${RESET}"
-        ((FAILED++))
-        FAILED_TESTS+=("$TEST_DIR")
-    fi
-    echo ""
+    for ENGINE in "${ENGINES[@]}"; do
+        echo "${CYAN}${BOLD}📦 Running ${TEST_DIR} tests (${ENGINE})...${RESET}"
+        echo ""
+
+        START_TIME=$(gdate +%s.%N 2>/dev/null || date +%s)
+
+        (cd "$TEST_DIR" && ../../build/slp -engine "$ENGINE" main.slpx)
+        EXIT_CODE=$?
+
+        END_TIME=$(gdate +%s.%N 2>/dev/null || date +%s)
+
+        if command -v gdate &> /dev/null; then
+            DURATION=$(echo "$END_TIME - $START_TIME" | bc)
+            FORMATTED_TIME=$(printf "%.3f" $DURATION)
+        else
+            DURATION=$((END_TIME - START_TIME))
+            FORMATTED_TIME="${DURATION}"
+        fi
+
+        echo ""
+        if [ $EXIT_CODE -eq 0 ]; then
+            echo "${GREEN}✅ ${TEST_DIR} (${ENGINE}) passed (${FORMATTED_TIME}s)${RESET}"
+            ((PASSED++))
+        else
+            echo "${RED}❌ ${TEST_DIR} (${ENGINE}) failed with exit code ${EXIT_CODE} (${FORMATTED_TIME}s)${RESET}"
+            ((FAILED++))
+            FAILED_TESTS+=("$TEST_DIR ($ENGINE)")
+        fi
+        echo ""
+    done
 done
 
 TOTAL_END=$(gdate +%s.%N 2>/dev/null || date +%s)